@@ -28,6 +28,15 @@ type PlayerConn interface {
 	net.Conn
 }
 
+// StreamConn is a PlayerConn with several independent streams, e.g. a QUIC
+// connection, so that data lost on one stream does not hold back the others.
+// Write writes on the main stream, stream 0, and GetNextMessage returns the
+// messages read from any stream.
+type StreamConn interface {
+	PlayerConn
+	WriteStream(stream int, b []byte) (int, error)
+}
+
 // Acceptor type interface
 type Acceptor interface {
 	ListenAndServe()
@@ -0,0 +1,101 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"net"
+
+	"github.com/tutumagi/pitaya/conn/kcp"
+	"github.com/tutumagi/pitaya/logger"
+)
+
+// KCPAcceptor accepts connections over KCP, a reliable protocol on top of
+// UDP with lower latency than TCP on lossy networks
+type KCPAcceptor struct {
+	addr     string
+	connChan chan PlayerConn
+	listener *kcp.Listener
+	running  bool
+}
+
+type kcpPlayerConn struct {
+	net.Conn
+}
+
+// GetNextMessage reads the next message available in the stream
+func (k *kcpPlayerConn) GetNextMessage() (b []byte, err error) {
+	return readNextMessage(k.Conn)
+}
+
+// NewKCPAcceptor creates a new instance of kcp acceptor listening on the udp
+// address addr
+func NewKCPAcceptor(addr string) *KCPAcceptor {
+	return &KCPAcceptor{
+		addr:     addr,
+		connChan: make(chan PlayerConn),
+		running:  false,
+	}
+}
+
+// GetAddr returns the addr the acceptor will listen on
+func (a *KCPAcceptor) GetAddr() string {
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+
+// GetConnChan gets a connection channel
+func (a *KCPAcceptor) GetConnChan() chan PlayerConn {
+	return a.connChan
+}
+
+// Stop stops the acceptor
+func (a *KCPAcceptor) Stop() {
+	a.running = false
+	a.listener.Close()
+}
+
+// ListenAndServe using kcp acceptor
+func (a *KCPAcceptor) ListenAndServe() {
+	listener, err := kcp.Listen(a.addr)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.listener = listener
+	a.running = true
+	a.serve()
+}
+
+func (a *KCPAcceptor) serve() {
+	defer a.Stop()
+	for a.running {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			logger.Log.Errorf("Failed to accept KCP connection: %s", err.Error())
+			return
+		}
+
+		a.connChan <- &kcpPlayerConn{
+			Conn: conn,
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/conn/kcp"
+	"github.com/tutumagi/pitaya/conn/packet"
+	"github.com/tutumagi/pitaya/helpers"
+)
+
+func TestNewKCPAcceptor(t *testing.T) {
+	t.Parallel()
+	a := NewKCPAcceptor("127.0.0.1:0")
+	assert.NotNil(t, a)
+	// returns nothing because not listening yet
+	assert.Equal(t, "", a.GetAddr())
+	assert.NotNil(t, a.GetConnChan())
+}
+
+func TestKCPAcceptorListenAndServe(t *testing.T) {
+	a := NewKCPAcceptor("127.0.0.1:0")
+	defer a.Stop()
+	c := a.GetConnChan()
+	go a.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	// the connection is accepted once the client sends data
+	conn, err := kcp.Dial(a.GetAddr())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte{0x02, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, c, time.Second)
+	assert.NotNil(t, playerConn)
+}
+
+func TestKCPAcceptorStop(t *testing.T) {
+	a := NewKCPAcceptor("127.0.0.1:0")
+	done := make(chan bool)
+	go func() {
+		a.ListenAndServe()
+		done <- true
+	}()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	a.Stop()
+	helpers.ShouldEventuallyReceive(t, done)
+}
+
+func TestKCPGetNextMessage(t *testing.T) {
+	tables := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"invalid_header", []byte{0x00, 0x00, 0x00, 0x00}, packet.ErrWrongPomeloPacketType},
+		{"valid_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			a := NewKCPAcceptor("127.0.0.1:0")
+			go a.ListenAndServe()
+			defer a.Stop()
+			c := a.GetConnChan()
+			helpers.ShouldEventuallyReturn(t, func() bool {
+				return a.GetAddr() != ""
+			}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+			conn, err := kcp.Dial(a.GetAddr())
+			assert.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write(table.data)
+			assert.NoError(t, err)
+
+			playerConn := helpers.ShouldEventuallyReceive(t, c, time.Second).(PlayerConn)
+			msg, err := playerConn.GetNextMessage()
+			if table.err != nil {
+				assert.EqualError(t, err, table.err.Error())
+			} else {
+				assert.Equal(t, table.data, msg)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestKCPGetNextMessageTwoMessagesInBuffer(t *testing.T) {
+	a := NewKCPAcceptor("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	c := a.GetConnChan()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	var conn net.Conn
+	conn, err := kcp.Dial(a.GetAddr())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	msg1 := []byte{0x01, 0x00, 0x00, 0x01, 0x02}
+	msg2 := []byte{0x02, 0x00, 0x00, 0x02, 0x01, 0x01}
+	_, err = conn.Write(append(msg1, msg2...))
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, c, time.Second).(PlayerConn)
+	msg, err := playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg1, msg)
+
+	msg, err = playerConn.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, msg2, msg)
+}
@@ -0,0 +1,274 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/tutumagi/pitaya/logger"
+)
+
+// QUICNextProto is the application protocol negotiated by the QUIC
+// connections of pitaya, clients must offer it in their tls config
+const QUICNextProto = "pitaya"
+
+// quicCloseTimeout is how long a closed QUIC connection waits for the peer
+// to close it before closing it itself, as QUIC drops the data still in
+// flight of closed connections
+const quicCloseTimeout = time.Second
+
+// QUICAcceptor accepts connections over QUIC, whose streams are independent
+// so that a packet lost on one of them does not hold back the others
+type QUICAcceptor struct {
+	addr     string
+	connChan chan PlayerConn
+	listener *quic.Listener
+	running  bool
+	certFile string
+	keyFile  string
+}
+
+// NewQUICAcceptor creates a new instance of quic acceptor listening on the
+// udp address addr, QUIC connections are always encrypted so a certificate
+// and its key must be given
+func NewQUICAcceptor(addr, certFile, keyFile string) *QUICAcceptor {
+	return &QUICAcceptor{
+		addr:     addr,
+		connChan: make(chan PlayerConn),
+		running:  false,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
+
+// GetAddr returns the addr the acceptor will listen on
+func (a *QUICAcceptor) GetAddr() string {
+	if a.listener != nil {
+		return a.listener.Addr().String()
+	}
+	return ""
+}
+
+// GetConnChan gets a connection channel
+func (a *QUICAcceptor) GetConnChan() chan PlayerConn {
+	return a.connChan
+}
+
+// Stop stops the acceptor
+func (a *QUICAcceptor) Stop() {
+	a.running = false
+	a.listener.Close()
+}
+
+// ListenAndServe using quic acceptor
+func (a *QUICAcceptor) ListenAndServe() {
+	crt, err := tls.LoadX509KeyPair(a.certFile, a.keyFile)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{crt},
+		NextProtos:   []string{QUICNextProto},
+	}
+
+	listener, err := quic.ListenAddr(a.addr, tlsCfg, nil)
+	if err != nil {
+		logger.Log.Fatalf("Failed to listen: %s", err.Error())
+	}
+	a.listener = listener
+	a.running = true
+	a.serve()
+}
+
+func (a *QUICAcceptor) serve() {
+	defer a.Stop()
+	for a.running {
+		conn, err := a.listener.Accept(context.Background())
+		if err != nil {
+			logger.Log.Errorf("Failed to accept QUIC connection: %s", err.Error())
+			return
+		}
+
+		go a.acceptMainStream(conn)
+	}
+}
+
+// acceptMainStream passes conn on once the client opens its main stream,
+// which happens when it sends its first data, the handshake
+func (a *QUICAcceptor) acceptMainStream(conn quic.Connection) {
+	stream, err := conn.AcceptStream(context.Background())
+	if err != nil {
+		logger.Log.Errorf("Failed to accept QUIC stream: %s", err.Error())
+		conn.CloseWithError(0, "")
+		return
+	}
+
+	a.connChan <- NewQUICConn(conn, stream)
+}
+
+// QUICConn is a StreamConn over a QUIC connection. Everything is read and
+// written on its main stream, the bidirectional stream opened by the client,
+// except for the packets written with WriteStream on other streams, each of
+// them being an unidirectional stream opened by the writer.
+type QUICConn struct {
+	conn   quic.Connection
+	stream quic.Stream
+
+	mutex         sync.Mutex
+	streams       map[int]quic.SendStream
+	writeDeadline time.Time
+	closed        bool
+}
+
+// NewQUICConn returns a *QUICConn whose main stream is stream
+func NewQUICConn(conn quic.Connection, stream quic.Stream) *QUICConn {
+	return &QUICConn{
+		conn:    conn,
+		stream:  stream,
+		streams: map[int]quic.SendStream{},
+	}
+}
+
+// GetNextMessage reads the next message available in the main stream
+func (c *QUICConn) GetNextMessage() (b []byte, err error) {
+	return readNextMessage(c.stream)
+}
+
+// Read reads data from the main stream
+func (c *QUICConn) Read(b []byte) (int, error) {
+	return c.stream.Read(b)
+}
+
+// Write writes data to the main stream
+func (c *QUICConn) Write(b []byte) (int, error) {
+	return c.stream.Write(b)
+}
+
+// WriteStream writes data to stream, stream 0 being the main stream, the
+// other streams are opened the first time they are written to
+func (c *QUICConn) WriteStream(stream int, b []byte) (int, error) {
+	if stream == 0 {
+		return c.Write(b)
+	}
+	s, err := c.sendStream(stream)
+	if err != nil {
+		return 0, err
+	}
+	return s.Write(b)
+}
+
+func (c *QUICConn) sendStream(stream int) (quic.SendStream, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if s, ok := c.streams[stream]; ok {
+		return s, nil
+	}
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+
+	s, err := c.conn.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.SetWriteDeadline(c.writeDeadline); err != nil {
+		s.CancelWrite(0)
+		return nil, err
+	}
+	c.streams[stream] = s
+	return s, nil
+}
+
+// Close closes the streams and then the connection, once the peer closes it
+// or after quicCloseTimeout, so that it can read the data already written
+func (c *QUICConn) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	c.stream.CancelRead(0)
+	err := c.stream.Close()
+	for _, s := range c.streams {
+		s.Close()
+	}
+
+	go func() {
+		select {
+		case <-c.conn.Context().Done():
+		case <-time.After(quicCloseTimeout):
+		}
+		c.conn.CloseWithError(0, "")
+	}()
+	return err
+}
+
+// LocalAddr returns the local network address.
+func (c *QUICConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *QUICConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the streams, it is
+// equivalent to calling both SetReadDeadline and SetWriteDeadline.
+func (c *QUICConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future Read calls and any
+// currently-blocked Read call on the main stream.
+func (c *QUICConn) SetReadDeadline(t time.Time) error {
+	return c.stream.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future Write calls and any
+// currently-blocked Write call on every stream, including the ones opened
+// later on.
+func (c *QUICConn) SetWriteDeadline(t time.Time) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.writeDeadline = t
+	if err := c.stream.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	for _, s := range c.streams {
+		if err := s.SetWriteDeadline(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
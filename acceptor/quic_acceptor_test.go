@@ -0,0 +1,191 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package acceptor
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/conn/packet"
+	"github.com/tutumagi/pitaya/helpers"
+)
+
+func newQUICAcceptor(t *testing.T) *QUICAcceptor {
+	a := NewQUICAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+	go a.ListenAndServe()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+	return a
+}
+
+// dialQUIC connects to a and opens the main stream, which the acceptor only
+// learns about once data is written on it
+func dialQUIC(t *testing.T, a *QUICAcceptor) (quic.Connection, quic.Stream) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{QUICNextProto}}
+	conn, err := quic.DialAddr(context.Background(), a.GetAddr(), tlsConfig, nil)
+	assert.NoError(t, err)
+	stream, err := conn.OpenStreamSync(context.Background())
+	assert.NoError(t, err)
+	return conn, stream
+}
+
+func TestNewQUICAcceptor(t *testing.T) {
+	t.Parallel()
+	a := NewQUICAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+	assert.NotNil(t, a)
+	// returns nothing because not listening yet
+	assert.Equal(t, "", a.GetAddr())
+	assert.NotNil(t, a.GetConnChan())
+}
+
+func TestQUICAcceptorListenAndServe(t *testing.T) {
+	a := newQUICAcceptor(t)
+	defer a.Stop()
+
+	conn, stream := dialQUIC(t, a)
+	defer conn.CloseWithError(0, "")
+	_, err := stream.Write([]byte{0x02, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(PlayerConn)
+	assert.Equal(t, conn.LocalAddr().(*net.UDPAddr).Port, playerConn.RemoteAddr().(*net.UDPAddr).Port)
+	playerConn.Close()
+}
+
+func TestQUICAcceptorStop(t *testing.T) {
+	a := NewQUICAcceptor("127.0.0.1:0", "./fixtures/server.crt", "./fixtures/server.key")
+	done := make(chan bool)
+	go func() {
+		a.ListenAndServe()
+		done <- true
+	}()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	a.Stop()
+	helpers.ShouldEventuallyReceive(t, done)
+}
+
+func TestQUICGetNextMessage(t *testing.T) {
+	tables := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"invalid_header", []byte{0x00, 0x00, 0x00, 0x00}, packet.ErrWrongPomeloPacketType},
+		{"valid_message", []byte{0x02, 0x00, 0x00, 0x01, 0x00}, nil},
+		{"two_messages", []byte{0x01, 0x00, 0x00, 0x01, 0x02, 0x02, 0x00, 0x00, 0x01, 0x01}, nil},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			a := newQUICAcceptor(t)
+			defer a.Stop()
+
+			conn, stream := dialQUIC(t, a)
+			defer conn.CloseWithError(0, "")
+			_, err := stream.Write(table.data)
+			assert.NoError(t, err)
+
+			playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(PlayerConn)
+			defer playerConn.Close()
+			var received []byte
+			for len(received) < len(table.data) {
+				msg, err := playerConn.GetNextMessage()
+				if table.err != nil {
+					assert.EqualError(t, err, table.err.Error())
+					return
+				}
+				assert.NoError(t, err)
+				received = append(received, msg...)
+			}
+			assert.Equal(t, table.data, received)
+		})
+	}
+}
+
+func TestQUICConnWriteStream(t *testing.T) {
+	a := newQUICAcceptor(t)
+	defer a.Stop()
+
+	conn, stream := dialQUIC(t, a)
+	defer conn.CloseWithError(0, "")
+	_, err := stream.Write([]byte{0x02, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(StreamConn)
+	defer playerConn.Close()
+	assert.NoError(t, playerConn.SetWriteDeadline(time.Now().Add(time.Second)))
+
+	// stream 0 is the main stream, the others are opened on their first write
+	_, err = playerConn.WriteStream(0, []byte("main"))
+	assert.NoError(t, err)
+	_, err = playerConn.WriteStream(1, []byte("state"))
+	assert.NoError(t, err)
+	_, err = playerConn.WriteStream(1, []byte("state"))
+	assert.NoError(t, err)
+
+	data := make([]byte, 4)
+	_, err = io.ReadFull(stream, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "main", string(data))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	uni, err := conn.AcceptUniStream(ctx)
+	assert.NoError(t, err)
+	data = make([]byte, 10)
+	_, err = io.ReadFull(uni, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "statestate", string(data))
+}
+
+func TestQUICConnClose(t *testing.T) {
+	a := newQUICAcceptor(t)
+	defer a.Stop()
+
+	conn, stream := dialQUIC(t, a)
+	defer conn.CloseWithError(0, "")
+	_, err := stream.Write([]byte{0x02, 0x00, 0x00, 0x00})
+	assert.NoError(t, err)
+
+	playerConn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(StreamConn)
+	_, err = playerConn.Write([]byte("kick"))
+	assert.NoError(t, err)
+	assert.NoError(t, playerConn.Close())
+	assert.NoError(t, playerConn.Close())
+
+	// the data written before closing still reaches the peer
+	data, err := io.ReadAll(stream)
+	assert.NoError(t, err)
+	assert.Equal(t, "kick", string(data))
+
+	_, err = playerConn.WriteStream(1, []byte("state"))
+	assert.Equal(t, net.ErrClosed, err)
+}
@@ -47,7 +47,12 @@ type tcpPlayerConn struct {
 
 // GetNextMessage reads the next message available in the stream
 func (t *tcpPlayerConn) GetNextMessage() (b []byte, err error) {
-	header, err := ioutil.ReadAll(io.LimitReader(t.Conn, codec.HeadLength))
+	return readNextMessage(t.Conn)
+}
+
+// readNextMessage reads the next packet of a stream of pomelo packets
+func readNextMessage(r io.Reader) ([]byte, error) {
+	header, err := ioutil.ReadAll(io.LimitReader(r, codec.HeadLength))
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +60,7 @@ func (t *tcpPlayerConn) GetNextMessage() (b []byte, err error) {
 	if err != nil {
 		return nil, err
 	}
-	msgData, err := ioutil.ReadAll(io.LimitReader(t.Conn, int64(msgSize)))
+	msgData, err := ioutil.ReadAll(io.LimitReader(r, int64(msgSize)))
 	if err != nil {
 		return nil, err
 	}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/tutumagi/pitaya"
 	"github.com/tutumagi/pitaya/acceptor"
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/constants"
 	"github.com/tutumagi/pitaya/logger"
 	"github.com/tutumagi/pitaya/metrics"
@@ -40,26 +41,36 @@ import (
 // Read is droped and ignored by pitaya.
 // On the client side, this will yield a timeout error and the client must
 // be prepared to handle it.
+// When set to disconnect, exceeding the limit returns ErrRateLimitExceeded
+// instead, which closes the connection with the rate limit close reason.
 type RateLimiter struct {
 	acceptor.PlayerConn
 	limit        int
 	interval     time.Duration
 	times        list.List
 	forceDisable bool
+	disconnect   bool
+	clock        clock.Clock
 }
 
-// NewRateLimiter returns an initialized *RateLimiting
+// NewRateLimiter returns an initialized *RateLimiting, the app clock is
+// used unless a clock is given
 func NewRateLimiter(
 	conn acceptor.PlayerConn,
 	limit int,
 	interval time.Duration,
 	forceDisable bool,
+	clockOrNil ...clock.Clock,
 ) *RateLimiter {
 	r := &RateLimiter{
 		PlayerConn:   conn,
 		limit:        limit,
 		interval:     interval,
 		forceDisable: forceDisable,
+		clock:        pitaya.GetClock(),
+	}
+	if len(clockOrNil) > 0 && clockOrNil[0] != nil {
+		r.clock = clockOrNil[0]
 	}
 
 	r.times.Init()
@@ -67,6 +78,12 @@ func NewRateLimiter(
 	return r
 }
 
+// SetDisconnect sets whether exceeding the limit disconnects the client
+// instead of dropping its message
+func (r *RateLimiter) SetDisconnect(disconnect bool) {
+	r.disconnect = disconnect
+}
+
 // GetNextMessage gets the next message in the connection
 func (r *RateLimiter) GetNextMessage() (msg []byte, err error) {
 	if r.forceDisable {
@@ -79,10 +96,13 @@ func (r *RateLimiter) GetNextMessage() (msg []byte, err error) {
 			return nil, err
 		}
 
-		now := time.Now()
+		now := r.clock.Now()
 		if r.shouldRateLimit(now) {
 			logger.Log.Errorf("Data=%s, Error=%s", msg, constants.ErrRateLimitExceeded)
 			metrics.ReportExceededRateLimiting(pitaya.GetMetricsReporters())
+			if r.disconnect {
+				return nil, constants.ErrRateLimitExceeded
+			}
 			continue
 		}
 
@@ -27,6 +27,8 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/clock"
+	"github.com/tutumagi/pitaya/constants"
 	"github.com/tutumagi/pitaya/mocks"
 )
 
@@ -117,6 +119,59 @@ func TestRateLimiterGetNextMessage(t *testing.T) {
 	}
 }
 
+func TestRateLimiterWithManualClock(t *testing.T) {
+	t.Parallel()
+
+	var (
+		limit    = 2
+		interval = time.Second
+		ret      = []byte{0x01}
+		c        = clock.NewManual(time.Now())
+	)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	r := NewRateLimiter(mockConn, limit, interval, false, c)
+
+	mockConn.EXPECT().GetNextMessage().Return(ret, nil).Times(limit)
+	for i := 0; i < limit; i++ {
+		_, err := r.GetNextMessage()
+		assert.NoError(t, err)
+	}
+	assert.True(t, r.shouldRateLimit(c.Now()))
+
+	c.Advance(interval)
+	mockConn.EXPECT().GetNextMessage().Return(ret, nil)
+	buf, err := r.GetNextMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, ret, buf)
+}
+
+func TestRateLimiterDisconnect(t *testing.T) {
+	t.Parallel()
+
+	var (
+		limit    = 1
+		interval = time.Second
+		ret      = []byte{0x01}
+		c        = clock.NewManual(time.Now())
+	)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	r := NewRateLimiter(mockConn, limit, interval, false, c)
+	r.SetDisconnect(true)
+
+	mockConn.EXPECT().GetNextMessage().Return(ret, nil).Times(2)
+	_, err := r.GetNextMessage()
+	assert.NoError(t, err)
+	buf, err := r.GetNextMessage()
+	assert.Equal(t, constants.ErrRateLimitExceeded, err)
+	assert.Nil(t, buf)
+}
+
 func TestRateLimiterShouldRateLimit(t *testing.T) {
 	t.Parallel()
 
@@ -40,9 +40,12 @@ func NewRateLimitingWrapper(c *config.Config) *RateLimitingWrapper {
 			limit        = c.GetInt("pitaya.conn.ratelimiting.limit")
 			interval     = c.GetDuration("pitaya.conn.ratelimiting.interval")
 			forceDisable = c.GetBool("pitaya.conn.ratelimiting.forcedisable")
+			disconnect   = c.GetBool("pitaya.conn.ratelimiting.disconnect")
 		)
 
-		return NewRateLimiter(conn, limit, interval, forceDisable)
+		r := NewRateLimiter(conn, limit, interval, forceDisable)
+		r.SetDisconnect(disconnect)
+		return r
 	})
 
 	return r
@@ -24,7 +24,6 @@ import (
 	"context"
 	"encoding/binary"
 	gojson "encoding/json"
-	e "errors"
 	"fmt"
 	"net"
 	"strings"
@@ -32,6 +31,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/conn/codec"
 	"github.com/tutumagi/pitaya/conn/message"
 	"github.com/tutumagi/pitaya/conn/packet"
@@ -39,7 +39,6 @@ import (
 	"github.com/tutumagi/pitaya/errors"
 	"github.com/tutumagi/pitaya/logger"
 	"github.com/tutumagi/pitaya/metrics"
-	"github.com/tutumagi/pitaya/protos"
 	"github.com/tutumagi/pitaya/route"
 	"github.com/tutumagi/pitaya/serialize"
 	"github.com/tutumagi/pitaya/session"
@@ -60,39 +59,34 @@ var (
 
 const handlerType = "handler"
 
-type AgentCloseReason int32
+// AgentCloseReason is the reason an agent was closed for
+//
+// Deprecated: use session.CloseReason
+type AgentCloseReason = session.CloseReason
 
+// Agent close reasons, they are mapped onto the session close reasons
+//
+// Deprecated: use the session.CloseReason constants
 const (
-	_ AgentCloseReason = iota
-	AgentCloseByWriteEnd
-	AgentCloseByHeartBeat
-	AgentCloseByHandleEnd
-	AgentCloseByMessageEnd
+	AgentCloseByWriteEnd   = session.CloseReasonClientDisconnect
+	AgentCloseByHeartBeat  = session.CloseReasonHeartbeatTimeout
+	AgentCloseByHandleEnd  = session.CloseReasonClientDisconnect
+	AgentCloseByMessageEnd = session.CloseReasonUnknown
 )
 
-func (a AgentCloseReason) String() string {
-	switch a {
-	case AgentCloseByWriteEnd:
-		return "AgentCloseByWriteEnd"
-	case AgentCloseByHeartBeat:
-		return "AgentCloseByHeartBeat"
-	case AgentCloseByHandleEnd:
-		return "AgentCloseByHandleEnd"
-	case AgentCloseByMessageEnd:
-		return "AgentCloseByMessageEnd"
-	default:
-		return "UnknownReason"
-	}
-}
-
 type (
 	// Agent corresponds to a user and is used for storing raw Conn information
 	Agent struct {
-		Session            *session.Session          // session
+		Session            *session.Session // session, read it with GetSession as it changes when resumed
+		sessionGeneration  uint64           // generation of the session the agent attached to
+		sessionMutex       sync.RWMutex
 		appDieChan         chan bool                 // app die channel
 		chDie              chan struct{}             // wait for close
-		chSend             chan pendingWrite         // push message queue
+		clock              clock.Clock               // time source of heartbeats
+		chSend             chan pendingWrite         // response and critical push queue
+		chPush             chan pendingWrite         // push message queue
 		chHbSend           chan pendingWrite         // push message queue (心跳专用)
+		chDroppable        chan struct{}             // signals a pending droppable push
 		chStopHeartbeat    chan struct{}             // stop heartbeats
 		chStopWrite        chan struct{}             // stop writing messages
 		ChRoleMessages     chan UnhandledRoleMessage // 用户请求的消息列表(队列)
@@ -105,8 +99,29 @@ type (
 		messageEncoder     message.Encoder
 		messagesBufferSize int // size of the pending messages buffer
 		metricsReporters   []metrics.Reporter
+		overflowPolicy     OverflowPolicy       // what to do when ChRoleMessages is full
+		overflowTimeout    time.Duration        // how long OverflowBlock waits
 		serializer         serialize.Serializer // message serializer
 		state              int32                // current agent state
+		resumed            bool                 // if the handshake resumed a retained session
+		sendKickReason     bool                 // if the close reason is sent on kick packets
+		writeTimeout       time.Duration        // deadline of the writes to the connection
+		coalesceSize       int                  // bytes joined in a single write, 0 disables coalescing
+		coalesceInterval   time.Duration        // how long to wait for more packets to join
+		batch              []pendingWrite       // packets joined in the current write
+		buffer             []byte               // data of the current write
+		droppableMutex     sync.Mutex
+		droppable          map[string]pendingWrite // latest pending push of the droppable routes
+		droppableRoutes    []string                // droppable routes in the order they were pushed
+		lastRequestID      uint64                  // id of the last request sent to the client
+		requestTimeout     time.Duration           // how long to wait for the responses of the client
+		requestsMutex      sync.Mutex
+		requests           map[uint]chan *message.Message // requests waiting for the response of the client
+
+		slowSince             int64              // when the send queues went above the slow consumer threshold, in nanoseconds
+		slowConsumerPolicy    SlowConsumerPolicy // what to do when the client is a slow consumer
+		slowConsumerThreshold float64            // fraction of a send queue that must be full
+		slowConsumerWindow    time.Duration      // how long a send queue must stay above the threshold
 	}
 
 	pendingMessage struct {
@@ -119,19 +134,22 @@ type (
 	}
 
 	pendingWrite struct {
-		ctx  context.Context
-		data []byte
-		err  error
+		ctx    context.Context
+		data   []byte
+		err    error
+		stream int // stream of the connection the data is written on
 	}
 
 	UnhandledRoleMessage struct {
 		Ctx   context.Context
 		Route *route.Route
 		Msg   *message.Message
+		Fn    func() // function to execute in order with the messages, e.g. session timers
 	}
 )
 
-// NewAgent create new agent instance
+// NewAgent create new agent instance, the real clock is used unless a clock
+// is given
 func NewAgent(
 	conn net.Conn,
 	packetDecoder codec.PacketDecoder,
@@ -142,7 +160,13 @@ func NewAgent(
 	dieChan chan bool,
 	messageEncoder message.Encoder,
 	metricsReporters []metrics.Reporter,
+	clockOrNil ...clock.Clock,
 ) *Agent {
+	clk := clock.New()
+	if len(clockOrNil) > 0 && clockOrNil[0] != nil {
+		clk = clockOrNil[0]
+	}
+
 	// initialize heartbeat and handshake data on first user connection
 	serializerName := serializer.GetName()
 
@@ -153,8 +177,13 @@ func NewAgent(
 	a := &Agent{
 		appDieChan:         dieChan,
 		chDie:              make(chan struct{}),
+		clock:              clk,
 		chSend:             make(chan pendingWrite, messagesBufferSize),
+		chPush:             make(chan pendingWrite, messagesBufferSize),
 		chHbSend:           make(chan pendingWrite, messagesBufferSize),
+		chDroppable:        make(chan struct{}, 1),
+		droppable:          make(map[string]pendingWrite),
+		requests:           make(map[uint]chan *message.Message),
 		chStopHeartbeat:    make(chan struct{}),
 		chStopWrite:        make(chan struct{}),
 		messagesBufferSize: messagesBufferSize,
@@ -162,7 +191,7 @@ func NewAgent(
 		decoder:            packetDecoder,
 		encoder:            packetEncoder,
 		heartbeatTimeout:   heartbeatTime,
-		lastAt:             time.Now().Unix(),
+		lastAt:             clk.Now().Unix(),
 		serializer:         serializer,
 		state:              constants.StatusStart,
 		messageEncoder:     messageEncoder,
@@ -173,6 +202,7 @@ func NewAgent(
 	s := session.New(a, true)
 	metrics.ReportNumberOfConnectedClients(metricsReporters, session.SessionCount)
 	a.Session = s
+	agents.Store(a, struct{}{})
 	return a
 }
 
@@ -217,7 +247,10 @@ func (a *Agent) send(pendingMsg pendingMessage) (err error) {
 			err = errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
 		}
 	}()
-	a.reportChannelSize()
+	ch, channel := a.sendQueue(pendingMsg)
+	if ch != nil {
+		a.reportChannelSize(ch, channel)
+	}
 
 	m, err := a.getMessageFromPendingMessage(pendingMsg)
 	if err != nil {
@@ -231,17 +264,27 @@ func (a *Agent) send(pendingMsg pendingMessage) (err error) {
 	}
 
 	pWrite := pendingWrite{
-		ctx:  pendingMsg.ctx,
-		data: p,
+		ctx:    pendingMsg.ctx,
+		data:   p,
+		stream: messageStream(pendingMsg),
 	}
 
 	if pendingMsg.err {
 		pWrite.err = util.GetErrorFromPayload(a.serializer, m.Data)
 	}
 
+	if err := a.applySlowConsumerPolicy(pendingMsg); err != nil {
+		return err
+	}
+
+	if ch == nil {
+		a.setDroppable(pendingMsg.route, pWrite)
+		return
+	}
+
 	// chSend is never closed so we need this to don't block if agent is already closed
 	select {
-	case a.chSend <- pWrite:
+	case ch <- pWrite:
 	case <-a.chDie:
 	}
 	return
@@ -285,10 +328,10 @@ func (a *Agent) ResponseMID(ctx context.Context, mid uint, v interface{}, isErro
 	switch d := v.(type) {
 	case []byte:
 		logger.Log.Debugf("Type=Response, ID=%d, UID=%d, MID=%d, Data=%dbytes",
-			a.Session.ID(), a.Session.UID(), mid, len(d))
+			a.GetSession().ID(), a.GetSession().UID(), mid, len(d))
 	default:
 		logger.Log.Infof("Type=Response, ID=%d, UID=%d, MID=%d, Data=%+v",
-			a.Session.ID(), a.Session.UID(), mid, v)
+			a.GetSession().ID(), a.GetSession().UID(), mid, v)
 	}
 
 	return a.send(pendingMessage{ctx: ctx, typ: message.Response, mid: mid, payload: v, err: err})
@@ -297,26 +340,51 @@ func (a *Agent) ResponseMID(ctx context.Context, mid uint, v interface{}, isErro
 // Close closes the agent, cleans inner state and closes low-level connection.
 // Any blocked Read or Write operations will be unblocked and return errors.
 func (a *Agent) Close() error {
+	return a.close(session.CloseReasonUnknown)
+}
+
+// CloseByReason closes the agent for reason, which is kept in the session
+// for the close callbacks unless the session had a reason already
+func (a *Agent) CloseByReason(reason session.CloseReason) {
+	logger.Log.Debugf("CloseByReason rs = %s", reason)
+	a.close(reason)
+}
+
+func (a *Agent) close(reason session.CloseReason) error {
 	a.closeMutex.Lock()
 	defer a.closeMutex.Unlock()
 	if a.GetStatus() == constants.StatusClosed {
 		return constants.ErrCloseClosedSession
 	}
 	a.SetStatus(constants.StatusClosed)
+	s := a.GetSession()
+	s.SetCloseReason(reason)
+	metrics.ReportClosedConnection(a.metricsReporters, s.CloseReason().String())
 
 	logger.Log.Debugf("Session closed, ID=%d, UID=%s, IP=%s",
-		a.Session.ID(), a.Session.UID(), a.conn.RemoteAddr())
+		s.ID(), s.UID(), a.conn.RemoteAddr())
 
 	// prevent closing closed channel
 	select {
 	case <-a.chDie:
 		// expect
 	default:
+		// retained before the message goroutine sees chDie and closes the
+		// session, so that it only closes the connection of a retained one
+		retained := session.Retain(s, func() {
+			s.StopTimers()
+			onSessionClosed(s)
+			s.Close()
+		})
 		close(a.chStopWrite)
 		close(a.chStopHeartbeat)
 		close(a.chDie)
 		close(a.ChRoleMessages)
-		onSessionClosed(a.Session)
+		agents.Delete(a)
+		if !retained {
+			s.StopTimers()
+			onSessionClosed(s)
+		}
 	}
 
 	metrics.ReportNumberOfConnectedClients(a.metricsReporters, session.SessionCount)
@@ -344,10 +412,20 @@ func (a *Agent) ChDie() chan struct{} {
 	return a.chDie
 }
 
+// SetSendKickReason sets whether kick packets carry the reason of the kick,
+// as a json object with a reason field
+func (a *Agent) SetSendKickReason(enabled bool) {
+	a.sendKickReason = enabled
+}
+
 // Kick sends a kick packet to a client
 func (a *Agent) Kick(ctx context.Context) error {
+	var data []byte
+	if a.sendKickReason {
+		data, _ = gojson.Marshal(map[string]string{"reason": a.GetSession().CloseReason().String()})
+	}
 	// packet encode
-	p, err := a.encoder.Encode(packet.Kick, nil)
+	p, err := a.encoder.Encode(packet.Kick, data)
 	if err != nil {
 		return err
 	}
@@ -357,7 +435,7 @@ func (a *Agent) Kick(ctx context.Context) error {
 
 // SetLastAt sets the last at to now
 func (a *Agent) SetLastAt() {
-	atomic.StoreInt64(&a.lastAt, time.Now().Unix())
+	atomic.StoreInt64(&a.lastAt, a.clock.Now().Unix())
 }
 
 // SetStatus sets the agent status
@@ -368,8 +446,8 @@ func (a *Agent) SetStatus(state int32) {
 // Handle handles the messages from and to a client
 func (a *Agent) Handle() {
 	defer func() {
-		a.CloseByReason(AgentCloseByHandleEnd)
-		logger.Log.Debugf("Session handle goroutine exit, SessionID=%d, UID=%d", a.Session.ID(), a.Session.UID())
+		a.CloseByReason(session.CloseReasonClientDisconnect)
+		logger.Log.Debugf("Session handle goroutine exit, SessionID=%d, UID=%d", a.GetSession().ID(), a.GetSession().UID())
 	}()
 
 	go a.write()
@@ -398,11 +476,11 @@ func (a *Agent) IPVersion() string {
 }
 
 func (a *Agent) heartbeat() {
-	ticker := time.NewTicker(a.heartbeatTimeout)
+	ticker := a.clock.NewTicker(a.heartbeatTimeout)
 
 	defer func() {
 		ticker.Stop()
-		a.CloseByReason(AgentCloseByHeartBeat)
+		a.CloseByReason(session.CloseReasonHeartbeatTimeout)
 		close(a.chHbSend)
 		if e := recover(); e != nil {
 			logger.Log.Warnf("heartbeat err=%+v", e)
@@ -411,19 +489,19 @@ func (a *Agent) heartbeat() {
 
 	for {
 		select {
-		case <-ticker.C:
-			now := time.Now()
+		case <-ticker.C():
+			now := a.clock.Now()
 			deadline := now.Add(-2 * a.heartbeatTimeout).Unix()
 			if atomic.LoadInt64(&a.lastAt) < deadline {
 				logger.Log.Debugf("Session heartbeat timeout, LastTime=%d, Deadline=%d", atomic.LoadInt64(&a.lastAt), deadline)
 				return
 			}
 
-			// 时间戳，毫秒
-			ts := uint64(now.UnixNano() / int64(time.Millisecond))
-			binary.BigEndian.PutUint64(hbd, ts)
+			// 时间戳，毫秒，the client echoes it to measure the round trip time
+			data := make([]byte, 8)
+			binary.BigEndian.PutUint64(data, uint64(now.UnixNano()/int64(time.Millisecond)))
 
-			bytes, err := a.encoder.Encode(packet.Heartbeat, hbd)
+			bytes, err := a.encoder.Encode(packet.Heartbeat, data)
 			if err != nil {
 				logger.Log.Warn("encode heartbeat err %s", err)
 			}
@@ -461,6 +539,42 @@ func onSessionClosed(s *session.Session) {
 	}
 }
 
+// ResumeSession attaches the agent to the retained session of token instead
+// of its own, received is the number of pushes the client got on it
+func (a *Agent) ResumeSession(token string, received uint64) error {
+	s, err := session.Resume(token, a.GetSession(), received)
+	if err != nil {
+		return err
+	}
+	a.sessionMutex.Lock()
+	a.Session = s
+	a.sessionGeneration = s.Generation()
+	a.resumed = true
+	a.sessionMutex.Unlock()
+	return nil
+}
+
+// CloseSession closes the session of the agent unless it was retained when
+// the agent closed, retained sessions are closed when they expire and
+// resumed ones belong to the agent that resumed them
+func (a *Agent) CloseSession() {
+	a.sessionMutex.RLock()
+	s, generation := a.Session, a.sessionGeneration
+	a.sessionMutex.RUnlock()
+	if s.Generation() != generation {
+		return
+	}
+	s.Close()
+}
+
+// GetSession returns the session of the agent, it is replaced by the
+// retained session when the handshake resumes one
+func (a *Agent) GetSession() *session.Session {
+	a.sessionMutex.RLock()
+	defer a.sessionMutex.RUnlock()
+	return a.Session
+}
+
 // SendHandshakeResponse sends a handshake response
 func (a *Agent) SendHandshakeResponse() error {
 	_, err := a.conn.Write(a.hrdEncodeInner())
@@ -468,47 +582,51 @@ func (a *Agent) SendHandshakeResponse() error {
 }
 
 func (a *Agent) write() {
+	reason := session.CloseReasonClientDisconnect
 	// clean func
 	defer func() {
 		close(a.chSend)
-		a.CloseByReason(AgentCloseByWriteEnd)
+		close(a.chPush)
+		a.CloseByReason(reason)
 	}()
 
 	for {
-		select {
-		case pWrite := <-a.chSend:
-			//TODO 搞明白什么情况下会发生什么事情
-			// a.conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
-			// close agent if low-level Conn broken
-			if _, err := a.conn.Write(pWrite.data); err != nil {
-				tracing.FinishSpan(pWrite.ctx, err)
-				metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, err)
-				logger.Log.Errorf("Failed to write in conn: %s", err.Error())
-				return
-			}
-			var e error
-			tracing.FinishSpan(pWrite.ctx, e)
-			metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, pWrite.err)
-		case pWrite := <-a.chHbSend:
-			//TODO 搞明白什么情况下会发生什么事情
-			// a.conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
-			// logger.Log.Debugf("heartbeat chHbSend ->")
-			// close agent if low-level Conn broken
-			if _, err := a.conn.Write(pWrite.data); err != nil {
-				tracing.FinishSpan(pWrite.ctx, err)
-				metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, err)
-				logger.Log.Errorf("Failed to write in conn: %s", err.Error())
-				return
-			}
-		case <-a.chStopWrite:
+		pWrite, ok := a.waitWrite(nil)
+		if !ok {
+			return
+		}
+		// close agent if low-level Conn broken or the client stopped reading
+		if rs, err := a.writeCoalesced(pWrite); err != nil {
+			reason = rs
+			logger.Log.Errorf("Failed to write in conn: %s", err.Error())
 			return
 		}
 	}
 }
 
-// SendRequest sends a request to a server
-func (a *Agent) SendRequest(ctx context.Context, serverID, route string, v interface{}) (*protos.Response, error) {
-	return nil, e.New("not implemented")
+// Execute implementation for session.Executor interface
+// enqueues fn to be called in order with the messages of the agent. It is
+// called from the timer goroutine so it never blocks, fn is dropped if the
+// queue is full whatever the overflow policy.
+func (a *Agent) Execute(fn func()) (err error) {
+	defer func() {
+		// ChRoleMessages is closed with the agent
+		if e := recover(); e != nil {
+			err = errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+		}
+	}()
+	if a.GetStatus() == constants.StatusClosed {
+		return errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+	}
+
+	select {
+	case a.ChRoleMessages <- UnhandledRoleMessage{Fn: fn}:
+		return nil
+	default:
+		logger.Log.Warnf("dropped function of full message queue, %s", a.GetSession().DebugString())
+		a.reportDropped(OverflowDropNewest)
+		return constants.ErrRoleMessagesOverflow
+	}
 }
 
 // AnswerWithError answers with an error
@@ -531,7 +649,7 @@ func (a *Agent) AnswerWithError(ctx context.Context, mid uint, err error) {
 		logger.Log.Errorf("error answering the user with an error: %s", e.Error())
 		return
 	}
-	e = a.Session.ResponseMID(ctx, mid, p, true)
+	e = a.GetSession().ResponseMID(ctx, mid, p, true)
 	if e != nil {
 		logger.Log.Errorf("error answering the user with an error: %s", e.Error())
 	}
@@ -581,11 +699,16 @@ func (a *Agent) hrdEncodeInner() []byte {
 		"code": 200,
 		"sys": map[string]interface{}{
 			"heartbeat":  a.heartbeatTimeout.Seconds(),
-			"severtime":  uint64(time.Now().UnixNano() / int64(time.Millisecond)), // 时间戳，毫秒
-			"dict":       map[string]uint16{},                                     //message.GetDictionary(),
+			"severtime":  uint64(a.clock.Now().UnixNano() / int64(time.Millisecond)), // 时间戳，毫秒
+			"dict":       map[string]uint16{},                                        //message.GetDictionary(),
 			"serializer": a.serializer.GetName(),
 		},
 	}
+	if token := a.GetSession().ResumeToken(); token != "" {
+		sys := hData["sys"].(map[string]interface{})
+		sys["resumeToken"] = token
+		sys["resumed"] = a.resumed
+	}
 	data, err := gojson.Marshal(hData)
 	if err != nil {
 		logger.Log.Warnf("hrdEncodeInner gojson.Marshal error:%v", err)
@@ -613,19 +736,15 @@ func (a *Agent) hrdEncodeInner() []byte {
 	return hrdBuff
 }
 
-func (a *Agent) reportChannelSize() {
-	chSendCapacity := a.messagesBufferSize - len(a.chSend)
-	if chSendCapacity == 0 {
-		logger.Log.Warnf("chSend is at maximum capacity cap:%d", a.messagesBufferSize)
+func (a *Agent) reportChannelSize(ch chan pendingWrite, channel string) {
+	capacity := a.messagesBufferSize - len(ch)
+	if capacity == 0 {
+		logger.Log.Warnf("%s is at maximum capacity cap:%d", channel, a.messagesBufferSize)
 	}
 	for _, mr := range a.metricsReporters {
-		if err := mr.ReportGauge(metrics.ChannelCapacity, map[string]string{"channel": "agent_chsend"}, float64(chSendCapacity)); err != nil {
-			logger.Log.Warnf("failed to report chSend channel capaacity: %s", err.Error())
+		if err := mr.ReportGauge(metrics.ChannelCapacity, map[string]string{"channel": channel}, float64(capacity)); err != nil {
+			logger.Log.Warnf("failed to report %s channel capaacity: %s", channel, err.Error())
 		}
 	}
 }
 
-func (a *Agent) CloseByReason(rs AgentCloseReason) {
-	logger.Log.Debugf("CloseByReason rs = %s", rs)
-	a.Close()
-}
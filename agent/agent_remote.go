@@ -83,6 +83,7 @@ func NewRemote(
 	if err != nil {
 		return nil, err
 	}
+	s.SetVersion(sess.GetVersion())
 	a.Session = s
 
 	return a, nil
@@ -214,6 +215,31 @@ func (a *Remote) sendPush(m pendingMessage, userID string, sv *cluster.Server) (
 	return a.rpcClient.SendPush(userID, sv, push)
 }
 
+// Request implementation for session.Requester interface
+// sends a request to the client of the user through its frontend server
+func (a *Remote) Request(ctx context.Context, route string, v interface{}) ([]byte, error) {
+	if a.Session.UID() == "" {
+		return nil, constants.ErrNoUIDBind
+	}
+	payload, err := util.SerializeOrRaw(a.serializer, v)
+	if err != nil {
+		return nil, err
+	}
+	b, err := proto.Marshal(&protos.Push{
+		Route: route,
+		Uid:   a.Session.UID(),
+		Data:  payload,
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.SendRequest(ctx, a.frontendID, constants.RequestClientRoute, b)
+	if err != nil {
+		return nil, err
+	}
+	return res.GetData(), nil
+}
+
 // SendRequest sends a request to a server
 func (a *Remote) SendRequest(ctx context.Context, serverID, reqRoute string, v interface{}) (*protos.Response, error) {
 	r, err := route.Decode(reqRoute)
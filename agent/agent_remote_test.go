@@ -28,6 +28,7 @@ import (
 	"testing"
 
 	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/tutumagi/pitaya/cluster"
@@ -181,6 +182,37 @@ func TestKickRemote(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestAgentRemoteRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rpcClient := clustermocks.NewMockRPCClient(ctrl)
+	ss := &protos.Session{Uid: uuid.New().String()}
+	mockSD := clustermocks.NewMockServiceDiscovery(ctrl)
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	frontID := uuid.New().String()
+	remote, err := NewRemote(ss, "", rpcClient, nil, mockSerializer, mockSD, frontID, nil)
+	assert.NoError(t, err)
+
+	push, err := proto.Marshal(&protos.Push{Route: "client.ask", Uid: ss.Uid, Data: []byte("question")})
+	assert.NoError(t, err)
+	mockSD.EXPECT().GetServer(frontID)
+	c := context.Background()
+	r, _ := route.Decode(constants.RequestClientRoute)
+	rpcClient.EXPECT().Call(c, protos.RPCType_User, r, gomock.Nil(), &message.Message{Route: constants.RequestClientRoute, Data: push}, gomock.Nil()).
+		Return(&protos.Response{Data: []byte("answer")}, nil)
+	data, err := remote.Request(c, "client.ask", []byte("question"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("answer"), data)
+}
+
+func TestAgentRemoteRequestWithoutUID(t *testing.T) {
+	remote, err := NewRemote(&protos.Session{}, "", nil, nil, nil, nil, "", nil)
+	assert.NoError(t, err)
+	_, err = remote.Request(context.Background(), "client.ask", nil)
+	assert.Equal(t, constants.ErrNoUIDBind, err)
+}
+
 func TestAgentRemoteResponseMID(t *testing.T) {
 	tables := []struct {
 		name         string
@@ -33,6 +33,7 @@ import (
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/clock"
 	codecmocks "github.com/tutumagi/pitaya/conn/codec/mocks"
 	"github.com/tutumagi/pitaya/conn/message"
 	messagemocks "github.com/tutumagi/pitaya/conn/message/mocks"
@@ -144,6 +145,64 @@ func TestKick(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestKickWithReason(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	mockSerializer.EXPECT().GetName()
+	ag := NewAgent(mockConn, nil, mockEncoder, mockSerializer, time.Second, 10, nil, message.NewMessagesEncoder(false), nil)
+	ag.SetSendKickReason(true)
+	ag.Session.SetCloseReason(session.CloseReasonDuplicateLogin)
+
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Kick), []byte(`{"reason":"duplicate_login"}`))
+	mockConn.EXPECT().Write(gomock.Any()).Return(0, nil)
+	err := ag.Kick(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestAgentCloseByReason(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	mockMetricsReporters := []metrics.Reporter{mockMetricsReporter}
+	mockMetricsReporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any()).AnyTimes()
+
+	messageEncoder := message.NewMessagesEncoder(false)
+	ag := NewAgent(mockConn, nil, mockEncoder, mockSerializer, time.Second, 0, nil, messageEncoder, mockMetricsReporters)
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage)
+	var reason session.CloseReason
+	err := ag.Session.OnClose(func() { reason = ag.Session.CloseReason() })
+	assert.NoError(t, err)
+
+	mockMetricsReporter.EXPECT().ReportCount(metrics.ClosedConnections, map[string]string{"reason": "heartbeat_timeout"}, float64(1))
+	mockConn.EXPECT().RemoteAddr()
+	mockConn.EXPECT().Close()
+	ag.CloseByReason(session.CloseReasonHeartbeatTimeout)
+	assert.Equal(t, session.CloseReasonHeartbeatTimeout, reason)
+
+	// the first reason is kept
+	ag.CloseByReason(session.CloseReasonClientDisconnect)
+	assert.Equal(t, session.CloseReasonHeartbeatTimeout, ag.Session.CloseReason())
+}
+
+func TestAgentCloseReasonAliases(t *testing.T) {
+	var reason AgentCloseReason = AgentCloseByHeartBeat
+	assert.Equal(t, session.CloseReasonHeartbeatTimeout, reason)
+	assert.Equal(t, session.CloseReasonClientDisconnect, AgentCloseByWriteEnd)
+	assert.Equal(t, session.CloseReasonClientDisconnect, AgentCloseByHandleEnd)
+	assert.Equal(t, session.CloseReasonUnknown, AgentCloseByMessageEnd)
+}
+
 func TestAgentSend(t *testing.T) {
 	tables := []struct {
 		name string
@@ -323,7 +382,7 @@ func TestAgentPushStruct(t *testing.T) {
 			expectedWrite := pendingWrite{ctx: nil, data: expectedBytes, err: nil}
 
 			if table.err != nil {
-				close(ag.chSend)
+				close(ag.chPush)
 			}
 
 			mockMetricsReporter.EXPECT().ReportGauge(metrics.ChannelCapacity, gomock.Any(), float64(10))
@@ -331,7 +390,7 @@ func TestAgentPushStruct(t *testing.T) {
 			assert.Equal(t, table.err, err)
 
 			if table.err == nil {
-				recvData := helpers.ShouldEventuallyReceive(t, ag.chSend).(pendingWrite)
+				recvData := helpers.ShouldEventuallyReceive(t, ag.chPush).(pendingWrite)
 				assert.Equal(t, expectedWrite, recvData)
 			}
 		})
@@ -380,7 +439,7 @@ func TestAgentPush(t *testing.T) {
 			expectedWrite := pendingWrite{ctx: nil, data: expectedBytes, err: nil}
 
 			if table.err != nil {
-				close(ag.chSend)
+				close(ag.chPush)
 			}
 
 			mockMetricsReporter.EXPECT().ReportGauge(metrics.ChannelCapacity, gomock.Any(), float64(10))
@@ -388,7 +447,7 @@ func TestAgentPush(t *testing.T) {
 			assert.Equal(t, table.err, err)
 
 			if table.err == nil {
-				recvData := helpers.ShouldEventuallyReceive(t, ag.chSend).(pendingWrite)
+				recvData := helpers.ShouldEventuallyReceive(t, ag.chPush).(pendingWrite)
 				assert.Equal(t, expectedWrite, recvData)
 			}
 		})
@@ -429,7 +488,7 @@ func TestAgentPushFullChannel(t *testing.T) {
 		err := ag.Push(msg.Route, []byte("data"))
 		assert.NoError(t, err)
 	}()
-	helpers.ShouldEventuallyReceive(t, ag.chSend)
+	helpers.ShouldEventuallyReceive(t, ag.chPush)
 }
 
 func TestAgentResponseMIDFailsIfClosedAgent(t *testing.T) {
@@ -617,6 +676,148 @@ func TestAgentClose(t *testing.T) {
 		true, 50*time.Millisecond, 500*time.Millisecond)
 }
 
+func TestAgentCloseRetainsSession(t *testing.T) {
+	session.SetResumeGracePeriod(time.Minute)
+	defer session.SetResumeGracePeriod(0)
+
+	tables := []struct {
+		name     string
+		reason   session.CloseReason
+		retained bool
+	}{
+		{"connection_lost", session.CloseReasonClientDisconnect, true},
+		{"heartbeat_timeout", session.CloseReasonHeartbeatTimeout, true},
+		{"closed", session.CloseReasonUnknown, false},
+		{"shutdown", session.CloseReasonServerShutdown, false},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+			heartbeatAndHandshakeMocks(mockEncoder)
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName()
+
+			messageEncoder := message.NewMessagesEncoder(false)
+			ag := NewAgent(mockConn, nil, mockEncoder, mockSerializer, time.Second, 0, nil, messageEncoder, nil)
+			ag.ChRoleMessages = make(chan UnhandledRoleMessage)
+			s := ag.GetSession()
+			s.IssueResumeToken()
+
+			// the session is retained before the agent is seen closing
+			detached := make(chan bool, 1)
+			go func() {
+				<-ag.ChDie()
+				detached <- s.Detached()
+			}()
+
+			mockConn.EXPECT().RemoteAddr()
+			mockConn.EXPECT().Close()
+			ag.CloseByReason(table.reason)
+			assert.Equal(t, table.retained, helpers.ShouldEventuallyReceive(t, detached))
+
+			if table.retained {
+				// expires the retained session
+				assert.NoError(t, s.Kick(context.Background()))
+			} else {
+				s.Close()
+			}
+		})
+	}
+}
+
+func TestAgentCloseSessionAfterResume(t *testing.T) {
+	session.SetResumeGracePeriod(time.Minute)
+	defer session.SetResumeGracePeriod(0)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName().Times(2)
+	messageEncoder := message.NewMessagesEncoder(false)
+
+	oldConn := mocks.NewMockPlayerConn(ctrl)
+	old := NewAgent(oldConn, nil, mockEncoder, mockSerializer, time.Second, 0, nil, messageEncoder, nil)
+	old.ChRoleMessages = make(chan UnhandledRoleMessage)
+	s := old.GetSession()
+	token := s.IssueResumeToken()
+	oldConn.EXPECT().RemoteAddr()
+	oldConn.EXPECT().Close()
+	old.CloseByReason(session.CloseReasonClientDisconnect)
+	assert.True(t, s.Detached())
+
+	newConn := mocks.NewMockPlayerConn(ctrl)
+	ag := NewAgent(newConn, nil, mockEncoder, mockSerializer, time.Second, 0, nil, messageEncoder, nil)
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage)
+	assert.NoError(t, ag.ResumeSession(token, 0))
+
+	// the message goroutine of the old agent exits after the resume
+	old.CloseSession()
+	assert.Equal(t, s, session.GetSessionByID(s.ID()))
+
+	newConn.EXPECT().RemoteAddr()
+	newConn.EXPECT().Close()
+	ag.CloseSession()
+	assert.Nil(t, session.GetSessionByID(s.ID()))
+}
+
+func TestAgentExecute(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	messageEncoder := message.NewMessagesEncoder(false)
+
+	ag := NewAgent(nil, nil, mockEncoder, mockSerializer, time.Second, 10, nil, messageEncoder, nil)
+	assert.NotNil(t, ag)
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage, 1)
+
+	called := false
+	err := ag.Execute(func() { called = true })
+	assert.NoError(t, err)
+
+	m := helpers.ShouldEventuallyReceive(t, ag.ChRoleMessages).(UnhandledRoleMessage)
+	assert.NotNil(t, m.Fn)
+	m.Fn()
+	assert.True(t, called)
+
+	ag.state = constants.StatusClosed
+	err = ag.Execute(func() {})
+	assert.Equal(t, e.NewError(constants.ErrBrokenPipe, e.ErrClientClosedRequest), err)
+}
+
+func TestAgentExecuteFullQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	messageEncoder := message.NewMessagesEncoder(false)
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	mockMetricsReporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any()).AnyTimes()
+
+	ag := NewAgent(nil, nil, mockEncoder, mockSerializer, time.Second, 10, nil, messageEncoder, []metrics.Reporter{mockMetricsReporter})
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage)
+	// the timers must not wait for room in the queue
+	ag.SetOverflowPolicy(OverflowBlock, 0)
+
+	mockMetricsReporter.EXPECT().ReportCount(metrics.RoleMessagesDropped, map[string]string{"policy": "dropnewest"}, float64(1))
+	err := ag.Execute(func() {})
+	assert.Equal(t, constants.ErrRoleMessagesOverflow, err)
+}
+
 func TestAgentRemoteAddr(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -866,6 +1067,44 @@ func TestAgentHeartbeat(t *testing.T) {
 	helpers.ShouldEventuallyReturn(t, func() bool { return die }, true, 500*time.Millisecond, 5*time.Second)
 }
 
+func TestAgentHeartbeatWithManualClock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Handshake), gomock.Any()).AnyTimes()
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Heartbeat), gomock.Any()).Return([]byte("hb"), nil).AnyTimes()
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	mockMessageEncoder := messagemocks.NewMockEncoder(ctrl)
+	mockMessageEncoder.EXPECT().IsCompressionEnabled().AnyTimes()
+	mockSerializer.EXPECT().GetName().AnyTimes()
+	c := clock.NewManual(time.Now())
+	ag := NewAgent(mockConn, nil, mockEncoder, mockSerializer, 1*time.Second, 1, nil, mockMessageEncoder, nil, c)
+	assert.NotNil(t, ag)
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage, 1)
+
+	mockConn.EXPECT().RemoteAddr().MaxTimes(1)
+	mockConn.EXPECT().Close().MaxTimes(1)
+
+	go ag.heartbeat()
+
+	// the client keeps answering, so only heartbeats are sent
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		ag.SetLastAt()
+		c.Advance(time.Second)
+		return len(ag.chSend) > 0
+	}, true, 10*time.Millisecond, time.Second)
+	pWrite := helpers.ShouldEventuallyReceive(t, ag.chSend).(pendingWrite)
+	assert.Equal(t, pendingWrite{data: []byte("hb")}, pWrite)
+
+	// no answer for longer than twice the heartbeat time closes the agent
+	c.Advance(3 * time.Second)
+	helpers.ShouldEventuallyReturn(t, func() int32 {
+		return ag.GetStatus()
+	}, constants.StatusClosed)
+}
+
 func TestAgentHeartbeatExitsIfConnError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1028,8 +1267,8 @@ func TestNatsRPCServerReportMetrics(t *testing.T) {
 
 	ag.chSend <- pendingWrite{}
 
-	mockMetricsReporter.EXPECT().ReportGauge(metrics.ChannelCapacity, gomock.Any(), float64(-1)) // because buffersize is 0 and chan sz is 1
-	ag.reportChannelSize()
+	mockMetricsReporter.EXPECT().ReportGauge(metrics.ChannelCapacity, map[string]string{"channel": "agent_chsend"}, float64(-1)) // because buffersize is 0 and chan sz is 1
+	ag.reportChannelSize(ag.chSend, "agent_chsend")
 }
 
 type customMockAddr struct{ network, str string }
@@ -0,0 +1,108 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"time"
+
+	"github.com/tutumagi/pitaya/metrics"
+	"github.com/tutumagi/pitaya/session"
+	"github.com/tutumagi/pitaya/tracing"
+)
+
+// SetCoalescing makes the agent join the queued packets in a single write
+// of up to size bytes, waiting up to interval for more packets before
+// writing. A zero size writes every packet on its own, a zero interval only
+// joins the packets that are already queued.
+func (a *Agent) SetCoalescing(size int, interval time.Duration) {
+	a.coalesceSize = size
+	a.coalesceInterval = interval
+}
+
+// writeCoalesced writes first, together with the packets queued after it
+// when coalescing is enabled, and finishes the spans of the written packets
+func (a *Agent) writeCoalesced(first pendingWrite) (session.CloseReason, error) {
+	if sc, ok := a.streamConn(first); ok {
+		return a.writeStream(sc, first)
+	}
+	if a.coalesceSize <= 0 {
+		reason, err := a.writeData(first.data)
+		a.finishWrite(first, err)
+		return reason, err
+	}
+
+	a.batch = append(a.batch[:0], first)
+	a.buffer = append(a.buffer[:0], first.data...)
+	reason, err := a.coalesce()
+	if err == nil {
+		reason, err = a.writeData(a.buffer)
+	}
+	for i, pWrite := range a.batch {
+		a.finishWrite(pWrite, err)
+		a.batch[i] = pendingWrite{}
+	}
+	return reason, err
+}
+
+// coalesce appends queued packets to the buffer until it holds at least
+// coalesceSize bytes, the queues are empty for coalesceInterval or the
+// agent stops writing. Packets of other streams are written right away,
+// it returns the reason to close the agent for if one of them fails.
+func (a *Agent) coalesce() (session.CloseReason, error) {
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for len(a.buffer) < a.coalesceSize {
+		pWrite, ok := a.pollWrite()
+		if !ok {
+			if a.coalesceInterval <= 0 {
+				break
+			}
+			if timer == nil {
+				timer = time.NewTimer(a.coalesceInterval)
+			}
+			if pWrite, ok = a.waitWrite(timer.C); !ok {
+				break
+			}
+		}
+		if sc, ok := a.streamConn(pWrite); ok {
+			if reason, err := a.writeStream(sc, pWrite); err != nil {
+				return reason, err
+			}
+			continue
+		}
+		a.batch = append(a.batch, pWrite)
+		a.buffer = append(a.buffer, pWrite.data...)
+	}
+	return session.CloseReasonUnknown, nil
+}
+
+func (a *Agent) finishWrite(pWrite pendingWrite, err error) {
+	tracing.FinishSpan(pWrite.ctx, err)
+	if err == nil {
+		err = pWrite.err
+	}
+	metrics.ReportTimingFromCtx(pWrite.ctx, a.metricsReporters, handlerType, err)
+}
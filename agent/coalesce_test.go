@@ -0,0 +1,188 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/helpers"
+	"github.com/tutumagi/pitaya/mocks"
+	"github.com/tutumagi/pitaya/session"
+)
+
+func newWritingAgent(conn *mocks.MockPlayerConn, size int, interval time.Duration) *Agent {
+	a := &Agent{
+		conn:        conn,
+		chSend:      make(chan pendingWrite, 10),
+		chHbSend:    make(chan pendingWrite, 10),
+		chStopWrite: make(chan struct{}),
+	}
+	a.SetCoalescing(size, interval)
+	return a
+}
+
+func TestWriteCoalescedDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	a := newWritingAgent(mockConn, 0, 0)
+	a.chSend <- pendingWrite{data: []byte("b")}
+
+	mockConn.EXPECT().Write([]byte("a")).Return(1, nil)
+	reason, err := a.writeCoalesced(pendingWrite{data: []byte("a")})
+	assert.NoError(t, err)
+	assert.Equal(t, session.CloseReasonUnknown, reason)
+	assert.Len(t, a.chSend, 1)
+}
+
+func TestWriteCoalesced(t *testing.T) {
+	tables := []struct {
+		name   string
+		size   int
+		queued []string
+		data   string
+		left   int
+	}{
+		{"joins_queued_packets", 10, []string{"bb", "cc"}, "aabbcc", 0},
+		{"stops_at_size", 4, []string{"bb", "cc"}, "aabb", 1},
+		{"nothing_queued", 10, nil, "aa", 0},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			a := newWritingAgent(mockConn, table.size, 0)
+			for _, data := range table.queued {
+				a.chSend <- pendingWrite{data: []byte(data)}
+			}
+
+			mockConn.EXPECT().Write([]byte(table.data)).Return(len(table.data), nil)
+			_, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+			assert.NoError(t, err)
+			assert.Len(t, a.chSend, table.left)
+		})
+	}
+}
+
+func TestWriteCoalescedHeartbeats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	a := newWritingAgent(mockConn, 10, 0)
+	a.chHbSend <- pendingWrite{data: []byte("hb")}
+
+	mockConn.EXPECT().Write([]byte("aahb")).Return(4, nil)
+	_, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+	assert.NoError(t, err)
+}
+
+func TestWriteCoalescedHeartbeatClosed(t *testing.T) {
+	tables := []struct {
+		name     string
+		interval time.Duration
+	}{
+		{"no_interval", 0},
+		{"interval", 10 * time.Millisecond},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			a := newWritingAgent(mockConn, 10, table.interval)
+			close(a.chHbSend)
+			a.chSend <- pendingWrite{data: []byte("bb")}
+
+			mockConn.EXPECT().Write([]byte("aabb")).Return(4, nil)
+			done := make(chan error, 1)
+			go func() {
+				_, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+				done <- err
+			}()
+			helpers.ShouldEventuallyReceive(t, done)
+			assert.Nil(t, a.chHbSend)
+		})
+	}
+}
+
+func TestWaitWriteStopped(t *testing.T) {
+	a := newWritingAgent(nil, 0, 0)
+	a.chSend <- pendingWrite{data: []byte("aa")}
+	close(a.chStopWrite)
+
+	_, ok := a.waitWrite(nil)
+	assert.False(t, ok)
+}
+
+func TestWriteCoalescedWaitsForInterval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	a := newWritingAgent(mockConn, 4, time.Second)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.chSend <- pendingWrite{data: []byte("bb")}
+	}()
+
+	// the write holds 4 bytes once the second packet arrives
+	mockConn.EXPECT().Write([]byte("aabb")).Return(4, nil)
+	_, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+	assert.NoError(t, err)
+}
+
+func TestWriteCoalescedIntervalExpires(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	a := newWritingAgent(mockConn, 10, 10*time.Millisecond)
+
+	mockConn.EXPECT().Write([]byte("aa")).Return(2, nil)
+	_, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+	assert.NoError(t, err)
+}
+
+func TestWriteCoalescedFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	a := newWritingAgent(mockConn, 10, 0)
+	a.chSend <- pendingWrite{data: []byte("bb")}
+
+	writeErr := errors.New("broken pipe")
+	mockConn.EXPECT().Write([]byte("aabb")).Return(0, writeErr)
+	reason, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+	assert.Equal(t, writeErr, err)
+	assert.Equal(t, session.CloseReasonClientDisconnect, reason)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/metrics"
+)
+
+// HandleHeartbeat measures the round trip time of a heartbeat echoed by the
+// client, the echo carries the millisecond timestamp sent by the server.
+// Heartbeats without a timestamp, sent by clients that do not echo, are
+// ignored.
+func (a *Agent) HandleHeartbeat(data []byte) {
+	if len(data) != 8 {
+		return
+	}
+
+	sent := int64(binary.BigEndian.Uint64(data))
+	now := a.clock.Now().UnixNano() / int64(time.Millisecond)
+	if sent > now {
+		logger.Log.Debugf("heartbeat echo from the future, ts=%d, %s", sent, a.GetSession().DebugString())
+		return
+	}
+
+	rtt := time.Duration(now-sent) * time.Millisecond
+	a.GetSession().RecordRTT(rtt)
+	a.reportLatency(rtt, a.GetSession().Jitter())
+}
+
+func (a *Agent) reportLatency(rtt, jitter time.Duration) {
+	for _, r := range a.metricsReporters {
+		if err := r.ReportHistogram(metrics.HeartbeatRTT, map[string]string{}, float64(rtt/time.Millisecond)); err != nil {
+			logger.Log.Warnf("failed to report heartbeat rtt: %s", err.Error())
+		}
+		if err := r.ReportHistogram(metrics.HeartbeatJitter, map[string]string{}, float64(jitter/time.Millisecond)); err != nil {
+			logger.Log.Warnf("failed to report heartbeat jitter: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/clock"
+	codecmocks "github.com/tutumagi/pitaya/conn/codec/mocks"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/metrics"
+	metricsmocks "github.com/tutumagi/pitaya/metrics/mocks"
+	"github.com/tutumagi/pitaya/serialize/json"
+)
+
+func heartbeatEcho(ts time.Time) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(ts.UnixNano()/int64(time.Millisecond)))
+	return data
+}
+
+func TestAgentHandleHeartbeat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockReporter := metricsmocks.NewMockReporter(ctrl)
+	mockReporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any())
+	c := clock.NewManual(time.Unix(1000, 0))
+	ag := NewAgent(nil, nil, mockEncoder, json.NewSerializer(), time.Second, 1, nil, message.NewMessagesEncoder(false), []metrics.Reporter{mockReporter}, c)
+	assert.NotNil(t, ag)
+
+	sent := c.Now()
+	c.Advance(80 * time.Millisecond)
+	mockReporter.EXPECT().ReportHistogram(metrics.HeartbeatRTT, map[string]string{}, float64(80))
+	mockReporter.EXPECT().ReportHistogram(metrics.HeartbeatJitter, map[string]string{}, float64(0))
+	ag.HandleHeartbeat(heartbeatEcho(sent))
+	assert.Equal(t, 80*time.Millisecond, ag.Session.RTT())
+
+	sent = c.Now()
+	c.Advance(240 * time.Millisecond)
+	mockReporter.EXPECT().ReportHistogram(metrics.HeartbeatRTT, map[string]string{}, float64(240))
+	mockReporter.EXPECT().ReportHistogram(metrics.HeartbeatJitter, map[string]string{}, float64(10))
+	ag.HandleHeartbeat(heartbeatEcho(sent))
+	assert.Equal(t, 240*time.Millisecond, ag.Session.RTT())
+	assert.Equal(t, 100*time.Millisecond, ag.Session.SmoothedRTT())
+	assert.Equal(t, 10*time.Millisecond, ag.Session.Jitter())
+}
+
+func TestAgentHandleHeartbeatIgnoresInvalidEchoes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockReporter := metricsmocks.NewMockReporter(ctrl)
+	mockReporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any())
+	c := clock.NewManual(time.Unix(1000, 0))
+	ag := NewAgent(nil, nil, mockEncoder, json.NewSerializer(), time.Second, 1, nil, message.NewMessagesEncoder(false), []metrics.Reporter{mockReporter}, c)
+	assert.NotNil(t, ag)
+
+	// clients that do not echo send empty heartbeats
+	ag.HandleHeartbeat(nil)
+	ag.HandleHeartbeat([]byte{0x01, 0x02})
+	ag.HandleHeartbeat(heartbeatEcho(c.Now().Add(time.Second)))
+	assert.Equal(t, time.Duration(0), ag.Session.RTT())
+}
@@ -0,0 +1,239 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/errors"
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/metrics"
+	"github.com/tutumagi/pitaya/session"
+)
+
+// OverflowPolicy decides what happens to a message pushed to ChRoleMessages
+// when the queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits up to the overflow timeout for room in the queue
+	// and then drops the message, a zero timeout waits forever
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued message
+	OverflowDropOldest
+	// OverflowDropNewest drops the pushed message
+	OverflowDropNewest
+	// OverflowKick kicks the player
+	OverflowKick
+)
+
+// agents holds the open agents, for reporting the depth of their queues
+var agents sync.Map
+
+// ParseOverflowPolicy parses the policy names used in the config: block,
+// dropoldest, dropnewest and kick
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch strings.ToLower(name) {
+	case "block":
+		return OverflowBlock, nil
+	case "dropoldest":
+		return OverflowDropOldest, nil
+	case "dropnewest":
+		return OverflowDropNewest, nil
+	case "kick":
+		return OverflowKick, nil
+	default:
+		return OverflowBlock, fmt.Errorf("unknown overflow policy %q", name)
+	}
+}
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "dropoldest"
+	case OverflowDropNewest:
+		return "dropnewest"
+	case OverflowKick:
+		return "kick"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// SetOverflowPolicy sets what happens when ChRoleMessages is full
+func (a *Agent) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	a.overflowPolicy = policy
+	a.overflowTimeout = timeout
+}
+
+// PushRoleMessage enqueues a message to be processed in order with the
+// other messages of the agent, applying the overflow policy when the queue
+// is full. Dropped requests are answered with an error.
+func (a *Agent) PushRoleMessage(m UnhandledRoleMessage) (err error) {
+	defer func() {
+		// ChRoleMessages is closed with the agent
+		if e := recover(); e != nil {
+			err = errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+		}
+	}()
+	if a.GetStatus() == constants.StatusClosed {
+		return errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+	}
+
+	select {
+	case a.ChRoleMessages <- m:
+		return nil
+	default:
+	}
+
+	switch a.overflowPolicy {
+	case OverflowDropNewest:
+		a.drop(m)
+		return constants.ErrRoleMessagesOverflow
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case old, ok := <-a.ChRoleMessages:
+				if ok {
+					a.drop(old)
+				}
+			default:
+			}
+			select {
+			case a.ChRoleMessages <- m:
+				return nil
+			default:
+			}
+		}
+
+	case OverflowKick:
+		a.KickOverflowed(m.Ctx)
+		return constants.ErrRoleMessagesOverflow
+
+	default:
+		var timeout <-chan time.Time
+		if a.overflowTimeout > 0 {
+			t := time.NewTimer(a.overflowTimeout)
+			defer t.Stop()
+			timeout = t.C
+		}
+		select {
+		case a.ChRoleMessages <- m:
+			return nil
+		case <-a.chDie:
+			return errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+		case <-timeout:
+			a.drop(m)
+			return constants.ErrRoleMessagesOverflow
+		}
+	}
+}
+
+// KickOverflowed kicks the player because a message queue of the agent is
+// full, as the kick overflow policy does
+func (a *Agent) KickOverflowed(ctx context.Context) {
+	a.reportDropped(OverflowKick)
+	logger.Log.Warnf("kicking session with full message queue, %s", a.GetSession().DebugString())
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// kicked sessions can not be resumed
+	if err := a.GetSession().KickWithReason(ctx, session.CloseReasonOverflow); err != nil {
+		logger.Log.Errorf("failed to kick session: %s", err.Error())
+	}
+	a.CloseByReason(session.CloseReasonOverflow)
+}
+
+// DropRoleMessage discards a message that found a message queue full,
+// answering requests with an error, as the drop overflow policies do
+func (a *Agent) DropRoleMessage(m UnhandledRoleMessage) {
+	a.drop(m)
+}
+
+// drop discards a message, answering requests with an error
+func (a *Agent) drop(m UnhandledRoleMessage) {
+	a.reportDropped(a.overflowPolicy)
+
+	if m.Msg == nil {
+		logger.Log.Warnf("dropped function of full message queue, %s", a.GetSession().DebugString())
+		return
+	}
+	logger.Log.Warnf("dropped message of full queue, route=%s, %s", m.Msg.Route, a.GetSession().DebugString())
+	if m.Msg.Type == message.Request {
+		a.AnswerWithError(m.Ctx, m.Msg.ID, errors.NewError(constants.ErrRoleMessagesOverflow, errors.ErrTooManyRequestsCode))
+	}
+}
+
+func (a *Agent) reportDropped(policy OverflowPolicy) {
+	for _, r := range a.metricsReporters {
+		r.ReportCount(metrics.RoleMessagesDropped, map[string]string{"policy": policy.String()}, 1)
+	}
+}
+
+// Report sends periodic reports of the depth of the message queues of the
+// agents, the deepest queue and the sum of all queues
+func Report(reporters []metrics.Reporter, period time.Duration) {
+	defer func() {
+		logger.Log.Warnf("Go agent.Report exit")
+		if err := recover(); err != nil {
+			logger.Log.Warnf("Go agent.Report exit by err = %v", err)
+		}
+	}()
+	for {
+		time.Sleep(period)
+
+		max, total := queueDepths()
+		for _, r := range reporters {
+			reportQueueDepths(r, max, total)
+		}
+	}
+}
+
+func queueDepths() (max, total int) {
+	agents.Range(func(k, _ interface{}) bool {
+		depth := len(k.(*Agent).ChRoleMessages)
+		if depth > max {
+			max = depth
+		}
+		total += depth
+		return true
+	})
+	return max, total
+}
+
+func reportQueueDepths(r metrics.Reporter, max, total int) {
+	err := r.ReportGauge(metrics.RoleMessagesQueueDepth, map[string]string{"stat": "max"}, float64(max))
+	if err != nil {
+		logger.Log.Errorf("failed to report to %s: %q\n", metrics.RoleMessagesQueueDepth, err)
+	}
+	err = r.ReportGauge(metrics.RoleMessagesQueueDepth, map[string]string{"stat": "total"}, float64(total))
+	if err != nil {
+		logger.Log.Errorf("failed to report to %s: %q\n", metrics.RoleMessagesQueueDepth, err)
+	}
+}
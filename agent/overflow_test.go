@@ -0,0 +1,198 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package agent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	codecmocks "github.com/tutumagi/pitaya/conn/codec/mocks"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/conn/packet"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/helpers"
+	"github.com/tutumagi/pitaya/metrics"
+	metricsmocks "github.com/tutumagi/pitaya/metrics/mocks"
+	"github.com/tutumagi/pitaya/mocks"
+	serializemocks "github.com/tutumagi/pitaya/serialize/mocks"
+	"github.com/tutumagi/pitaya/session"
+)
+
+func TestParseOverflowPolicy(t *testing.T) {
+	tables := []struct {
+		name   string
+		policy OverflowPolicy
+		err    bool
+	}{
+		{"block", OverflowBlock, false},
+		{"dropoldest", OverflowDropOldest, false},
+		{"DropNewest", OverflowDropNewest, false},
+		{"kick", OverflowKick, false},
+		{"drop", OverflowBlock, true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			policy, err := ParseOverflowPolicy(table.name)
+			assert.Equal(t, table.policy, policy)
+			assert.Equal(t, table.err, err != nil)
+		})
+	}
+}
+
+func TestPushRoleMessageOverflow(t *testing.T) {
+	oldMsg := &message.Message{Type: message.Request, ID: 1, Route: "a.b.old"}
+	newMsg := &message.Message{Type: message.Request, ID: 2, Route: "a.b.new"}
+
+	tables := []struct {
+		policy   OverflowPolicy
+		err      error
+		answered bool
+		queued   *message.Message
+	}{
+		{OverflowBlock, constants.ErrRoleMessagesOverflow, true, oldMsg},
+		{OverflowDropNewest, constants.ErrRoleMessagesOverflow, true, oldMsg},
+		{OverflowDropOldest, nil, true, newMsg},
+	}
+
+	for _, table := range tables {
+		t.Run(table.policy.String(), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockSerializer := serializemocks.NewMockSerializer(ctrl)
+			mockSerializer.EXPECT().GetName()
+			mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+			heartbeatAndHandshakeMocks(mockEncoder)
+			mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+			mockMetricsReporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any())
+			messageEncoder := message.NewMessagesEncoder(false)
+
+			ag := NewAgent(nil, nil, mockEncoder, mockSerializer, time.Second, 1, nil, messageEncoder, []metrics.Reporter{mockMetricsReporter})
+			ag.ChRoleMessages = make(chan UnhandledRoleMessage, 1)
+			ag.SetOverflowPolicy(table.policy, 10*time.Millisecond)
+
+			assert.NoError(t, ag.PushRoleMessage(UnhandledRoleMessage{Msg: oldMsg}))
+
+			mockMetricsReporter.EXPECT().ReportCount(metrics.RoleMessagesDropped, map[string]string{"policy": table.policy.String()}, float64(1))
+			mockSerializer.EXPECT().Marshal(gomock.Any()).Return([]byte("err"), nil)
+			mockEncoder.EXPECT().Encode(packet.Type(packet.Data), gomock.Any())
+			mockMetricsReporter.EXPECT().ReportGauge(metrics.ChannelCapacity, gomock.Any(), gomock.Any())
+
+			err := ag.PushRoleMessage(UnhandledRoleMessage{Msg: newMsg})
+			assert.Equal(t, table.err, err)
+			assert.Len(t, ag.ChRoleMessages, 1)
+			m := <-ag.ChRoleMessages
+			assert.Equal(t, table.queued, m.Msg)
+			if table.answered {
+				helpers.ShouldEventuallyReceive(t, ag.chSend)
+			}
+		})
+	}
+}
+
+func TestPushRoleMessageBlockWaitsForRoom(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	messageEncoder := message.NewMessagesEncoder(false)
+
+	ag := NewAgent(nil, nil, mockEncoder, mockSerializer, time.Second, 1, nil, messageEncoder, nil)
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage, 1)
+	ag.SetOverflowPolicy(OverflowBlock, 0)
+
+	assert.NoError(t, ag.PushRoleMessage(UnhandledRoleMessage{Fn: func() {}}))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- ag.PushRoleMessage(UnhandledRoleMessage{Fn: func() {}})
+	}()
+	select {
+	case <-done:
+		t.Fatal("push should block while the queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	<-ag.ChRoleMessages
+	assert.Nil(t, helpers.ShouldEventuallyReceive(t, done))
+}
+
+func TestPushRoleMessageKick(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	messageEncoder := message.NewMessagesEncoder(false)
+
+	ag := NewAgent(mockConn, nil, mockEncoder, mockSerializer, time.Second, 1, nil, messageEncoder, nil)
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage, 1)
+	ag.SetOverflowPolicy(OverflowKick, 0)
+	assert.NoError(t, ag.PushRoleMessage(UnhandledRoleMessage{Fn: func() {}}))
+
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Kick), gomock.Nil()).Return([]byte("kick"), nil)
+	mockConn.EXPECT().Write([]byte("kick")).Return(4, nil)
+	mockConn.EXPECT().RemoteAddr()
+	mockConn.EXPECT().Close()
+
+	err := ag.PushRoleMessage(UnhandledRoleMessage{Fn: func() {}})
+	assert.Equal(t, constants.ErrRoleMessagesOverflow, err)
+	assert.Equal(t, constants.StatusClosed, ag.GetStatus())
+	assert.Equal(t, session.CloseReasonOverflow, ag.GetSession().CloseReason())
+	_, ok := agents.Load(ag)
+	assert.False(t, ok)
+}
+
+func TestReportQueueDepths(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	mockMetricsReporter.EXPECT().ReportGauge(metrics.RoleMessagesQueueDepth, map[string]string{"stat": "max"}, float64(3))
+	mockMetricsReporter.EXPECT().ReportGauge(metrics.RoleMessagesQueueDepth, map[string]string{"stat": "total"}, float64(5)).Return(errors.New("err"))
+	reportQueueDepths(mockMetricsReporter, 3, 5)
+}
+
+func TestQueueDepths(t *testing.T) {
+	a1 := &Agent{ChRoleMessages: make(chan UnhandledRoleMessage, 5)}
+	a2 := &Agent{ChRoleMessages: make(chan UnhandledRoleMessage, 5)}
+	a1.ChRoleMessages <- UnhandledRoleMessage{}
+	for i := 0; i < 3; i++ {
+		a2.ChRoleMessages <- UnhandledRoleMessage{}
+	}
+	agents.Store(a1, struct{}{})
+	agents.Store(a2, struct{}{})
+	defer agents.Delete(a1)
+	defer agents.Delete(a2)
+
+	max, total := queueDepths()
+	assert.True(t, max >= 3)
+	assert.True(t, total >= 4)
+}
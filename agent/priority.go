@@ -0,0 +1,236 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/metrics"
+)
+
+// PushPriority decides how the pushes of a route are queued
+type PushPriority int
+
+const (
+	// PushNormal queues the pushes behind the responses and critical pushes
+	PushNormal PushPriority = iota
+	// PushCritical queues the pushes with the responses, they are never
+	// dropped for slow consumers
+	PushCritical
+	// PushDroppable pushes are queued as normal pushes, but while the push
+	// queue is congested only the latest pending push of the route is kept
+	// and sent after every other queued message
+	PushDroppable
+)
+
+// congestionThreshold is the fraction of the push queue that must be full
+// for droppable pushes to be coalesced, unless the slow consumer threshold
+// is set
+const congestionThreshold = 0.8
+
+var (
+	// criticalRoutes are the routes of the PushCritical pushes
+	criticalRoutes = map[string]bool{}
+	// droppableRoutes are the routes of the PushDroppable pushes
+	droppableRoutes = map[string]bool{}
+)
+
+// SetCriticalRoutes sets the push routes queued with the responses and never
+// dropped for slow consumers, it must be called before the agents start
+func SetCriticalRoutes(routes ...string) {
+	criticalRoutes = routeSet(routes)
+}
+
+// SetDroppableRoutes sets the push routes of which only the latest pending
+// push is sent, e.g. position updates, it must be called before the agents
+// start
+func SetDroppableRoutes(routes ...string) {
+	droppableRoutes = routeSet(routes)
+}
+
+func routeSet(routes []string) map[string]bool {
+	set := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		set[route] = true
+	}
+	return set
+}
+
+// GetPushPriority returns the priority of the pushes of route
+func GetPushPriority(route string) PushPriority {
+	switch {
+	case criticalRoutes[route]:
+		return PushCritical
+	case droppableRoutes[route]:
+		return PushDroppable
+	default:
+		return PushNormal
+	}
+}
+
+func (p PushPriority) String() string {
+	switch p {
+	case PushNormal:
+		return "normal"
+	case PushCritical:
+		return "critical"
+	case PushDroppable:
+		return "droppable"
+	default:
+		return fmt.Sprintf("PushPriority(%d)", int(p))
+	}
+}
+
+// sendQueue returns the queue of m and its name, responses and critical
+// pushes go to chSend and normal pushes to chPush. Droppable pushes go to
+// chPush too, they have no queue while they are coalesced
+func (a *Agent) sendQueue(m pendingMessage) (chan pendingWrite, string) {
+	if m.typ != message.Push {
+		return a.chSend, "agent_chsend"
+	}
+	switch GetPushPriority(m.route) {
+	case PushCritical:
+		return a.chSend, "agent_chsend"
+	case PushDroppable:
+		if a.coalescing(m.route) {
+			return nil, ""
+		}
+		return a.chPush, "agent_chpush"
+	default:
+		return a.chPush, "agent_chpush"
+	}
+}
+
+// coalescing reports whether the pushes of the droppable route are
+// coalesced, while the push queue is congested or a push of the route is
+// still pending, so that the latest one is never sent before it
+func (a *Agent) coalescing(route string) bool {
+	a.droppableMutex.Lock()
+	_, pending := a.droppable[route]
+	a.droppableMutex.Unlock()
+	if pending {
+		return true
+	}
+	threshold := a.slowConsumerThreshold
+	if threshold <= 0 {
+		threshold = congestionThreshold
+	}
+	return float64(len(a.chPush)) >= threshold*float64(cap(a.chPush))
+}
+
+// setDroppable makes pWrite the pending push of route, replacing the
+// previous one if it was not written yet
+func (a *Agent) setDroppable(route string, pWrite pendingWrite) {
+	a.droppableMutex.Lock()
+	replaced, ok := a.droppable[route]
+	if !ok {
+		a.droppableRoutes = append(a.droppableRoutes, route)
+	}
+	a.droppable[route] = pWrite
+	a.droppableMutex.Unlock()
+
+	if ok {
+		a.finishWrite(replaced, constants.ErrPushReplaced)
+		for _, r := range a.metricsReporters {
+			r.ReportCount(metrics.ReplacedPushes, map[string]string{"route": route}, 1)
+		}
+	}
+
+	select {
+	case a.chDroppable <- struct{}{}:
+	default:
+	}
+}
+
+// popDroppable returns the oldest pending droppable push
+func (a *Agent) popDroppable() (pendingWrite, bool) {
+	a.droppableMutex.Lock()
+	defer a.droppableMutex.Unlock()
+
+	if len(a.droppableRoutes) == 0 {
+		return pendingWrite{}, false
+	}
+	route := a.droppableRoutes[0]
+	a.droppableRoutes = a.droppableRoutes[1:]
+	pWrite := a.droppable[route]
+	delete(a.droppable, route)
+	return pWrite, true
+}
+
+// pollWrite returns the next queued packet without waiting, heartbeats
+// first, then responses and critical pushes, then normal pushes and then
+// droppable pushes
+func (a *Agent) pollWrite() (pendingWrite, bool) {
+	select {
+	case pWrite, ok := <-a.chHbSend:
+		if ok {
+			return pWrite, true
+		}
+		// the heartbeat closed its queue, a nil channel is never ready
+		a.chHbSend = nil
+	default:
+	}
+	select {
+	case pWrite := <-a.chSend:
+		return pWrite, true
+	default:
+	}
+	select {
+	case pWrite := <-a.chPush:
+		return pWrite, true
+	default:
+	}
+	return a.popDroppable()
+}
+
+// waitWrite returns the next queued packet, waiting for one until timeout,
+// or forever if it is nil, or until the agent stops writing
+func (a *Agent) waitWrite(timeout <-chan time.Time) (pendingWrite, bool) {
+	for {
+		select {
+		case <-a.chStopWrite:
+			return pendingWrite{}, false
+		default:
+		}
+		if pWrite, ok := a.pollWrite(); ok {
+			return pWrite, true
+		}
+		select {
+		case pWrite, ok := <-a.chHbSend:
+			if ok {
+				return pWrite, true
+			}
+			a.chHbSend = nil
+		case pWrite := <-a.chSend:
+			return pWrite, true
+		case pWrite := <-a.chPush:
+			return pWrite, true
+		case <-a.chDroppable:
+		case <-timeout:
+			return pendingWrite{}, false
+		case <-a.chStopWrite:
+			return pendingWrite{}, false
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	codecmocks "github.com/tutumagi/pitaya/conn/codec/mocks"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/conn/packet"
+	"github.com/tutumagi/pitaya/helpers"
+	"github.com/tutumagi/pitaya/metrics"
+	metricsmocks "github.com/tutumagi/pitaya/metrics/mocks"
+	serializemocks "github.com/tutumagi/pitaya/serialize/mocks"
+)
+
+func setPushRoutes(critical, droppable []string) func() {
+	SetCriticalRoutes(critical...)
+	SetDroppableRoutes(droppable...)
+	return func() {
+		SetCriticalRoutes()
+		SetDroppableRoutes()
+	}
+}
+
+func TestGetPushPriority(t *testing.T) {
+	defer setPushRoutes([]string{"critical.route"}, []string{"droppable.route"})()
+
+	tables := []struct {
+		route    string
+		priority PushPriority
+	}{
+		{"critical.route", PushCritical},
+		{"droppable.route", PushDroppable},
+		{"some.route", PushNormal},
+	}
+
+	for _, table := range tables {
+		t.Run(table.route, func(t *testing.T) {
+			assert.Equal(t, table.priority, GetPushPriority(table.route))
+		})
+	}
+}
+
+func newPushPriorityAgent(ctrl *gomock.Controller, reporter *metricsmocks.MockReporter, pushes int) *Agent {
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Data), gomock.Any()).DoAndReturn(
+		func(_ packet.Type, data []byte) ([]byte, error) {
+			return data, nil
+		}).Times(pushes)
+	reporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any())
+	reporter.EXPECT().ReportGauge(metrics.ChannelCapacity, gomock.Any(), gomock.Any()).AnyTimes()
+	messageEncoder := message.NewMessagesEncoder(false)
+
+	return NewAgent(nil, nil, mockEncoder, mockSerializer, time.Second, 10, nil, messageEncoder, []metrics.Reporter{reporter})
+}
+
+// payloads returns the payloads of the messages queued in ch
+func payloads(t *testing.T, ch chan pendingWrite) []string {
+	var queued []string
+	for len(ch) > 0 {
+		m, err := message.Decode((<-ch).data)
+		assert.NoError(t, err)
+		queued = append(queued, string(m.Data))
+	}
+	return queued
+}
+
+func TestAgentPushPriorities(t *testing.T) {
+	defer setPushRoutes([]string{"critical.route"}, []string{"droppable.route"})()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	ag := newPushPriorityAgent(ctrl, mockMetricsReporter, 5)
+
+	assert.NoError(t, ag.Push("some.route", []byte("normal")))
+	assert.NoError(t, ag.Push("critical.route", []byte("critical")))
+	assert.NoError(t, ag.Push("droppable.route", []byte("first")))
+	assert.NoError(t, ag.Push("droppable.route", []byte("latest")))
+	assert.NoError(t, ag.Push("some.route", []byte("after")))
+
+	// droppable pushes keep their order while the queue is not congested
+	assert.Equal(t, []string{"critical"}, payloads(t, ag.chSend))
+	assert.Equal(t, []string{"normal", "first", "latest", "after"}, payloads(t, ag.chPush))
+	_, ok := ag.popDroppable()
+	assert.False(t, ok)
+}
+
+func TestAgentPushPrioritiesCongested(t *testing.T) {
+	defer setPushRoutes(nil, []string{"droppable.route"})()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	ag := newPushPriorityAgent(ctrl, mockMetricsReporter, 11)
+	mockMetricsReporter.EXPECT().ReportCount(metrics.ReplacedPushes, map[string]string{"route": "droppable.route"}, float64(1)).Times(2)
+
+	for i := 0; i < 8; i++ {
+		assert.NoError(t, ag.Push("some.route", []byte("normal")))
+	}
+	assert.NoError(t, ag.Push("droppable.route", []byte("first")))
+	assert.NoError(t, ag.Push("droppable.route", []byte("latest")))
+	<-ag.chPush
+	// still pending, so it is replaced rather than sent before the latest
+	assert.NoError(t, ag.Push("droppable.route", []byte("last")))
+
+	assert.Len(t, ag.chPush, 7)
+	pWrite, ok := ag.popDroppable()
+	assert.True(t, ok)
+	m, err := message.Decode(pWrite.data)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("last"), m.Data)
+	_, ok = ag.popDroppable()
+	assert.False(t, ok)
+}
+
+func TestSetDroppableFinishesReplacedSpans(t *testing.T) {
+	tracer := mocktracer.New()
+	span := tracer.StartSpan("push")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+	a := newPriorityAgent()
+	a.setDroppable("droppable.route", pendingWrite{ctx: ctx, data: []byte("first")})
+	assert.Empty(t, tracer.FinishedSpans())
+	a.setDroppable("droppable.route", pendingWrite{data: []byte("latest")})
+
+	finished := tracer.FinishedSpans()
+	if assert.Len(t, finished, 1) {
+		assert.Equal(t, true, finished[0].Tag("error"))
+	}
+}
+
+func newPriorityAgent() *Agent {
+	return &Agent{
+		chSend:      make(chan pendingWrite, 1),
+		chPush:      make(chan pendingWrite, 1),
+		chHbSend:    make(chan pendingWrite, 1),
+		chDroppable: make(chan struct{}, 1),
+		chStopWrite: make(chan struct{}),
+		droppable:   make(map[string]pendingWrite),
+	}
+}
+
+func TestPollWrite(t *testing.T) {
+	a := newPriorityAgent()
+	a.setDroppable("droppable.route", pendingWrite{data: []byte("droppable")})
+	a.chPush <- pendingWrite{data: []byte("push")}
+	a.chSend <- pendingWrite{data: []byte("response")}
+	a.chHbSend <- pendingWrite{data: []byte("heartbeat")}
+
+	for _, data := range []string{"heartbeat", "response", "push", "droppable"} {
+		pWrite, ok := a.pollWrite()
+		assert.True(t, ok)
+		assert.Equal(t, []byte(data), pWrite.data)
+	}
+	_, ok := a.pollWrite()
+	assert.False(t, ok)
+}
+
+func TestWaitWrite(t *testing.T) {
+	a := newPriorityAgent()
+
+	done := make(chan pendingWrite, 1)
+	go func() {
+		pWrite, _ := a.waitWrite(nil)
+		done <- pWrite
+	}()
+	a.setDroppable("droppable.route", pendingWrite{data: []byte("droppable")})
+	pWrite := helpers.ShouldEventuallyReceive(t, done).(pendingWrite)
+	assert.Equal(t, []byte("droppable"), pWrite.data)
+
+	timeout := make(chan time.Time, 1)
+	timeout <- time.Now()
+	_, ok := a.waitWrite(timeout)
+	assert.False(t, ok)
+
+	close(a.chStopWrite)
+	_, ok = a.waitWrite(nil)
+	assert.False(t, ok)
+}
@@ -0,0 +1,115 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/errors"
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/protos"
+	"github.com/tutumagi/pitaya/util"
+)
+
+// SetRequestTimeout sets how long Request waits for the response of the
+// client, zero waits until the context is done
+func (a *Agent) SetRequestTimeout(timeout time.Duration) {
+	a.requestTimeout = timeout
+}
+
+// Request implementation for session.Requester interface
+// sends a request to the client and waits for its response
+func (a *Agent) Request(ctx context.Context, route string, v interface{}) ([]byte, error) {
+	if a.GetStatus() == constants.StatusClosed {
+		return nil, errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// the ids of the requests to the client are not shared with the ids of
+	// the requests of the client
+	id := uint(atomic.AddUint64(&a.lastRequestID, 1))
+	ch := make(chan *message.Message, 1)
+	a.requestsMutex.Lock()
+	a.requests[id] = ch
+	a.requestsMutex.Unlock()
+	defer func() {
+		a.requestsMutex.Lock()
+		delete(a.requests, id)
+		a.requestsMutex.Unlock()
+	}()
+
+	err := a.send(pendingMessage{typ: message.ServerRequest, route: route, mid: id, payload: v})
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+	if a.requestTimeout > 0 {
+		t := time.NewTimer(a.requestTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case m := <-ch:
+		if m.Err {
+			return nil, util.GetErrorFromPayload(a.serializer, m.Data)
+		}
+		return m.Data, nil
+	case <-timeout:
+		return nil, constants.ErrClientRequestTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-a.chDie:
+		return nil, errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+	}
+}
+
+// HandleClientResponse hands a response of the client to the Request
+// waiting for it, responses to requests that are not waited for anymore are
+// dropped
+func (a *Agent) HandleClientResponse(m *message.Message) {
+	a.requestsMutex.Lock()
+	ch, ok := a.requests[m.ID]
+	delete(a.requests, m.ID)
+	a.requestsMutex.Unlock()
+
+	if !ok {
+		logger.Log.Debugf("dropped response of unknown request, ID=%d, %s", m.ID, a.GetSession().DebugString())
+		return
+	}
+	ch <- m
+}
+
+// SendRequest sends a request to the client, the agent is the frontend
+// server of the client so serverID is not used
+func (a *Agent) SendRequest(ctx context.Context, serverID, route string, v interface{}) (*protos.Response, error) {
+	data, err := a.Request(ctx, route, v)
+	if err != nil {
+		return nil, err
+	}
+	return &protos.Response{Data: data}, nil
+}
@@ -0,0 +1,146 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	codecmocks "github.com/tutumagi/pitaya/conn/codec/mocks"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/conn/packet"
+	"github.com/tutumagi/pitaya/constants"
+	e "github.com/tutumagi/pitaya/errors"
+	"github.com/tutumagi/pitaya/helpers"
+	"github.com/tutumagi/pitaya/serialize/json"
+)
+
+type requestResult struct {
+	data []byte
+	err  error
+}
+
+func newRequestAgent(t *testing.T, ctrl *gomock.Controller) (*Agent, *codecmocks.MockPacketEncoder) {
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	messageEncoder := message.NewMessagesEncoder(false)
+	ag := NewAgent(nil, nil, mockEncoder, json.NewSerializer(), time.Second, 1, nil, messageEncoder, nil)
+	assert.NotNil(t, ag)
+	return ag, mockEncoder
+}
+
+func request(ctx context.Context, ag *Agent) chan requestResult {
+	done := make(chan requestResult, 1)
+	go func() {
+		data, err := ag.Request(ctx, "client.ask", []byte("question"))
+		done <- requestResult{data, err}
+	}()
+	return done
+}
+
+func TestAgentRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ag, mockEncoder := newRequestAgent(t, ctrl)
+	expected, err := message.NewMessagesEncoder(false).Encode(&message.Message{
+		Type:  message.ServerRequest,
+		ID:    1,
+		Route: "client.ask",
+		Data:  []byte("question"),
+	})
+	assert.NoError(t, err)
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Data), expected).Return([]byte("request"), nil)
+
+	done := request(context.Background(), ag)
+	pWrite := helpers.ShouldEventuallyReceive(t, ag.chSend).(pendingWrite)
+	assert.Equal(t, []byte("request"), pWrite.data)
+
+	// responses to other requests are dropped
+	ag.HandleClientResponse(&message.Message{Type: message.ClientResponse, ID: 2, Data: []byte("other")})
+	ag.HandleClientResponse(&message.Message{Type: message.ClientResponse, ID: 1, Data: []byte("answer")})
+	res := helpers.ShouldEventuallyReceive(t, done).(requestResult)
+	assert.NoError(t, res.err)
+	assert.Equal(t, []byte("answer"), res.data)
+	assert.Empty(t, ag.requests)
+}
+
+func TestAgentRequestErrorResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ag, mockEncoder := newRequestAgent(t, ctrl)
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Data), gomock.Any())
+
+	done := request(context.Background(), ag)
+	helpers.ShouldEventuallyReceive(t, ag.chSend)
+	ag.HandleClientResponse(&message.Message{
+		Type: message.ClientResponse,
+		ID:   1,
+		Data: []byte(`{"code":"GAME-400","message":"no"}`),
+		Err:  true,
+	})
+	res := helpers.ShouldEventuallyReceive(t, done).(requestResult)
+	assert.Equal(t, &e.Error{Code: "GAME-400", Message: "no"}, res.err)
+}
+
+func TestAgentRequestTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ag, mockEncoder := newRequestAgent(t, ctrl)
+	ag.SetRequestTimeout(10 * time.Millisecond)
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Data), gomock.Any())
+
+	done := request(context.Background(), ag)
+	helpers.ShouldEventuallyReceive(t, ag.chSend)
+	res := helpers.ShouldEventuallyReceive(t, done).(requestResult)
+	assert.Equal(t, constants.ErrClientRequestTimeout, res.err)
+	assert.Empty(t, ag.requests)
+}
+
+func TestAgentRequestContextDone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ag, mockEncoder := newRequestAgent(t, ctrl)
+	mockEncoder.EXPECT().Encode(packet.Type(packet.Data), gomock.Any())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := request(ctx, ag)
+	helpers.ShouldEventuallyReceive(t, ag.chSend)
+	cancel()
+	res := helpers.ShouldEventuallyReceive(t, done).(requestResult)
+	assert.Equal(t, context.Canceled, res.err)
+}
+
+func TestAgentRequestClosedAgent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ag, _ := newRequestAgent(t, ctrl)
+	ag.SetStatus(constants.StatusClosed)
+	_, err := ag.Request(context.Background(), "client.ask", nil)
+	assert.Equal(t, e.NewError(constants.ErrBrokenPipe, e.ErrClientClosedRequest), err)
+}
@@ -0,0 +1,158 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/errors"
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/metrics"
+	"github.com/tutumagi/pitaya/session"
+)
+
+// SlowConsumerPolicy decides what happens to the messages sent to a client
+// that reads them slower than they are sent
+type SlowConsumerPolicy int
+
+const (
+	// SlowConsumerIgnore keeps queueing the messages, blocking the senders
+	// while the send queue is full
+	SlowConsumerIgnore SlowConsumerPolicy = iota
+	// SlowConsumerDropPushes drops the pushes of routes that are not
+	// critical while the client is slow, responses are always sent
+	SlowConsumerDropPushes
+	// SlowConsumerDisconnect closes the connection of the client
+	SlowConsumerDisconnect
+)
+
+// ParseSlowConsumerPolicy parses the policy names used in the config:
+// ignore, droppushes and disconnect
+func ParseSlowConsumerPolicy(name string) (SlowConsumerPolicy, error) {
+	switch strings.ToLower(name) {
+	case "ignore":
+		return SlowConsumerIgnore, nil
+	case "droppushes":
+		return SlowConsumerDropPushes, nil
+	case "disconnect":
+		return SlowConsumerDisconnect, nil
+	default:
+		return SlowConsumerIgnore, fmt.Errorf("unknown slow consumer policy %q", name)
+	}
+}
+
+func (p SlowConsumerPolicy) String() string {
+	switch p {
+	case SlowConsumerIgnore:
+		return "ignore"
+	case SlowConsumerDropPushes:
+		return "droppushes"
+	case SlowConsumerDisconnect:
+		return "disconnect"
+	default:
+		return fmt.Sprintf("SlowConsumerPolicy(%d)", int(p))
+	}
+}
+
+// SetWriteTimeout sets how long a write to the connection may block before
+// the client is disconnected as a slow consumer, zero waits forever
+func (a *Agent) SetWriteTimeout(timeout time.Duration) {
+	a.writeTimeout = timeout
+}
+
+// SetSlowConsumerPolicy sets what happens when the send queue stays at least
+// threshold full, as a fraction of its size, for window
+func (a *Agent) SetSlowConsumerPolicy(policy SlowConsumerPolicy, threshold float64, window time.Duration) {
+	a.slowConsumerPolicy = policy
+	a.slowConsumerThreshold = threshold
+	a.slowConsumerWindow = window
+}
+
+// slowConsumer reports whether the fuller of the send queues stayed above
+// the threshold for the whole window
+func (a *Agent) slowConsumer() bool {
+	if a.slowConsumerPolicy == SlowConsumerIgnore || a.messagesBufferSize == 0 {
+		return false
+	}
+	queued := len(a.chSend)
+	if len(a.chPush) > queued {
+		queued = len(a.chPush)
+	}
+	if float64(queued) < a.slowConsumerThreshold*float64(a.messagesBufferSize) {
+		atomic.StoreInt64(&a.slowSince, 0)
+		return false
+	}
+	now := a.clock.Now().UnixNano()
+	atomic.CompareAndSwapInt64(&a.slowSince, 0, now)
+	return time.Duration(now-atomic.LoadInt64(&a.slowSince)) >= a.slowConsumerWindow
+}
+
+// applySlowConsumerPolicy returns an error if m must not be sent because
+// the client is a slow consumer
+func (a *Agent) applySlowConsumerPolicy(m pendingMessage) error {
+	if !a.slowConsumer() {
+		return nil
+	}
+	switch a.slowConsumerPolicy {
+	case SlowConsumerDropPushes:
+		if m.typ != message.Push || GetPushPriority(m.route) == PushCritical {
+			return nil
+		}
+		logger.Log.Warnf("dropped push of slow consumer, route=%s, %s", m.route, a.GetSession().DebugString())
+		for _, r := range a.metricsReporters {
+			r.ReportCount(metrics.SlowConsumerDrops, map[string]string{"route": m.route}, 1)
+		}
+		return constants.ErrSlowConsumer
+	case SlowConsumerDisconnect:
+		logger.Log.Warnf("disconnecting slow consumer, %s", a.GetSession().DebugString())
+		a.CloseByReason(session.CloseReasonSlowConsumer)
+		return errors.NewError(constants.ErrBrokenPipe, errors.ErrClientClosedRequest)
+	}
+	return nil
+}
+
+// writeData writes data to the connection within the write timeout, it
+// returns the reason to close the agent for if it fails
+func (a *Agent) writeData(data []byte) (session.CloseReason, error) {
+	return a.writeWithin(func() (int, error) { return a.conn.Write(data) })
+}
+
+// writeWithin calls write with the write timeout set on the connection
+func (a *Agent) writeWithin(write func() (int, error)) (session.CloseReason, error) {
+	if a.writeTimeout > 0 {
+		if err := a.conn.SetWriteDeadline(time.Now().Add(a.writeTimeout)); err != nil {
+			return session.CloseReasonClientDisconnect, err
+		}
+	}
+	if _, err := write(); err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return session.CloseReasonSlowConsumer, err
+		}
+		return session.CloseReasonClientDisconnect, err
+	}
+	return session.CloseReasonUnknown, nil
+}
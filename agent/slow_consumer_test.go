@@ -0,0 +1,172 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/clock"
+	codecmocks "github.com/tutumagi/pitaya/conn/codec/mocks"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/metrics"
+	metricsmocks "github.com/tutumagi/pitaya/metrics/mocks"
+	"github.com/tutumagi/pitaya/mocks"
+	serializemocks "github.com/tutumagi/pitaya/serialize/mocks"
+	"github.com/tutumagi/pitaya/session"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestParseSlowConsumerPolicy(t *testing.T) {
+	tables := []struct {
+		name   string
+		policy SlowConsumerPolicy
+		err    bool
+	}{
+		{"ignore", SlowConsumerIgnore, false},
+		{"DropPushes", SlowConsumerDropPushes, false},
+		{"disconnect", SlowConsumerDisconnect, false},
+		{"drop", SlowConsumerIgnore, true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			policy, err := ParseSlowConsumerPolicy(table.name)
+			assert.Equal(t, table.policy, policy)
+			assert.Equal(t, table.err, err != nil)
+			if !table.err {
+				assert.Equal(t, strings.ToLower(table.name), policy.String())
+			}
+		})
+	}
+}
+
+func TestSlowConsumerDropPushes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	mockMetricsReporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any())
+	messageEncoder := message.NewMessagesEncoder(false)
+	clk := clock.NewManual(time.Unix(1000, 0))
+
+	SetCriticalRoutes("critical.route")
+	defer SetCriticalRoutes()
+
+	ag := NewAgent(nil, nil, mockEncoder, mockSerializer, time.Second, 2, nil, messageEncoder, []metrics.Reporter{mockMetricsReporter}, clk)
+	ag.SetSlowConsumerPolicy(SlowConsumerDropPushes, 0.5, time.Second)
+	push := pendingMessage{typ: message.Push, route: "some.route"}
+
+	ag.chSend <- pendingWrite{}
+	assert.NoError(t, ag.applySlowConsumerPolicy(push))
+
+	// the queue must stay above the threshold for the whole window
+	clk.Advance(time.Second)
+	mockMetricsReporter.EXPECT().ReportCount(metrics.SlowConsumerDrops, map[string]string{"route": "some.route"}, float64(1))
+	assert.Equal(t, constants.ErrSlowConsumer, ag.applySlowConsumerPolicy(push))
+	assert.NoError(t, ag.applySlowConsumerPolicy(pendingMessage{typ: message.Push, route: "critical.route"}))
+	assert.NoError(t, ag.applySlowConsumerPolicy(pendingMessage{typ: message.Response, mid: 1}))
+
+	// draining the queue resets the window
+	<-ag.chSend
+	assert.NoError(t, ag.applySlowConsumerPolicy(push))
+	ag.chSend <- pendingWrite{}
+	assert.NoError(t, ag.applySlowConsumerPolicy(push))
+}
+
+func TestSlowConsumerDisconnect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+	mockEncoder := codecmocks.NewMockPacketEncoder(ctrl)
+	heartbeatAndHandshakeMocks(mockEncoder)
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	messageEncoder := message.NewMessagesEncoder(false)
+	clk := clock.NewManual(time.Unix(1000, 0))
+
+	ag := NewAgent(mockConn, nil, mockEncoder, mockSerializer, time.Second, 1, nil, messageEncoder, nil, clk)
+	ag.ChRoleMessages = make(chan UnhandledRoleMessage)
+	ag.SetSlowConsumerPolicy(SlowConsumerDisconnect, 1, 0)
+	ag.chSend <- pendingWrite{}
+
+	mockConn.EXPECT().RemoteAddr()
+	mockConn.EXPECT().Close()
+	err := ag.applySlowConsumerPolicy(pendingMessage{typ: message.Response, mid: 1})
+	assert.Error(t, err)
+	assert.Equal(t, constants.StatusClosed, ag.GetStatus())
+	assert.Equal(t, session.CloseReasonSlowConsumer, ag.Session.CloseReason())
+}
+
+func TestSlowConsumerIgnore(t *testing.T) {
+	ag := &Agent{chSend: make(chan pendingWrite, 1)}
+	ag.chSend <- pendingWrite{}
+	assert.NoError(t, ag.applySlowConsumerPolicy(pendingMessage{typ: message.Push, route: "some.route"}))
+}
+
+func TestAgentWriteData(t *testing.T) {
+	tables := []struct {
+		name    string
+		timeout time.Duration
+		err     error
+		reason  session.CloseReason
+	}{
+		{"success", 0, nil, session.CloseReasonUnknown},
+		{"success_with_deadline", time.Second, nil, session.CloseReasonUnknown},
+		{"timeout", time.Second, timeoutError{}, session.CloseReasonSlowConsumer},
+		{"failure", time.Second, errors.New("broken pipe"), session.CloseReasonClientDisconnect},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockConn := mocks.NewMockPlayerConn(ctrl)
+			ag := &Agent{conn: mockConn}
+			ag.SetWriteTimeout(table.timeout)
+
+			if table.timeout > 0 {
+				mockConn.EXPECT().SetWriteDeadline(gomock.Any())
+			}
+			mockConn.EXPECT().Write([]byte("data")).Return(4, table.err)
+
+			reason, err := ag.writeData([]byte("data"))
+			assert.Equal(t, table.err, err)
+			assert.Equal(t, table.reason, reason)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"github.com/tutumagi/pitaya/acceptor"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/session"
+)
+
+// routeStreams are the streams of the pushes not written on the main stream
+var routeStreams = map[string]int{}
+
+// SetRouteStream makes the pushes of routes be written on stream of the
+// connections with several streams, e.g. state updates that should not wait
+// behind the responses, stream 0 is the main stream. It must be called before
+// the agents start.
+func SetRouteStream(stream int, routes ...string) {
+	streams := make(map[string]int, len(routeStreams)+len(routes))
+	for route, s := range routeStreams {
+		streams[route] = s
+	}
+	for _, route := range routes {
+		if stream == 0 {
+			delete(streams, route)
+			continue
+		}
+		streams[route] = stream
+	}
+	routeStreams = streams
+}
+
+// GetRouteStream returns the stream of the pushes of route
+func GetRouteStream(route string) int {
+	return routeStreams[route]
+}
+
+// messageStream returns the stream m is written on, only pushes leave the
+// main stream
+func messageStream(m pendingMessage) int {
+	if m.typ != message.Push {
+		return 0
+	}
+	return GetRouteStream(m.route)
+}
+
+// streamConn returns the connection of the agent if pWrite must be written
+// on a stream other than the main one
+func (a *Agent) streamConn(pWrite pendingWrite) (acceptor.StreamConn, bool) {
+	if pWrite.stream == 0 {
+		return nil, false
+	}
+	sc, ok := a.conn.(acceptor.StreamConn)
+	return sc, ok
+}
+
+// writeStream writes pWrite on its stream within the write timeout and
+// finishes its span, it returns the reason to close the agent for if it fails
+func (a *Agent) writeStream(sc acceptor.StreamConn, pWrite pendingWrite) (session.CloseReason, error) {
+	reason, err := a.writeWithin(func() (int, error) {
+		return sc.WriteStream(pWrite.stream, pWrite.data)
+	})
+	a.finishWrite(pWrite, err)
+	return reason, err
+}
@@ -0,0 +1,113 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package agent
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/mocks"
+	"github.com/tutumagi/pitaya/session"
+)
+
+// streamConn is a PlayerConn with several streams
+type streamConn struct {
+	*mocks.MockPlayerConn
+	written map[int][]string
+	err     error
+}
+
+func (c *streamConn) WriteStream(stream int, b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	c.written[stream] = append(c.written[stream], string(b))
+	return len(b), nil
+}
+
+func TestSetRouteStream(t *testing.T) {
+	defer func() { routeStreams = map[string]int{} }()
+
+	SetRouteStream(1, "room.state", "room.move")
+	SetRouteStream(2, "room.chat")
+	assert.Equal(t, 1, GetRouteStream("room.state"))
+	assert.Equal(t, 1, GetRouteStream("room.move"))
+	assert.Equal(t, 2, GetRouteStream("room.chat"))
+	assert.Equal(t, 0, GetRouteStream("room.join"))
+
+	SetRouteStream(0, "room.move")
+	assert.Equal(t, 0, GetRouteStream("room.move"))
+
+	// only pushes leave the main stream
+	assert.Equal(t, 1, messageStream(pendingMessage{typ: message.Push, route: "room.state"}))
+	assert.Equal(t, 0, messageStream(pendingMessage{typ: message.Response, route: "room.state"}))
+}
+
+func TestWriteCoalescedStreams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	conn := &streamConn{MockPlayerConn: mockConn, written: map[int][]string{}}
+	a := newWritingAgent(mockConn, 10, 0)
+	a.conn = conn
+	a.chSend <- pendingWrite{data: []byte("bb"), stream: 1}
+	a.chSend <- pendingWrite{data: []byte("cc")}
+
+	// packets of other streams are not joined with the main stream
+	mockConn.EXPECT().Write([]byte("aacc")).Return(4, nil)
+	_, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+	assert.NoError(t, err)
+
+	_, err = a.writeCoalesced(pendingWrite{data: []byte("dd"), stream: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"bb", "dd"}, conn.written[1])
+}
+
+func TestWriteCoalescedStreamFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	conn := &streamConn{MockPlayerConn: mockConn, err: errors.New("stream reset")}
+	a := newWritingAgent(mockConn, 10, 0)
+	a.conn = conn
+	a.chSend <- pendingWrite{data: []byte("bb"), stream: 1}
+
+	reason, err := a.writeCoalesced(pendingWrite{data: []byte("aa")})
+	assert.Equal(t, conn.err, err)
+	assert.Equal(t, session.CloseReasonClientDisconnect, reason)
+}
+
+func TestWriteStreamWithoutStreams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// connections with a single stream write everything on it
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	a := newWritingAgent(mockConn, 0, 0)
+	mockConn.EXPECT().Write([]byte("aa")).Return(2, nil)
+	_, err := a.writeCoalesced(pendingWrite{data: []byte("aa"), stream: 1})
+	assert.NoError(t, err)
+}
@@ -22,6 +22,8 @@ package pitaya
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"reflect"
@@ -34,6 +36,8 @@ import (
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/spf13/viper"
 	"github.com/tutumagi/pitaya/acceptor"
+	"github.com/tutumagi/pitaya/agent"
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/cluster"
 	"github.com/tutumagi/pitaya/component"
 	"github.com/tutumagi/pitaya/config"
@@ -72,10 +76,14 @@ const (
 // App is the base app struct
 type App struct {
 	acceptors        []acceptor.Acceptor
+	clock            clock.Clock
 	config           *config.Config
 	configured       bool
 	debug            bool
 	dieChan          chan bool
+	drainChan        chan bool
+	drainMessage     interface{}
+	drainRoute       string
 	heartbeat        time.Duration
 	onSessionBind    func(*session.Session)
 	messageEncoder   message.Encoder
@@ -100,7 +108,9 @@ var (
 		debug:            false,
 		startAt:          time.Now(),
 		dieChan:          make(chan bool),
+		drainChan:        make(chan bool),
 		acceptors:        []acceptor.Acceptor{},
+		clock:            clock.New(),
 		packetDecoder:    codec.NewPomeloPacketDecoder(),
 		packetEncoder:    codec.NewPomeloPacketEncoder(),
 		metricsReporters: make([]metrics.Reporter, 0),
@@ -140,6 +150,10 @@ func Configure(
 	app.serverMode = serverMode
 	app.server.Metadata = serverMetadata
 	app.messageEncoder = message.NewMessagesEncoder(app.config.GetBool("pitaya.handler.messages.compression"))
+	service.SetHandlerTimeout("", app.config.GetDuration("pitaya.handler.timeout"))
+	session.SetServerID(app.server.ID)
+	session.SetResumeGracePeriod(app.config.GetDuration("pitaya.session.resume.grace"))
+	session.SetResumeBacklog(app.config.GetInt("pitaya.session.resume.backlog"))
 	configureMetrics(serverType)
 	configureDefaultPipelines(app.config)
 	app.configured = true
@@ -221,6 +235,33 @@ func SetHeartbeatTime(interval time.Duration) {
 	app.heartbeat = interval
 }
 
+// SetHandlerTimeout sets the deadline of the requests of a route, applied
+// to the handler context and propagated through the RPCs it makes. Routes
+// are given as serverType.service.method or service.method, an empty route
+// sets the default of pitaya.handler.timeout. Zero removes the deadline.
+func SetHandlerTimeout(route string, timeout time.Duration) {
+	service.SetHandlerTimeout(route, timeout)
+}
+
+// SetSessionStore sets the store that keeps the data of bound sessions,
+// letting backends read and write it by uid instead of receiving it with
+// every request
+func SetSessionStore(store session.Store) {
+	session.SetStore(store)
+}
+
+// SetClock sets the clock used by timers, heartbeats, rate limiting and
+// groups, a clock.Manual allows advancing time in tests
+func SetClock(c clock.Clock) {
+	app.clock = c
+	timer.SetClock(c)
+}
+
+// GetClock returns the clock used by the app
+func GetClock() clock.Clock {
+	return app.clock
+}
+
 // SetLogger logger setter
 func SetLogger(l logger.Logger) {
 	logger.Log = l
@@ -334,12 +375,33 @@ func initSysRemotes() {
 func periodicMetrics() {
 	period := app.config.GetDuration("pitaya.metrics.periodicMetrics.period")
 	go metrics.ReportSysMetrics(app.metricsReporters, period)
+	go timer.Report(app.metricsReporters, period)
+	go agent.Report(app.metricsReporters, period)
 
 	if app.worker.Started() {
 		go worker.Report(app.metricsReporters, period)
 	}
 }
 
+// startDebugServer serves the introspection endpoints when enabled,
+// currently /debug/timers
+func startDebugServer() {
+	if !app.config.GetBool("pitaya.debug.http.enabled") {
+		return
+	}
+
+	port := app.config.GetInt("pitaya.debug.http.port")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/timers", timer.DebugHandler)
+
+	logger.Log.Infof("debug http server is enabled on port %d", port)
+	go func() {
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", port), mux); err != nil {
+			logger.Log.Errorf("debug http server stopped: %s", err.Error())
+		}
+	}()
+}
+
 // Start starts the app
 func Start() {
 	if !app.configured {
@@ -400,6 +462,8 @@ func Start() {
 			app.router,
 			app.messageEncoder,
 			app.server,
+			app.config.GetInt("pitaya.concurrency.remote.service"),
+			app.config.GetInt("pitaya.buffer.remote.mailbox"),
 		)
 
 		app.rpcServer.SetPitayaServer(remoteService)
@@ -420,9 +484,40 @@ func Start() {
 		remoteService,
 		app.messageEncoder,
 		app.metricsReporters,
+		app.clock,
+	)
+	overflowPolicy, err := agent.ParseOverflowPolicy(app.config.GetString("pitaya.buffer.agent.overflow.policy"))
+	if err != nil {
+		logger.Log.Fatalf("invalid agent overflow policy: %s", err.Error())
+	}
+	handlerService.SetOverflowPolicy(overflowPolicy, app.config.GetDuration("pitaya.buffer.agent.overflow.timeout"))
+	handlerService.SetSendKickReason(app.config.GetBool("pitaya.conn.kickreason"))
+	handlerService.SetWriteTimeout(app.config.GetDuration("pitaya.conn.writetimeout"))
+	handlerService.SetRequestTimeout(app.config.GetDuration("pitaya.conn.requesttimeout"))
+	handlerService.SetHandshakeTimeouts(
+		app.config.GetDuration("pitaya.conn.handshaketimeout"),
+		app.config.GetDuration("pitaya.conn.firstdatatimeout"),
+	)
+	handlerService.SetMaxConnectionsPerIP(app.config.GetInt("pitaya.conn.maxperip"))
+	handlerService.SetPooledRemoteRoutes(app.config.GetStringSlice("pitaya.handler.pooledremoteroutes")...)
+	handlerService.SetCoalescing(
+		app.config.GetInt("pitaya.conn.coalesce.size"),
+		app.config.GetDuration("pitaya.conn.coalesce.interval"),
 	)
+	slowConsumerPolicy, err := agent.ParseSlowConsumerPolicy(app.config.GetString("pitaya.conn.slowconsumer.policy"))
+	if err != nil {
+		logger.Log.Fatalf("invalid slow consumer policy: %s", err.Error())
+	}
+	handlerService.SetSlowConsumerPolicy(
+		slowConsumerPolicy,
+		app.config.GetFloat64("pitaya.conn.slowconsumer.threshold"),
+		app.config.GetDuration("pitaya.conn.slowconsumer.window"),
+	)
+	agent.SetCriticalRoutes(app.config.GetStringSlice("pitaya.conn.push.criticalroutes")...)
+	agent.SetDroppableRoutes(app.config.GetStringSlice("pitaya.conn.push.droppableroutes")...)
 
 	periodicMetrics()
+	startDebugServer()
 
 	listen()
 
@@ -438,9 +533,18 @@ func Start() {
 	select {
 	case <-app.dieChan:
 		logger.Log.Warn("the app will shutdown in a few seconds")
+	case <-app.drainChan:
+		drain(sg)
+		Shutdown()
 	case s := <-sg:
-		logger.Log.Warn("got signal: ", s, ", shutting down...")
-		close(app.dieChan)
+		if s == syscall.SIGTERM && app.config.GetDuration("pitaya.drain.timeout") > 0 {
+			logger.Log.Warn("got signal: ", s, ", draining...")
+			Drain()
+			drain(sg)
+		} else {
+			logger.Log.Warn("got signal: ", s, ", shutting down...")
+		}
+		Shutdown()
 	}
 
 	logger.Log.Warn("server is stopping...")
@@ -37,6 +37,7 @@ import (
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/tutumagi/pitaya/acceptor"
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/cluster"
 	"github.com/tutumagi/pitaya/conn/codec"
 	"github.com/tutumagi/pitaya/conn/message"
@@ -117,7 +118,9 @@ func initApp() {
 		debug:         false,
 		startAt:       time.Now(),
 		dieChan:       make(chan bool),
+		drainChan:     make(chan bool),
 		acceptors:     []acceptor.Acceptor{},
+		clock:         clock.New(),
 		packetDecoder: codec.NewPomeloPacketDecoder(),
 		packetEncoder: codec.NewPomeloPacketEncoder(),
 		serverMode:    Standalone,
@@ -165,6 +168,14 @@ func TestSetDebug(t *testing.T) {
 	assert.Equal(t, false, app.debug)
 }
 
+func TestSetClock(t *testing.T) {
+	c := clock.NewManual(time.Now())
+	SetClock(c)
+	defer SetClock(clock.New())
+	assert.Equal(t, c, GetClock())
+	assert.Equal(t, c.Now(), GetClock().Now())
+}
+
 func TestSetLogger(t *testing.T) {
 	l := logrus.New()
 	SetLogger(l)
@@ -0,0 +1,121 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package benchmark
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tutumagi/pitaya/agent"
+	"github.com/tutumagi/pitaya/conn/codec"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/serialize/json"
+)
+
+// countingConn counts the writes to a connection
+type countingConn struct {
+	net.Conn
+	writes int64
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt64(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+// pushAgent returns an agent connected through the loopback interface to a
+// client that discards everything it reads
+func pushAgent(b *testing.B) (*agent.Agent, *countingConn) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		io.Copy(ioutil.Discard, c)
+		c.Close()
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn := &countingConn{Conn: c}
+	a := agent.NewAgent(
+		conn,
+		codec.NewPomeloPacketDecoder(),
+		codec.NewPomeloPacketEncoder(),
+		json.NewSerializer(),
+		time.Minute,
+		100,
+		nil,
+		message.NewMessagesEncoder(false),
+		nil,
+		nil,
+	)
+	a.ChRoleMessages = make(chan agent.UnhandledRoleMessage)
+	return a, conn
+}
+
+func benchmarkPushes(b *testing.B, size int) {
+	l := logrus.New()
+	l.Level = logrus.FatalLevel
+	logger.SetLogger(l)
+
+	a, conn := pushAgent(b)
+	a.SetCoalescing(size, 0)
+	go a.Handle()
+	defer a.Close()
+
+	payload := []byte(`{"x":1,"y":2}`)
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	// many goroutines push to the same client, as broadcasts do
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := a.Push("room.move", payload); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	b.ReportMetric(float64(atomic.LoadInt64(&conn.writes))/float64(b.N), "writes/op")
+}
+
+func BenchmarkPushWithoutCoalescing(b *testing.B) {
+	benchmarkPushes(b, 0)
+}
+
+func BenchmarkPushWithCoalescing(b *testing.B) {
+	benchmarkPushes(b, 16*1024)
+}
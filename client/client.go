@@ -22,10 +22,12 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
 	"sync"
@@ -35,9 +37,11 @@ import (
 	"github.com/tutumagi/pitaya/acceptor"
 
 	"github.com/gorilla/websocket"
+	"github.com/quic-go/quic-go"
 	"github.com/sirupsen/logrus"
 	"github.com/tutumagi/pitaya"
 	"github.com/tutumagi/pitaya/conn/codec"
+	"github.com/tutumagi/pitaya/conn/kcp"
 	"github.com/tutumagi/pitaya/conn/message"
 	"github.com/tutumagi/pitaya/conn/packet"
 	"github.com/tutumagi/pitaya/logger"
@@ -151,7 +155,7 @@ func (c *Client) sendHandshakeRequest() error {
 
 func (c *Client) handleHandshakeResponse() error {
 	buf := bytes.NewBuffer(nil)
-	packets, err := c.readPackets(buf)
+	packets, err := c.readPackets(c.conn, buf)
 	if err != nil {
 		return err
 	}
@@ -258,6 +262,11 @@ func (c *Client) handlePackets() {
 					c.pendingReqMutex.Unlock()
 				}
 				c.IncomingMsgChan <- m
+			case packet.Heartbeat:
+				// echo the server timestamp so it can measure the round trip time
+				if len(p.Data) > 0 {
+					c.echoHeartbeat(p.Data)
+				}
 			case packet.Kick:
 				logger.Log.Warn("got kick packet from the server! disconnecting...")
 				c.Disconnect()
@@ -268,14 +277,14 @@ func (c *Client) handlePackets() {
 	}
 }
 
-func (c *Client) readPackets(buf *bytes.Buffer) ([]*packet.Packet, error) {
+func (c *Client) readPackets(r io.Reader, buf *bytes.Buffer) ([]*packet.Packet, error) {
 	// listen for sv messages
 	data := make([]byte, 1024)
 	n := len(data)
 	var err error
 
 	for n == len(data) {
-		n, err = c.conn.Read(data)
+		n, err = r.Read(data)
 		if err != nil {
 			return nil, err
 		}
@@ -298,7 +307,7 @@ func (c *Client) handleServerMessages() {
 	buf := bytes.NewBuffer(nil)
 	defer c.Disconnect()
 	for c.Connected {
-		packets, err := c.readPackets(buf)
+		packets, err := c.readPackets(c.conn, buf)
 		if err != nil && c.Connected {
 			logger.Log.Error(err)
 			break
@@ -331,6 +340,17 @@ func (c *Client) sendHeartbeats(interval int) {
 	}
 }
 
+func (c *Client) echoHeartbeat(data []byte) {
+	p, err := c.packetEncoder.Encode(packet.Heartbeat, data)
+	if err != nil {
+		logger.Log.Errorf("error encoding heartbeat echo: %s", err.Error())
+		return
+	}
+	if _, err := c.conn.Write(p); err != nil {
+		logger.Log.Errorf("error echoing heartbeat to server: %s", err.Error())
+	}
+}
+
 // Disconnect disconnects the client
 func (c *Client) Disconnect() {
 	if c.Connected {
@@ -396,6 +416,90 @@ func (c *Client) ConnectToWS(addr string, path string, tlsConfig ...*tls.Config)
 	return nil
 }
 
+// ConnectToKCP connects to the server at addr using the kcp protocol
+func (c *Client) ConnectToKCP(addr string) error {
+	conn, err := kcp.Dial(addr)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.IncomingMsgChan = make(chan *message.Message, 10)
+
+	if err = c.handleHandshake(); err != nil {
+		return err
+	}
+
+	c.closeChan = make(chan struct{})
+
+	return nil
+}
+
+// ConnectToQUIC connects to the server at addr using the quic protocol,
+// tlsConfig must trust the certificate of the server, e.g. skip its
+// verification for the self-signed certificates of tests. The packets the
+// server writes on other streams than the main one are read as well.
+func (c *Client) ConnectToQUIC(addr string, tlsConfig *tls.Config) error {
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if len(tlsConfig.NextProtos) == 0 {
+		tlsConfig.NextProtos = []string{acceptor.QUICNextProto}
+	}
+
+	conn, err := quic.DialAddr(context.Background(), addr, tlsConfig, nil)
+	if err != nil {
+		return err
+	}
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		conn.CloseWithError(0, "")
+		return err
+	}
+	c.conn = acceptor.NewQUICConn(conn, stream)
+	c.IncomingMsgChan = make(chan *message.Message, 10)
+
+	if err = c.handleHandshake(); err != nil {
+		return err
+	}
+
+	c.closeChan = make(chan struct{})
+	go c.acceptStreams(conn)
+
+	return nil
+}
+
+// acceptStreams reads the streams the server opens until conn is closed
+func (c *Client) acceptStreams(conn quic.Connection) {
+	for {
+		stream, err := conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+		go c.handleStream(stream)
+	}
+}
+
+// handleStream passes on the packets read from a stream other than the
+// main one
+func (c *Client) handleStream(stream io.Reader) {
+	buf := bytes.NewBuffer(nil)
+	for {
+		packets, err := c.readPackets(stream, buf)
+		if err != nil {
+			return
+		}
+
+		for _, p := range packets {
+			select {
+			case c.packetChan <- p:
+			case <-c.closeChan:
+				return
+			}
+		}
+	}
+}
+
 func (c *Client) handleHandshake() error {
 	if err := c.sendHandshakeRequest(); err != nil {
 		return err
@@ -418,6 +522,25 @@ func (c *Client) SendNotify(route string, data []byte) error {
 	return err
 }
 
+// SendResponse answers the request of the server with the given id, the
+// requests of the server are received as ServerRequest messages
+func (c *Client) SendResponse(id uint, data []byte, isError ...bool) error {
+	m := message.Message{
+		Type: message.ClientResponse,
+		ID:   id,
+		Data: data,
+	}
+	if len(isError) > 0 {
+		m.Err = isError[0]
+	}
+	p, err := c.buildPacket(m)
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.Write(p)
+	return err
+}
+
 func (c *Client) buildPacket(msg message.Message) ([]byte, error) {
 	encMsg, err := c.messageEncoder.Encode(&msg)
 	if err != nil {
@@ -1,13 +1,17 @@
 package client
 
 import (
+	"crypto/tls"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/acceptor"
+	"github.com/tutumagi/pitaya/conn/codec"
 	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/conn/packet"
 	"github.com/tutumagi/pitaya/helpers"
 	"github.com/tutumagi/pitaya/mocks"
 )
@@ -46,3 +50,141 @@ func TestSendRequestShouldTimeout(t *testing.T) {
 
 	assert.Equal(t, true, msg.Err)
 }
+
+func TestSendResponse(t *testing.T) {
+	c := New(logrus.InfoLevel)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	c.conn = mockConn
+
+	data := []byte{0x02, 0x03, 0x04}
+	pkt, err := c.buildPacket(message.Message{
+		Type: message.ClientResponse,
+		ID:   3,
+		Data: data,
+		Err:  true,
+	})
+	assert.NoError(t, err)
+
+	mockConn.EXPECT().Write(pkt)
+	assert.NoError(t, c.SendResponse(3, data, true))
+}
+
+func TestHandlePacketsEchoesHeartbeats(t *testing.T) {
+	c := New(logrus.InfoLevel)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := mocks.NewMockPlayerConn(ctrl)
+	c.conn = mockConn
+	c.closeChan = make(chan struct{})
+	go c.handlePackets()
+	defer close(c.closeChan)
+
+	ts := []byte{0, 0, 1, 0x75, 0x2b, 0x5e, 0x3c, 0x10}
+	echo, err := c.packetEncoder.Encode(packet.Heartbeat, ts)
+	assert.NoError(t, err)
+
+	written := make(chan bool, 1)
+	mockConn.EXPECT().Write(echo).Do(func(b []byte) { written <- true })
+
+	// heartbeats without a timestamp are not echoed
+	c.packetChan <- &packet.Packet{Type: packet.Heartbeat}
+	c.packetChan <- &packet.Packet{Type: packet.Heartbeat, Length: len(ts), Data: ts}
+	helpers.ShouldEventuallyReceive(t, written)
+}
+
+func TestConnectToKCP(t *testing.T) {
+	a := acceptor.NewKCPAcceptor("127.0.0.1:0")
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	c := New(logrus.InfoLevel)
+	connected := make(chan error, 1)
+	go func() {
+		connected <- c.ConnectToKCP(a.GetAddr())
+	}()
+
+	conn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.PlayerConn)
+	defer conn.Close()
+	decoder := codec.NewPomeloPacketDecoder()
+	msg, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	packets, err := decoder.Decode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.Type(packet.Handshake), packets[0].Type)
+
+	response, err := codec.NewPomeloPacketEncoder().Encode(packet.Handshake, []byte(`{"code":200,"sys":{"heartbeat":10}}`))
+	assert.NoError(t, err)
+	_, err = conn.Write(response)
+	assert.NoError(t, err)
+
+	msg, err = conn.GetNextMessage()
+	assert.NoError(t, err)
+	packets, err = decoder.Decode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.Type(packet.HandshakeAck), packets[0].Type)
+
+	assert.Nil(t, helpers.ShouldEventuallyReceive(t, connected, time.Second))
+	assert.True(t, c.ConnectedStatus())
+	c.Disconnect()
+}
+
+func TestConnectToQUIC(t *testing.T) {
+	a := acceptor.NewQUICAcceptor("127.0.0.1:0", "../acceptor/fixtures/server.crt", "../acceptor/fixtures/server.key")
+	go a.ListenAndServe()
+	defer a.Stop()
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		return a.GetAddr() != ""
+	}, true, 10*time.Millisecond, 100*time.Millisecond)
+
+	c := New(logrus.InfoLevel)
+	connected := make(chan error, 1)
+	go func() {
+		// the certificate of the fixtures is self-signed
+		connected <- c.ConnectToQUIC(a.GetAddr(), &tls.Config{InsecureSkipVerify: true})
+	}()
+
+	conn := helpers.ShouldEventuallyReceive(t, a.GetConnChan(), time.Second).(acceptor.StreamConn)
+	defer conn.Close()
+	decoder := codec.NewPomeloPacketDecoder()
+	encoder := codec.NewPomeloPacketEncoder()
+	msg, err := conn.GetNextMessage()
+	assert.NoError(t, err)
+	packets, err := decoder.Decode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.Type(packet.Handshake), packets[0].Type)
+
+	response, err := encoder.Encode(packet.Handshake, []byte(`{"code":200,"sys":{"heartbeat":10}}`))
+	assert.NoError(t, err)
+	_, err = conn.Write(response)
+	assert.NoError(t, err)
+
+	msg, err = conn.GetNextMessage()
+	assert.NoError(t, err)
+	packets, err = decoder.Decode(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, packet.Type(packet.HandshakeAck), packets[0].Type)
+
+	assert.Nil(t, helpers.ShouldEventuallyReceive(t, connected, time.Second))
+	assert.True(t, c.ConnectedStatus())
+
+	// pushes written on other streams are received as well
+	for stream, route := range []string{"room.join", "room.state"} {
+		data, err := message.NewMessagesEncoder(false).Encode(&message.Message{Type: message.Push, Route: route, Data: []byte("{}")})
+		assert.NoError(t, err)
+		push, err := encoder.Encode(packet.Data, data)
+		assert.NoError(t, err)
+		_, err = conn.WriteStream(stream, push)
+		assert.NoError(t, err)
+
+		m := helpers.ShouldEventuallyReceive(t, c.MsgChannel(), time.Second).(*message.Message)
+		assert.Equal(t, route, m.Route)
+	}
+	c.Disconnect()
+}
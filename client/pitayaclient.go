@@ -31,10 +31,13 @@ import (
 type PitayaClient interface {
 	ConnectTo(addr string, tlsConfig ...*tls.Config) error
 	ConnectToWS(addr string, path string, tlsConfig ...*tls.Config) error
+	ConnectToKCP(addr string) error
+	ConnectToQUIC(addr string, tlsConfig *tls.Config) error
 	ConnectedStatus() bool
 	Disconnect()
 	MsgChannel() chan *message.Message
 	SendNotify(route string, data []byte) error
 	SendRequest(route string, data []byte) (uint, error)
+	SendResponse(id uint, data []byte, isError ...bool) error
 	SetClientHandshakeData(data *session.HandshakeData)
 }
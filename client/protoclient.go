@@ -451,6 +451,34 @@ func (pc *ProtoClient) ConnectTo(addr string, tlsConfig ...*tls.Config) error {
 	return nil
 }
 
+// ConnectToKCP connects to the server at addr using the kcp protocol, the
+// commands information must be loaded with LoadInfo or LoadServerInfo first
+func (pc *ProtoClient) ConnectToKCP(addr string) error {
+	if !pc.ready {
+		return errors.New("protobuffer information not loaded")
+	}
+
+	if err := pc.Client.ConnectToKCP(addr); err != nil {
+		return err
+	}
+	go pc.waitForData()
+	return nil
+}
+
+// ConnectToQUIC connects to the server at addr using the quic protocol, the
+// commands information must be loaded with LoadInfo or LoadServerInfo first
+func (pc *ProtoClient) ConnectToQUIC(addr string, tlsConfig *tls.Config) error {
+	if !pc.ready {
+		return errors.New("protobuffer information not loaded")
+	}
+
+	if err := pc.Client.ConnectToQUIC(addr, tlsConfig); err != nil {
+		return err
+	}
+	go pc.waitForData()
+	return nil
+}
+
 // ExportInformation export supported server commands information
 func (pc *ProtoClient) ExportInformation() *ProtoBufferInfo {
 	if !pc.ready {
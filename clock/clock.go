@@ -0,0 +1,154 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+type (
+	// Clock provides the current time and tickers to time driven code, so
+	// it can be tested deterministically with a Manual clock
+	Clock interface {
+		Now() time.Time
+		NewTicker(d time.Duration) Ticker
+	}
+
+	// Ticker delivers ticks at intervals, like time.Ticker
+	Ticker interface {
+		C() <-chan time.Time
+		Stop()
+	}
+
+	realClock struct{}
+
+	realTicker struct {
+		*time.Ticker
+	}
+
+	// Manual is a Clock that only moves when told to, tickers created by
+	// it fire as the clock is advanced
+	Manual struct {
+		mu      sync.Mutex
+		now     time.Time
+		tickers map[*manualTicker]struct{}
+	}
+
+	manualTicker struct {
+		clock  *Manual
+		c      chan time.Time
+		period time.Duration
+		next   time.Time
+	}
+)
+
+// New returns a Clock backed by the time package
+func New() Clock {
+	return realClock{}
+}
+
+// Now returns the current local time
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTicker returns a new time.Ticker
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// C returns the channel on which the ticks are delivered
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// NewManual returns a Manual clock set to now
+func NewManual(now time.Time) *Manual {
+	return &Manual{
+		now:     now,
+		tickers: make(map[*manualTicker]struct{}),
+	}
+}
+
+// Now returns the time the clock is set to
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.now
+}
+
+// NewTicker returns a ticker that fires every d as the clock is advanced
+// The duration d must be greater than zero; if not, NewTicker will panic.
+func (m *Manual) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := &manualTicker{
+		clock:  m,
+		c:      make(chan time.Time, 1),
+		period: d,
+		next:   m.now.Add(d),
+	}
+	m.tickers[t] = struct{}{}
+	return t
+}
+
+// Advance moves the clock forward by d, firing due tickers
+func (m *Manual) Advance(d time.Duration) {
+	m.Set(m.Now().Add(d))
+}
+
+// Set moves the clock to now, firing due tickers. As with time.Ticker
+// ticks are dropped for slow receivers.
+func (m *Manual) Set(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.now = now
+	for t := range m.tickers {
+		for !t.next.After(now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// C returns the channel on which the ticks are delivered
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop turns off the ticker
+func (t *manualTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	delete(t.clock.tickers, t)
+}
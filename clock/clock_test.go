@@ -0,0 +1,93 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/helpers"
+)
+
+func TestRealClock(t *testing.T) {
+	t.Parallel()
+	c := New()
+	before := time.Now()
+	assert.False(t, c.Now().Before(before))
+
+	tk := c.NewTicker(time.Millisecond)
+	defer tk.Stop()
+	helpers.ShouldEventuallyReceive(t, tk.C())
+}
+
+func TestManualNow(t *testing.T) {
+	t.Parallel()
+	start := time.Unix(1000, 0)
+	c := NewManual(start)
+	assert.Equal(t, start, c.Now())
+
+	c.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), c.Now())
+
+	c.Set(start)
+	assert.Equal(t, start, c.Now())
+}
+
+func TestManualTicker(t *testing.T) {
+	t.Parallel()
+	start := time.Unix(1000, 0)
+	c := NewManual(start)
+	tk := c.NewTicker(time.Second)
+
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-tk.C():
+		t.Fatal("ticker fired before its period")
+	default:
+	}
+
+	c.Advance(time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-tk.C())
+
+	// ticks are dropped for slow receivers
+	c.Advance(5 * time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-tk.C())
+	select {
+	case <-tk.C():
+		t.Fatal("ticker should drop ticks")
+	default:
+	}
+
+	tk.Stop()
+	c.Advance(time.Hour)
+	select {
+	case <-tk.C():
+		t.Fatal("stopped ticker fired")
+	default:
+	}
+}
+
+func TestManualNewTickerPanicsOnNonPositive(t *testing.T) {
+	t.Parallel()
+	c := NewManual(time.Now())
+	assert.Panics(t, func() { c.NewTicker(0) })
+}
@@ -22,10 +22,12 @@ package cluster
 
 import (
 	"context"
+	"time"
 
 	"github.com/tutumagi/pitaya/conn/message"
 	"github.com/tutumagi/pitaya/constants"
 	pcontext "github.com/tutumagi/pitaya/context"
+	e "github.com/tutumagi/pitaya/errors"
 	"github.com/tutumagi/pitaya/interfaces"
 	"github.com/tutumagi/pitaya/logger"
 	"github.com/tutumagi/pitaya/protos"
@@ -51,6 +53,7 @@ type RPCClient interface {
 	SendPush(userID string, frontendSv *Server, push *protos.Push) error
 	SendKick(userID string, serverType string, kick *protos.KickMsg) error
 	BroadcastSessionBind(uid string) error
+	BroadcastRoleBind(roleID string) error
 	Call(ctx context.Context, rpcType protos.RPCType, route *route.Route, session *session.Session, msg *message.Message, server *Server) (*protos.Response, error)
 	// Post calls a method remotelly
 	Post(ctx context.Context, rpcType protos.RPCType, route *route.Route, session *session.Session, msg *message.Message, server *Server) error
@@ -68,6 +71,11 @@ type RemoteBindingListener interface {
 	OnUserBind(uid, fid string)
 }
 
+// RemoteRoleBindingListener listens to role bindings in remote servers
+type RemoteRoleBindingListener interface {
+	OnRoleBind(roleID, fid string)
+}
+
 // InfoRetriever gets cluster info
 // It can be implemented, for exemple, by reading
 // env var, config or by accessing the cluster API
@@ -91,8 +99,8 @@ func buildRequest(
 	session *session.Session,
 	msg *message.Message,
 	thisServer *Server,
-) (protos.Request, error) {
-	req := protos.Request{
+) (*protos.Request, error) {
+	req := &protos.Request{
 		Type: rpcType,
 		Msg: &protos.Msg{
 			Route: route.String(),
@@ -105,6 +113,13 @@ func buildRequest(
 	}
 	ctx = pcontext.AddToPropagateCtx(ctx, constants.PeerIDKey, thisServer.ID)
 	ctx = pcontext.AddToPropagateCtx(ctx, constants.PeerServiceKey, thisServer.Type)
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return req, e.NewError(constants.ErrRequestDeadlineExceeded, e.ErrDeadlineExceededCode)
+		}
+		ctx = pcontext.AddToPropagateCtx(ctx, constants.DeadlineKey, remaining.Nanoseconds())
+	}
 	req.Metadata, err = pcontext.Encode(ctx)
 	if err != nil {
 		return req, err
@@ -127,10 +142,16 @@ func buildRequest(
 		}
 		req.Msg.Id = uint64(mid)
 		req.Session = &protos.Session{
-			Id:     session.ID(),
-			Uid:    session.UID(),
-			Data:   session.GetDataEncoded(),
-			RoleID: session.RoleID(),
+			Id:      session.ID(),
+			Uid:     session.UID(),
+			RoleID:  session.RoleID(),
+			Version: session.Version(),
+		}
+		// backends read stored data from the session store
+		if session.Stored() {
+			session.FlushStored()
+		} else {
+			req.Session.Data = session.GetDataEncoded()
 		}
 	}
 
@@ -56,6 +56,7 @@ type etcdServiceDiscovery struct {
 	server                 *Server
 	stopChan               chan bool
 	stopLeaseChan          chan bool
+	deregister             sync.Once
 	lastSyncTime           time.Time
 	listeners              []SDListener
 	revokeTimeout          time.Duration
@@ -537,8 +538,18 @@ func (sd *etcdServiceDiscovery) SyncServers() error {
 
 // BeforeShutdown executes before shutting down and will remove the server from the list
 func (sd *etcdServiceDiscovery) BeforeShutdown() {
-	sd.revoke()
-	time.Sleep(sd.shutdownDelay) // Sleep for a short while to ensure shutdown has propagated
+	sd.Deregister()
+}
+
+// Deregister removes the server from the list, so the other servers stop
+// sending requests to it, it is safe to call it more than once
+func (sd *etcdServiceDiscovery) Deregister() error {
+	var err error
+	sd.deregister.Do(func() {
+		err = sd.revoke()
+		time.Sleep(sd.shutdownDelay) // Sleep for a short while to ensure shutdown has propagated
+	})
+	return err
 }
 
 // Shutdown executes on shutdown and will clean etcd
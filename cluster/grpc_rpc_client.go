@@ -134,7 +134,7 @@ func (gs *GRPCClient) Call(
 		defer metrics.ReportTimingFromCtx(ctxT, gs.metricsReporters, "rpc", err)
 	}
 
-	res, err := c.(*grpcClient).call(ctxT, &req)
+	res, err := c.(*grpcClient).call(ctxT, req)
 	if err != nil {
 		return nil, err
 	}
@@ -178,16 +178,42 @@ func (gs *GRPCClient) BroadcastSessionBind(uid string) error {
 	return nil
 }
 
-// SendKick sends a kick to an user
-func (gs *GRPCClient) SendKick(userID string, serverType string, kick *protos.KickMsg) error {
-	var svID string
-	var err error
-
+// BroadcastRoleBind sends the role binding information to other servers that may be interested in this info
+func (gs *GRPCClient) BroadcastRoleBind(roleID string) error {
 	if gs.bindingStorage == nil {
 		return constants.ErrNoBindingStorageModule
 	}
+	fid, _ := gs.bindingStorage.GetRoleFrontendID(roleID, gs.server.Type)
+	if fid != "" {
+		if c, ok := gs.clientMap.Load(fid); ok {
+			msg := &protos.BindMsg{
+				RoleID: roleID,
+				Fid:    gs.server.ID,
+			}
+			ctxT, done := context.WithTimeout(context.Background(), gs.reqTimeout)
+			defer done()
+			err := c.(*grpcClient).sessionBindRemote(ctxT, msg)
+			return err
+		}
+	}
+	return nil
+}
 
-	svID, err = gs.bindingStorage.GetUserFrontendID(userID, serverType)
+// frontendID gets the id of the frontend server a user, or a role if roleID
+// is set, is connected to
+func (gs *GRPCClient) frontendID(userID, roleID, serverType string) (string, error) {
+	if gs.bindingStorage == nil {
+		return "", constants.ErrNoBindingStorageModule
+	}
+	if roleID != "" {
+		return gs.bindingStorage.GetRoleFrontendID(roleID, serverType)
+	}
+	return gs.bindingStorage.GetUserFrontendID(userID, serverType)
+}
+
+// SendKick sends a kick to an user, or a role if the kick has a role id
+func (gs *GRPCClient) SendKick(userID string, serverType string, kick *protos.KickMsg) error {
+	svID, err := gs.frontendID(userID, kick.GetRoleID(), serverType)
 	if err != nil {
 		return err
 	}
@@ -201,7 +227,7 @@ func (gs *GRPCClient) SendKick(userID string, serverType string, kick *protos.Ki
 	return constants.ErrNoConnectionToServer
 }
 
-// SendPush sends a message to an user, if you dont know the serverID that the user is connected to, you need to set a BindingStorage when creating the client
+// SendPush sends a message to an user, or a role if the push has a role id, if you dont know the serverID that the user is connected to, you need to set a BindingStorage when creating the client
 // TODO: Jaeger?
 func (gs *GRPCClient) SendPush(userID string, frontendSv *Server, push *protos.Push) error {
 	var svID string
@@ -209,10 +235,7 @@ func (gs *GRPCClient) SendPush(userID string, frontendSv *Server, push *protos.P
 	if frontendSv.ID != "" {
 		svID = frontendSv.ID
 	} else {
-		if gs.bindingStorage == nil {
-			return constants.ErrNoBindingStorageModule
-		}
-		svID, err = gs.bindingStorage.GetUserFrontendID(userID, frontendSv.Type)
+		svID, err = gs.frontendID(userID, push.GetRoleID(), frontendSv.Type)
 		if err != nil {
 			return err
 		}
@@ -207,6 +207,20 @@ func (mr *MockRPCClientMockRecorder) BroadcastSessionBind(uid interface{}) *gomo
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BroadcastSessionBind", reflect.TypeOf((*MockRPCClient)(nil).BroadcastSessionBind), uid)
 }
 
+// BroadcastRoleBind mocks base method
+func (m *MockRPCClient) BroadcastRoleBind(roleID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BroadcastRoleBind", roleID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// BroadcastRoleBind indicates an expected call of BroadcastRoleBind
+func (mr *MockRPCClientMockRecorder) BroadcastRoleBind(roleID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BroadcastRoleBind", reflect.TypeOf((*MockRPCClient)(nil).BroadcastRoleBind), roleID)
+}
+
 // Call mocks base method
 func (m *MockRPCClient) Call(ctx context.Context, rpcType protos.RPCType, route *route.Route, session *session.Session, msg *message.Message, server *cluster.Server) (*protos.Response, error) {
 	m.ctrl.T.Helper()
@@ -370,6 +384,41 @@ func (mr *MockRemoteBindingListenerMockRecorder) OnUserBind(uid, fid interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnUserBind", reflect.TypeOf((*MockRemoteBindingListener)(nil).OnUserBind), uid, fid)
 }
 
+// MockRemoteRoleBindingListener is a mock of RemoteRoleBindingListener interface
+type MockRemoteRoleBindingListener struct {
+	ctrl     *gomock.Controller
+	recorder *MockRemoteRoleBindingListenerMockRecorder
+}
+
+// MockRemoteRoleBindingListenerMockRecorder is the mock recorder for MockRemoteRoleBindingListener
+type MockRemoteRoleBindingListenerMockRecorder struct {
+	mock *MockRemoteRoleBindingListener
+}
+
+// NewMockRemoteRoleBindingListener creates a new mock instance
+func NewMockRemoteRoleBindingListener(ctrl *gomock.Controller) *MockRemoteRoleBindingListener {
+	mock := &MockRemoteRoleBindingListener{ctrl: ctrl}
+	mock.recorder = &MockRemoteRoleBindingListenerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRemoteRoleBindingListener) EXPECT() *MockRemoteRoleBindingListenerMockRecorder {
+	return m.recorder
+}
+
+// OnRoleBind mocks base method
+func (m *MockRemoteRoleBindingListener) OnRoleBind(roleID, fid string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnRoleBind", roleID, fid)
+}
+
+// OnRoleBind indicates an expected call of OnRoleBind
+func (mr *MockRemoteRoleBindingListenerMockRecorder) OnRoleBind(roleID, fid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnRoleBind", reflect.TypeOf((*MockRemoteRoleBindingListener)(nil).OnRoleBind), roleID, fid)
+}
+
 // MockInfoRetriever is a mock of InfoRetriever interface
 type MockInfoRetriever struct {
 	ctrl     *gomock.Controller
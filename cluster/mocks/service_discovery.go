@@ -93,6 +93,18 @@ func (mr *MockServiceDiscoveryMockRecorder) AddListener(listener interface{}) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddListener", reflect.TypeOf((*MockServiceDiscovery)(nil).AddListener), listener)
 }
 
+// Deregister mocks base method
+func (m *MockServiceDiscovery) Deregister() error {
+	ret := m.ctrl.Call(m, "Deregister")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Deregister indicates an expected call of Deregister
+func (mr *MockServiceDiscoveryMockRecorder) Deregister() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Deregister", reflect.TypeOf((*MockServiceDiscovery)(nil).Deregister))
+}
+
 // Init mocks base method
 func (m *MockServiceDiscovery) Init() error {
 	ret := m.ctrl.Call(m, "Init")
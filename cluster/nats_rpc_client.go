@@ -103,6 +103,19 @@ func (ns *NatsRPCClient) BroadcastSessionBind(uid string) error {
 	return ns.Send(GetBindBroadcastTopic(ns.server.Type), msgData)
 }
 
+// BroadcastRoleBind sends the role binding information to other servers that may be interested in this info
+func (ns *NatsRPCClient) BroadcastRoleBind(roleID string) error {
+	msg := &protos.BindMsg{
+		RoleID: roleID,
+		Fid:    ns.server.ID,
+	}
+	msgData, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return ns.Send(GetBindBroadcastTopic(ns.server.Type), msgData)
+}
+
 // Send publishes a message in a given topic
 func (ns *NatsRPCClient) Send(topic string, data []byte) error {
 	if !ns.running {
@@ -111,9 +124,12 @@ func (ns *NatsRPCClient) Send(topic string, data []byte) error {
 	return ns.conn.Publish(topic, data)
 }
 
-// SendPush sends a message to a user
+// SendPush sends a message to a user, or to a role if the push has a role id
 func (ns *NatsRPCClient) SendPush(userID string, frontendSv *Server, push *protos.Push) error {
 	topic := GetUserMessagesTopic(userID, frontendSv.Type)
+	if push.GetRoleID() != "" {
+		topic = GetRoleMessagesTopic(push.GetRoleID(), frontendSv.Type)
+	}
 	msg, err := proto.Marshal(push)
 	if err != nil {
 		return err
@@ -121,9 +137,12 @@ func (ns *NatsRPCClient) SendPush(userID string, frontendSv *Server, push *proto
 	return ns.Send(topic, msg)
 }
 
-// SendKick kicks an user
+// SendKick kicks an user, or a role if the kick has a role id
 func (ns *NatsRPCClient) SendKick(userID string, serverType string, kick *protos.KickMsg) error {
 	topic := GetUserKickTopic(userID, serverType)
+	if kick.GetRoleID() != "" {
+		topic = GetRoleKickTopic(kick.GetRoleID(), serverType)
+	}
 	msg, err := proto.Marshal(kick)
 	if err != nil {
 		return err
@@ -161,7 +180,7 @@ func (ns *NatsRPCClient) Call(
 	if err != nil {
 		return nil, err
 	}
-	marshalledData, err := proto.Marshal(&req)
+	marshalledData, err := proto.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
@@ -177,7 +196,11 @@ func (ns *NatsRPCClient) Call(
 			metrics.ReportTimingFromCtx(ctx, ns.metricsReporters, typ, err)
 		}()
 	}
-	m, err = ns.conn.Request(getChannel(server.Type, server.ID), marshalledData, ns.reqTimeout)
+	timeout := ns.reqTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	m, err = ns.conn.Request(getChannel(server.Type, server.ID), marshalledData, timeout)
 	if err != nil {
 		return nil, err
 	}
@@ -233,7 +256,7 @@ func (ns *NatsRPCClient) Post(
 	if err != nil {
 		return err
 	}
-	marshalledData, err := proto.Marshal(&req)
+	marshalledData, err := proto.Marshal(req)
 	if err != nil {
 		return err
 	}
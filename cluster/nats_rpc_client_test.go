@@ -35,6 +35,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/tutumagi/pitaya/conn/message"
 	"github.com/tutumagi/pitaya/constants"
+	pcontext "github.com/tutumagi/pitaya/context"
 	e "github.com/tutumagi/pitaya/errors"
 	"github.com/tutumagi/pitaya/helpers"
 	"github.com/tutumagi/pitaya/metrics"
@@ -305,12 +306,12 @@ func TestNatsRPCClientBuildRequest(t *testing.T) {
 		route          *route.Route
 		session        *session.Session
 		msg            *message.Message
-		expected       protos.Request
+		expected       *protos.Request
 	}{
 		{
 			"test-frontend-request", true, protos.RPCType_Sys, rt, ss,
 			&message.Message{Type: message.Request, ID: id, Data: data},
-			protos.Request{
+			&protos.Request{
 				Type: protos.RPCType_Sys,
 				Msg: &protos.Msg{
 					Route: rt.String(),
@@ -320,16 +321,17 @@ func TestNatsRPCClientBuildRequest(t *testing.T) {
 				},
 				FrontendID: sv.ID,
 				Session: &protos.Session{
-					Id:   ss.ID(),
-					Uid:  ss.UID(),
-					Data: ss.GetDataEncoded(),
+					Id:      ss.ID(),
+					Uid:     ss.UID(),
+					Data:    ss.GetDataEncoded(),
+					Version: ss.Version(),
 				},
 			},
 		},
 		{
 			"test-rpc-sys-request", false, protos.RPCType_Sys, rt, ss,
 			&message.Message{Type: message.Request, ID: id, Data: data},
-			protos.Request{
+			&protos.Request{
 				Type: protos.RPCType_Sys,
 				Msg: &protos.Msg{
 					Route: rt.String(),
@@ -339,16 +341,17 @@ func TestNatsRPCClientBuildRequest(t *testing.T) {
 				},
 				FrontendID: "",
 				Session: &protos.Session{
-					Id:   ss.ID(),
-					Uid:  ss.UID(),
-					Data: ss.GetDataEncoded(),
+					Id:      ss.ID(),
+					Uid:     ss.UID(),
+					Data:    ss.GetDataEncoded(),
+					Version: ss.Version(),
 				},
 			},
 		},
 		{
 			"test-rpc-user-request", false, protos.RPCType_User, rt, ss,
 			&message.Message{Type: message.Request, ID: id, Data: data},
-			protos.Request{
+			&protos.Request{
 				Type: protos.RPCType_User,
 				Msg: &protos.Msg{
 					Route: rt.String(),
@@ -361,7 +364,7 @@ func TestNatsRPCClientBuildRequest(t *testing.T) {
 		{
 			"test-notify", false, protos.RPCType_Sys, rt, ss,
 			&message.Message{Type: message.Notify, ID: id, Data: data},
-			protos.Request{
+			&protos.Request{
 				Type: protos.RPCType_Sys,
 				Msg: &protos.Msg{
 					Route: rt.String(),
@@ -371,9 +374,10 @@ func TestNatsRPCClientBuildRequest(t *testing.T) {
 				},
 				FrontendID: "",
 				Session: &protos.Session{
-					Id:   ss.ID(),
-					Uid:  ss.UID(),
-					Data: ss.GetDataEncoded(),
+					Id:      ss.ID(),
+					Uid:     ss.UID(),
+					Data:    ss.GetDataEncoded(),
+					Version: ss.Version(),
 				},
 			},
 		},
@@ -390,6 +394,54 @@ func TestNatsRPCClientBuildRequest(t *testing.T) {
 	}
 }
 
+func TestNatsRPCClientBuildRequestDeadline(t *testing.T) {
+	config := getConfig()
+	sv := getServer()
+	rpcClient, _ := NewNatsRPCClient(config, sv, nil, nil)
+
+	rt := route.NewRoute("sv", "svc", "method")
+	ss := session.New(nil, true, "uid")
+	msg := &message.Message{Type: message.Request, ID: 1, Data: []byte("data")}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	req, err := buildRequest(ctx, protos.RPCType_User, rt, ss, msg, rpcClient.server)
+	assert.NoError(t, err)
+	reqCtx, err := pcontext.Decode(req.Metadata)
+	assert.NoError(t, err)
+	remaining := time.Duration(pcontext.GetFromPropagateCtx(reqCtx, constants.DeadlineKey).(float64))
+	assert.True(t, remaining > 59*time.Second && remaining <= time.Minute)
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = buildRequest(expired, protos.RPCType_User, rt, ss, msg, rpcClient.server)
+	assert.Equal(t, e.NewError(constants.ErrRequestDeadlineExceeded, e.ErrDeadlineExceededCode), err)
+}
+
+func TestNatsRPCClientBuildRequestWithSessionStore(t *testing.T) {
+	session.SetStore(session.NewMemoryStore())
+	defer session.SetStore(nil)
+	config := getConfig()
+	sv := getServer()
+	rpcClient, _ := NewNatsRPCClient(config, sv, nil, nil)
+
+	rt := route.NewRoute("sv", "svc", "method")
+	msg := &message.Message{Type: message.Request, ID: 1, Data: []byte("data")}
+	bound := session.New(nil, true, "uid")
+	unbound := session.New(nil, true)
+	assert.NoError(t, bound.Set("key", "val"))
+	assert.NoError(t, unbound.Set("key", "val"))
+
+	// backends read the data of bound sessions from the store
+	req, err := buildRequest(context.Background(), protos.RPCType_Sys, rt, bound, msg, rpcClient.server)
+	assert.NoError(t, err)
+	assert.Empty(t, req.Session.Data)
+
+	req, err = buildRequest(context.Background(), protos.RPCType_Sys, rt, unbound, msg, rpcClient.server)
+	assert.NoError(t, err)
+	assert.Equal(t, unbound.GetDataEncoded(), req.Session.Data)
+}
+
 func TestNatsRPCClientCallShouldFailIfNotRunning(t *testing.T) {
 	config := getConfig()
 	sv := getServer()
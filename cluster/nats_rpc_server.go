@@ -125,6 +125,16 @@ func GetUserKickTopic(uid string, svType string) string {
 	return fmt.Sprintf("pitaya/%s/user/%s/kick", svType, uid)
 }
 
+// GetRoleMessagesTopic get the topic for role
+func GetRoleMessagesTopic(roleID string, svType string) string {
+	return fmt.Sprintf("pitaya/%s/role/%s/push", svType, roleID)
+}
+
+// GetRoleKickTopic get the topic for kicking a role
+func GetRoleKickTopic(roleID string, svType string) string {
+	return fmt.Sprintf("pitaya/%s/role/%s/kick", svType, roleID)
+}
+
 // GetBindBroadcastTopic gets the topic on which bind events will be broadcasted
 func GetBindBroadcastTopic(svType string) string {
 	return fmt.Sprintf("pitaya/%s/bindings", svType)
@@ -146,6 +156,22 @@ func (ns *NatsRPCServer) onSessionBind(ctx context.Context, s *session.Session)
 	return nil
 }
 
+// onRoleBind should be called on each role bind
+func (ns *NatsRPCServer) onRoleBind(ctx context.Context, s *session.Session) error {
+	if ns.server.Frontend {
+		subp, err := ns.subscribeTo(GetRoleMessagesTopic(s.RoleID(), ns.server.Type), ns.onUserPush)
+		if err != nil {
+			return err
+		}
+		subk, err := ns.subscribeTo(GetRoleKickTopic(s.RoleID(), ns.server.Type), ns.onUserKick)
+		if err != nil {
+			return err
+		}
+		s.Subscriptions = append(s.Subscriptions, subp, subk)
+	}
+	return nil
+}
+
 // SetPitayaServer sets the pitaya server
 func (ns *NatsRPCServer) SetPitayaServer(ps protos.PitayaServer) {
 	ns.pitayaServer = ps
@@ -157,32 +183,39 @@ func (ns *NatsRPCServer) subscribeToBindingsChannel() error {
 }
 
 func (ns *NatsRPCServer) subscribeToUserKickChannel(uid string, svType string) (*nats.Subscription, error) {
-	sub, err := ns.conn.Subscribe(GetUserKickTopic(uid, svType), func(msg *nats.Msg) {
-		kick := &protos.KickMsg{}
-		err := proto.Unmarshal(msg.Data, kick)
-		if err != nil {
-			logger.Log.Error("error unrmarshalling push: ", err.Error())
-		}
-		ns.userKickCh <- kick
-	})
-	return sub, err
+	return ns.subscribeTo(GetUserKickTopic(uid, svType), ns.onUserKick)
 }
 
 func (ns *NatsRPCServer) subscribeToUserMessages(uid string, svType string) (*nats.Subscription, error) {
-	sub, err := ns.conn.Subscribe(GetUserMessagesTopic(uid, svType), func(msg *nats.Msg) {
-		push := &protos.Push{}
-		err := proto.Unmarshal(msg.Data, push)
-		if err != nil {
-			logger.Log.Error("error unmarshalling push:", err.Error())
-		}
-		ns.userPushCh <- push
-	})
+	return ns.subscribeTo(GetUserMessagesTopic(uid, svType), ns.onUserPush)
+}
+
+func (ns *NatsRPCServer) subscribeTo(topic string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	sub, err := ns.conn.Subscribe(topic, handler)
 	if err != nil {
 		return nil, err
 	}
 	return sub, nil
 }
 
+func (ns *NatsRPCServer) onUserKick(msg *nats.Msg) {
+	kick := &protos.KickMsg{}
+	err := proto.Unmarshal(msg.Data, kick)
+	if err != nil {
+		logger.Log.Error("error unrmarshalling push: ", err.Error())
+	}
+	ns.userKickCh <- kick
+}
+
+func (ns *NatsRPCServer) onUserPush(msg *nats.Msg) {
+	push := &protos.Push{}
+	err := proto.Unmarshal(msg.Data, push)
+	if err != nil {
+		logger.Log.Error("error unmarshalling push:", err.Error())
+	}
+	ns.userPushCh <- push
+}
+
 func (ns *NatsRPCServer) handleMessages() {
 	defer (func() {
 		ns.conn.Close()
@@ -355,6 +388,7 @@ func (ns *NatsRPCServer) Init() error {
 	// }
 
 	session.OnSessionBind(ns.onSessionBind)
+	session.OnRoleBind(ns.onRoleBind)
 
 	// this should be so fast that we shoudn't need concurrency
 	// 处理玩家的push消息，不会再跑到业务逻辑，放到单独协程
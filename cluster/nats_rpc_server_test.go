@@ -99,6 +99,12 @@ func TestNatsRPCServerGetUserKickTopic(t *testing.T) {
 	assert.Equal(t, "pitaya/game/user/11/kick", GetUserKickTopic("11", "game"))
 }
 
+func TestNatsRPCServerGetRoleTopics(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "pitaya/connector/role/r1/push", GetRoleMessagesTopic("r1", "connector"))
+	assert.Equal(t, "pitaya/game/role/r2/kick", GetRoleKickTopic("r2", "game"))
+}
+
 func TestNatsRPCServerGetUnhandledRequestsChannel(t *testing.T) {
 	t.Parallel()
 	cfg := getConfig()
@@ -29,5 +29,6 @@ type ServiceDiscovery interface {
 	GetServers() []*Server
 	SyncServers() error
 	AddListener(listener SDListener)
+	Deregister() error
 	interfaces.Module
 }
@@ -0,0 +1,117 @@
+// Copyright (c) nano Authors and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package component
+
+import (
+	"context"
+	"fmt"
+)
+
+// Dispatch decides which goroutine processes the messages of a handler
+type Dispatch int
+
+const (
+	// Ordered processes the messages of a session one at a time in the order
+	// they arrived, it is the default
+	Ordered Dispatch = iota
+	// Pooled processes the messages on the shared dispatch pool, the
+	// messages of a session may run concurrently and out of order
+	Pooled
+	// Keyed processes one at a time and in order the messages sharing the
+	// key returned by a KeyFunc, e.g. the messages of a room
+	Keyed
+)
+
+// KeyFunc returns the key that Keyed messages are serialized by, data is the
+// raw message. Messages with an empty key fall back to Ordered.
+type KeyFunc func(ctx context.Context, data []byte) string
+
+type dispatchRule struct {
+	dispatch Dispatch
+	key      KeyFunc
+}
+
+func (d Dispatch) String() string {
+	switch d {
+	case Ordered:
+		return "ordered"
+	case Pooled:
+		return "pooled"
+	case Keyed:
+		return "keyed"
+	default:
+		return fmt.Sprintf("Dispatch(%d)", int(d))
+	}
+}
+
+// applyDispatch sets the dispatch of the handlers from the options
+func (s *Service) applyDispatch() error {
+	names := make([]string, 0, len(s.Handlers))
+	for name := range s.Handlers {
+		names = append(names, name)
+	}
+	rules, err := s.dispatchRules("handler", names)
+	if err != nil {
+		return err
+	}
+	for name, h := range s.Handlers {
+		h.Dispatch = rules[name].dispatch
+		h.DispatchKey = rules[name].key
+	}
+	return nil
+}
+
+// applyRemoteDispatch sets the dispatch of the remotes from the options
+func (s *Service) applyRemoteDispatch() error {
+	names := make([]string, 0, len(s.Remotes))
+	for name := range s.Remotes {
+		names = append(names, name)
+	}
+	rules, err := s.dispatchRules("remote", names)
+	if err != nil {
+		return err
+	}
+	for name, r := range s.Remotes {
+		r.Dispatch = rules[name].dispatch
+		r.DispatchKey = rules[name].key
+	}
+	return nil
+}
+
+// dispatchRules returns the rule of each of the named methods, kind names
+// the methods in the errors
+func (s *Service) dispatchRules(kind string, names []string) (map[string]dispatchRule, error) {
+	rules := make(map[string]dispatchRule, len(names))
+	for _, name := range names {
+		rules[name] = s.Options.dispatch
+	}
+	for name, rule := range s.Options.handlerDispatch {
+		if _, ok := rules[name]; !ok {
+			return nil, fmt.Errorf("dispatch option for unknown %s %s.%s", kind, s.Name, name)
+		}
+		rules[name] = rule
+	}
+	for name, rule := range rules {
+		if rule.dispatch == Keyed && rule.key == nil {
+			return nil, fmt.Errorf("keyed dispatch without key function for %s %s.%s", kind, s.Name, name)
+		}
+	}
+	return rules, nil
+}
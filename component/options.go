@@ -22,8 +22,10 @@ package component
 
 type (
 	options struct {
-		name     string              // component name
-		nameFunc func(string) string // rename handler name
+		name            string                  // component name
+		nameFunc        func(string) string     // rename handler name
+		dispatch        dispatchRule            // dispatch of the handlers or remotes
+		handlerDispatch map[string]dispatchRule // dispatch of specific handlers or remotes
 	}
 
 	// Option used to customize handler
@@ -44,3 +46,35 @@ func WithNameFunc(fn func(string) string) Option {
 		opt.nameFunc = fn
 	}
 }
+
+// WithDispatch sets how the messages of the given handlers are dispatched,
+// or of all handlers of the component if none is given. Handlers are named
+// as in the routes. Use WithDispatchKey for Keyed dispatch. Registered with
+// a remote component it applies to the requests of its remotes.
+func WithDispatch(dispatch Dispatch, handlers ...string) Option {
+	return func(opt *options) {
+		opt.setDispatch(dispatchRule{dispatch: dispatch}, handlers)
+	}
+}
+
+// WithDispatchKey dispatches the messages of the given handlers, or of all
+// handlers of the component if none is given, serialized by the key
+// returned by fn. For remotes data is the serialized argument of the request.
+func WithDispatchKey(fn KeyFunc, handlers ...string) Option {
+	return func(opt *options) {
+		opt.setDispatch(dispatchRule{dispatch: Keyed, key: fn}, handlers)
+	}
+}
+
+func (opt *options) setDispatch(rule dispatchRule, handlers []string) {
+	if len(handlers) == 0 {
+		opt.dispatch = rule
+		return
+	}
+	if opt.handlerDispatch == nil {
+		opt.handlerDispatch = make(map[string]dispatchRule)
+	}
+	for _, h := range handlers {
+		opt.handlerDispatch[h] = rule
+	}
+}
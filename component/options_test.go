@@ -21,6 +21,7 @@
 package component
 
 import (
+	"context"
 	"strings"
 	"testing"
 
@@ -43,3 +44,24 @@ func TestWithNameFunc(t *testing.T) {
 	WithNameFunc(nameFunc)(opt)
 	assert.Equal(t, opt.nameFunc(name), strings.ToUpper(name))
 }
+
+func TestWithDispatch(t *testing.T) {
+	opt := &options{}
+	WithDispatch(Pooled)(opt)
+	assert.Equal(t, Pooled, opt.dispatch.dispatch)
+	assert.Nil(t, opt.handlerDispatch)
+
+	WithDispatch(Ordered, "a", "b")(opt)
+	assert.Equal(t, Pooled, opt.dispatch.dispatch)
+	assert.Equal(t, Ordered, opt.handlerDispatch["a"].dispatch)
+	assert.Equal(t, Ordered, opt.handlerDispatch["b"].dispatch)
+}
+
+func TestWithDispatchKey(t *testing.T) {
+	opt := &options{}
+	key := func(ctx context.Context, data []byte) string { return string(data) }
+	WithDispatchKey(key, "a")(opt)
+	assert.Equal(t, Ordered, opt.dispatch.dispatch)
+	assert.Equal(t, Keyed, opt.handlerDispatch["a"].dispatch)
+	assert.Equal(t, "room", opt.handlerDispatch["a"].key(context.Background(), []byte("room")))
+}
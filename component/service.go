@@ -36,14 +36,18 @@ type (
 		Type        reflect.Type   // low-level type of method
 		IsRawArg    bool           // whether the data need to serialize
 		MessageType message.Type   // handler allowed message type (either request or notify)
+		Dispatch    Dispatch       // how the messages of the handler are dispatched
+		DispatchKey KeyFunc        // key the messages are serialized by in Keyed dispatch
 	}
 
 	//Remote represents remote's meta information.
 	Remote struct {
-		Receiver reflect.Value  // receiver of method
-		Method   reflect.Method // method stub
-		HasArgs  bool           // if remote has no args we won't try to serialize received data into arguments
-		Type     reflect.Type   // low-level type of method
+		Receiver    reflect.Value  // receiver of method
+		Method      reflect.Method // method stub
+		HasArgs     bool           // if remote has no args we won't try to serialize received data into arguments
+		Type        reflect.Type   // low-level type of method
+		Dispatch    Dispatch       // how the requests are dispatched
+		DispatchKey KeyFunc        // key the requests are serialized by in Keyed dispatch
 	}
 
 	// Service implements a specific service, some of it's methods will be
@@ -116,7 +120,7 @@ func (s *Service) ExtractHandler() error {
 		s.Handlers[i].Receiver = s.Receiver
 	}
 
-	return nil
+	return s.applyDispatch()
 }
 
 // ExtractRemote extract the set of methods from the
@@ -152,7 +156,7 @@ func (s *Service) ExtractRemote() error {
 	for i := range s.Remotes {
 		s.Remotes[i].Receiver = s.Receiver
 	}
-	return nil
+	return s.applyRemoteDispatch()
 }
 
 // ValidateMessageType validates a given message type against the handler's one
@@ -21,6 +21,7 @@
 package component
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -91,6 +92,59 @@ func TestExtractHandler(t *testing.T) {
 	}
 }
 
+func TestExtractHandlerDispatch(t *testing.T) {
+	key := func(ctx context.Context, data []byte) string { return "room" }
+
+	svc := NewService(&TestType{}, []Option{
+		WithDispatch(Pooled),
+		WithDispatchKey(key, "ExportedHandlerWithOnlySession"),
+	})
+	assert.NoError(t, svc.ExtractHandler())
+	for name, h := range svc.Handlers {
+		if name == "ExportedHandlerWithOnlySession" {
+			assert.Equal(t, Keyed, h.Dispatch)
+			assert.Equal(t, "room", h.DispatchKey(context.Background(), nil))
+		} else {
+			assert.Equal(t, Pooled, h.Dispatch)
+			assert.Nil(t, h.DispatchKey)
+		}
+	}
+
+	svc = NewService(&TestType{}, []Option{})
+	assert.NoError(t, svc.ExtractHandler())
+	for _, h := range svc.Handlers {
+		assert.Equal(t, Ordered, h.Dispatch)
+	}
+
+	svc = NewService(&TestType{}, []Option{WithDispatch(Pooled, "Unknown")})
+	assert.EqualError(t, svc.ExtractHandler(), "dispatch option for unknown handler TestType.Unknown")
+
+	svc = NewService(&TestType{}, []Option{WithDispatch(Keyed)})
+	assert.Error(t, svc.ExtractHandler())
+}
+
+func TestExtractRemoteDispatch(t *testing.T) {
+	key := func(ctx context.Context, data []byte) string { return "role" }
+
+	svc := NewService(&TestType{}, []Option{
+		WithDispatch(Pooled),
+		WithDispatchKey(key, "ExportedRemoteRawOut"),
+	})
+	assert.NoError(t, svc.ExtractRemote())
+	assert.Equal(t, Keyed, svc.Remotes["ExportedRemoteRawOut"].Dispatch)
+	assert.Equal(t, "role", svc.Remotes["ExportedRemoteRawOut"].DispatchKey(context.Background(), nil))
+	assert.Equal(t, Pooled, svc.Remotes["ExportedRemotePointerOut"].Dispatch)
+
+	svc = NewService(&TestType{}, []Option{})
+	assert.NoError(t, svc.ExtractRemote())
+	for _, r := range svc.Remotes {
+		assert.Equal(t, Ordered, r.Dispatch)
+	}
+
+	svc = NewService(&TestType{}, []Option{WithDispatch(Pooled, "ExportedHandlerWithOnlySession")})
+	assert.EqualError(t, svc.ExtractRemote(), "dispatch option for unknown remote TestType.ExportedHandlerWithOnlySession")
+}
+
 func TestExtractRemote(t *testing.T) {
 	tables[2].err = errors.New("type ExportedTypeWithNoHandlerAndNoRemote has no exported methods of remote type")
 	for _, table := range tables {
@@ -50,12 +50,15 @@ func NewConfig(cfgs ...*viper.Viper) *Config {
 
 func (c *Config) fillDefaultValues() {
 	defaultsMap := map[string]interface{}{
-		"pitaya.buffer.agent.messages": 100,
+		"pitaya.buffer.agent.messages":         100,
+		"pitaya.buffer.agent.overflow.policy":  "block",
+		"pitaya.buffer.agent.overflow.timeout": "5s",
 		// the max buffer size that nats will accept, if this buffer overflows, messages will begin to be dropped
 		"pitaya.buffer.cluster.rpc.server.nats.messages":        75,
 		"pitaya.buffer.cluster.rpc.server.nats.push":            100,
 		"pitaya.buffer.handler.localprocess":                    20,
 		"pitaya.buffer.handler.remoteprocess":                   20,
+		"pitaya.buffer.remote.mailbox":                          20,
 		"pitaya.cluster.info.region":                            "",
 		"pitaya.cluster.rpc.client.grpc.dialtimeout":            "5s",
 		"pitaya.cluster.rpc.client.grpc.requesttimeout":         "5s",
@@ -89,12 +92,17 @@ func (c *Config) fillDefaultValues() {
 		"pitaya.concurrency.handler.dispatch":              25,
 		"pitaya.concurrency.remote.service":                30,
 		"pitaya.defaultpipelines.structvalidation.enabled": false,
+		"pitaya.debug.http.enabled":                        false,
+		"pitaya.debug.http.port":                           9091,
+		"pitaya.drain.timeout":                             "0s",
 		"pitaya.groups.etcd.dialtimeout":                   "5s",
 		"pitaya.groups.etcd.endpoints":                     "localhost:2379",
 		"pitaya.groups.etcd.prefix":                        "pitaya/",
 		"pitaya.groups.etcd.transactiontimeout":            "5s",
 		"pitaya.groups.memory.tickduration":                "30s",
 		"pitaya.handler.messages.compression":              true,
+		"pitaya.handler.pooledremoteroutes":                []string{},
+		"pitaya.handler.timeout":                           "0s",
 		"pitaya.heartbeat.interval":                        "30s",
 		"pitaya.metrics.additionalTags":                    map[string]string{},
 		"pitaya.metrics.constTags":                         map[string]string{},
@@ -113,6 +121,26 @@ func (c *Config) fillDefaultValues() {
 		"pitaya.conn.ratelimiting.limit":                   20,
 		"pitaya.conn.ratelimiting.interval":                "1s",
 		"pitaya.conn.ratelimiting.forcedisable":            false,
+		"pitaya.conn.ratelimiting.disconnect":              false,
+		"pitaya.conn.coalesce.interval":                    "0s",
+		"pitaya.conn.coalesce.size":                        0,
+		"pitaya.conn.firstdatatimeout":                     "0s",
+		"pitaya.conn.handshaketimeout":                     "0s",
+		"pitaya.conn.kickreason":                           false,
+		"pitaya.conn.maxperip":                             0,
+		"pitaya.conn.push.criticalroutes":                  []string{},
+		"pitaya.conn.push.droppableroutes":                 []string{},
+		"pitaya.conn.requesttimeout":                       "5s",
+		"pitaya.conn.slowconsumer.policy":                  "ignore",
+		"pitaya.conn.slowconsumer.threshold":               0.8,
+		"pitaya.conn.slowconsumer.window":                  "5s",
+		"pitaya.conn.writetimeout":                         "0s",
+		"pitaya.session.resume.backlog":                    100,
+		"pitaya.session.resume.grace":                      "0s",
+		"pitaya.session.store.etcd.dialtimeout":            "5s",
+		"pitaya.session.store.etcd.endpoints":              "localhost:2379",
+		"pitaya.session.store.etcd.prefix":                 "pitaya/",
+		"pitaya.session.store.etcd.transactiontimeout":     "5s",
 		"pitaya.session.unique":                            true,
 		"pitaya.worker.concurrency":                        1,
 		"pitaya.worker.redis.pool":                         "10",
@@ -142,6 +170,11 @@ func (c *Config) GetString(s string) string {
 	return c.config.GetString(s)
 }
 
+// GetFloat64 returns a float64 from the inner config
+func (c *Config) GetFloat64(s string) float64 {
+	return c.config.GetFloat64(s)
+}
+
 // GetInt returns an int from the inner config
 func (c *Config) GetInt(s string) int {
 	return c.config.GetInt(s)
@@ -0,0 +1,304 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package kcp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// mtuLimit is the largest packet read from the network
+	mtuLimit = 1500
+	// updateInterval is how often the links are flushed
+	updateInterval = 10 * time.Millisecond
+	// linger is how long closed connections keep sending their queued data
+	linger = 2 * time.Second
+)
+
+// ErrDeadLink is returned by connections whose peer stopped acknowledging
+// their segments
+var ErrDeadLink = errors.New("kcp: peer is not acknowledging segments")
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "kcp: i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// Conn is a KCP connection, data written to it is delivered in order to the
+// peer as a stream, like TCP
+type Conn struct {
+	mu            sync.Mutex
+	kcp           *kcp
+	pconn         net.PacketConn
+	remote        net.Addr
+	start         time.Time
+	pending       []byte // part of the last message not read yet
+	readDeadline  time.Time
+	writeDeadline time.Time
+	release       func() // frees the resources of the connection once closed
+
+	chReadable chan struct{}
+	chWritable chan struct{}
+	chDie      chan struct{}
+	closeOnce  sync.Once
+}
+
+func newConn(conv uint32, pconn net.PacketConn, remote net.Addr, release func()) *Conn {
+	c := &Conn{
+		pconn:      pconn,
+		remote:     remote,
+		start:      time.Now(),
+		release:    release,
+		chReadable: make(chan struct{}, 1),
+		chWritable: make(chan struct{}, 1),
+		chDie:      make(chan struct{}),
+	}
+	c.kcp = newKCP(conv, func(buf []byte) {
+		c.pconn.WriteTo(buf, c.remote)
+	})
+	// tuned for latency like the fast mode of the reference implementation
+	c.kcp.setNoDelay(1, int(updateInterval/time.Millisecond), 2, 1)
+	c.kcp.setWndSize(128, 128)
+	c.kcp.stream = 1
+
+	go c.update()
+	return c
+}
+
+// now returns the milliseconds since the connection was created
+func (c *Conn) now() uint32 {
+	return uint32(time.Since(c.start) / time.Millisecond)
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// update flushes the link every interval, closed connections keep flushing
+// for a while so that their queued data reaches the peer
+func (c *Conn) update() {
+	ticker := time.NewTicker(updateInterval)
+	defer ticker.Stop()
+	defer c.release()
+
+	chDie := c.chDie
+	var lingerUntil time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-chDie:
+			chDie = nil
+			lingerUntil = time.Now().Add(linger)
+		}
+
+		c.mu.Lock()
+		c.kcp.update(c.now())
+		waiting := c.kcp.waitSnd()
+		dead := c.kcp.state == stateDead
+		c.mu.Unlock()
+		if !lingerUntil.IsZero() && (waiting == 0 || dead || time.Now().After(lingerUntil)) {
+			return
+		}
+		if dead {
+			notify(c.chReadable)
+		}
+		if waiting < int(c.kcp.sndWnd) || dead {
+			notify(c.chWritable)
+		}
+	}
+}
+
+// input handles a packet received from the peer
+func (c *Conn) input(data []byte) {
+	c.mu.Lock()
+	c.kcp.current = c.now()
+	c.kcp.input(data)
+	readable := c.kcp.peekSize() > 0
+	writable := c.kcp.waitSnd() < int(c.kcp.sndWnd)
+	c.mu.Unlock()
+
+	if readable {
+		notify(c.chReadable)
+	}
+	if writable {
+		notify(c.chWritable)
+	}
+}
+
+// wait blocks until ch is notified, the deadline passes or the connection
+// is closed
+func (c *Conn) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return timeoutError{}
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return timeoutError{}
+	case <-c.chDie:
+		return io.ErrClosedPipe
+	}
+}
+
+func (c *Conn) closed() bool {
+	select {
+	case <-c.chDie:
+		return true
+	default:
+		return false
+	}
+}
+
+// Read reads data sent by the peer
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		if c.closed() {
+			return 0, io.ErrClosedPipe
+		}
+
+		c.mu.Lock()
+		if len(c.pending) > 0 {
+			n := copy(b, c.pending)
+			c.pending = c.pending[n:]
+			c.mu.Unlock()
+			return n, nil
+		}
+		if size := c.kcp.peekSize(); size > 0 {
+			if size <= len(b) {
+				n := c.kcp.recv(b)
+				c.mu.Unlock()
+				return n, nil
+			}
+			buf := make([]byte, size)
+			c.kcp.recv(buf)
+			n := copy(b, buf)
+			c.pending = buf[n:]
+			c.mu.Unlock()
+			return n, nil
+		}
+		dead := c.kcp.state == stateDead
+		deadline := c.readDeadline
+		c.mu.Unlock()
+
+		if dead {
+			return 0, ErrDeadLink
+		}
+		if err := c.wait(c.chReadable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write queues data to be sent to the peer, blocking while the send window
+// is full
+func (c *Conn) Write(b []byte) (int, error) {
+	for {
+		if c.closed() {
+			return 0, io.ErrClosedPipe
+		}
+
+		c.mu.Lock()
+		if c.kcp.state == stateDead {
+			c.mu.Unlock()
+			return 0, ErrDeadLink
+		}
+		if c.kcp.waitSnd() < int(c.kcp.sndWnd) {
+			if len(b) > 0 {
+				c.kcp.send(b)
+				// sends right away instead of waiting for the next update
+				c.kcp.current = c.now()
+				c.kcp.flush()
+			}
+			c.mu.Unlock()
+			return len(b), nil
+		}
+		deadline := c.writeDeadline
+		c.mu.Unlock()
+
+		if err := c.wait(c.chWritable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Close closes the connection, the data already written is still sent for
+// a short while
+func (c *Conn) Close() error {
+	err := io.ErrClosedPipe
+	c.closeOnce.Do(func() {
+		close(c.chDie)
+		err = nil
+	})
+	return err
+}
+
+// LocalAddr returns the local network address
+func (c *Conn) LocalAddr() net.Addr {
+	return c.pconn.LocalAddr()
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline sets the read and write deadlines of the connection
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future and pending Read calls, a
+// zero value disables it
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	notify(c.chReadable)
+	return nil
+}
+
+// SetWriteDeadline sets the deadline for future and pending Write calls, a
+// zero value disables it
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	notify(c.chWritable)
+	return nil
+}
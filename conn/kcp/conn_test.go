@@ -0,0 +1,171 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package kcp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/helpers"
+)
+
+func dialAndAccept(t *testing.T, l *Listener) (net.Conn, net.Conn) {
+	t.Helper()
+	client, err := Dial(l.Addr().String())
+	assert.NoError(t, err)
+
+	// the server only knows about the client once it sends something
+	_, err = client.Write([]byte("hello"))
+	assert.NoError(t, err)
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		assert.NoError(t, err)
+		accepted <- conn
+	}()
+	server := helpers.ShouldEventuallyReceive(t, accepted, time.Second).(net.Conn)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(server, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	return client, server
+}
+
+func TestConnReadWrite(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	client, server := dialAndAccept(t, l)
+	defer client.Close()
+	defer server.Close()
+	assert.Equal(t, client.LocalAddr().(*net.UDPAddr).Port, server.RemoteAddr().(*net.UDPAddr).Port)
+
+	data := bytes.Repeat([]byte("0123456789"), 50000)
+	go func() {
+		_, err := server.Write(data)
+		assert.NoError(t, err)
+	}()
+
+	received := make([]byte, len(data))
+	_, err = io.ReadFull(client, received)
+	assert.NoError(t, err)
+	assert.Equal(t, data, received)
+}
+
+func TestConnReadDeadline(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	client, server := dialAndAccept(t, l)
+	defer client.Close()
+	defer server.Close()
+
+	assert.NoError(t, server.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	_, err = server.Read(make([]byte, 1))
+	assert.Error(t, err)
+	ne, ok := err.(net.Error)
+	assert.True(t, ok)
+	assert.True(t, ne.Timeout())
+
+	// clearing the deadline reads again
+	assert.NoError(t, server.SetReadDeadline(time.Time{}))
+	_, err = client.Write([]byte("a"))
+	assert.NoError(t, err)
+	n, err := server.Read(make([]byte, 1))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+}
+
+func TestConnClose(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	client, server := dialAndAccept(t, l)
+	defer client.Close()
+
+	// data written before closing still reaches the peer
+	_, err = server.Write([]byte("bye"))
+	assert.NoError(t, err)
+	assert.NoError(t, server.Close())
+	assert.Equal(t, io.ErrClosedPipe, server.Close())
+
+	_, err = server.Read(make([]byte, 1))
+	assert.Equal(t, io.ErrClosedPipe, err)
+	_, err = server.Write([]byte("a"))
+	assert.Equal(t, io.ErrClosedPipe, err)
+
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(client, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "bye", string(buf))
+
+	// the listener forgets the connection once its data is acknowledged
+	helpers.ShouldEventuallyReturn(t, func() int {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.conns)
+	}, 0)
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	assert.NoError(t, err)
+
+	client, server := dialAndAccept(t, l)
+	defer client.Close()
+
+	assert.NoError(t, l.Close())
+	_, err = l.Accept()
+	assert.Equal(t, io.ErrClosedPipe, err)
+	_, err = server.Read(make([]byte, 1))
+	assert.Equal(t, io.ErrClosedPipe, err)
+}
+
+func TestListenerIgnoresUnknownPeers(t *testing.T) {
+	l, err := Listen("127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pconn.Close()
+
+	// an ack is not the first segment of a connection
+	seg := segment{conv: 1, cmd: cmdAck}
+	buf := make([]byte, overhead)
+	seg.encode(buf)
+	_, err = pconn.WriteTo(buf, l.Addr())
+	assert.NoError(t, err)
+
+	time.Sleep(50 * time.Millisecond)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	assert.Empty(t, l.conns)
+}
@@ -0,0 +1,707 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package kcp implements KCP, a reliable and ordered protocol on top of UDP
+// that trades bandwidth for lower latency than TCP on lossy networks. The
+// segments are compatible with the reference implementation at
+// https://github.com/skywind3000/kcp, so clients can use any KCP library.
+package kcp
+
+import (
+	"encoding/binary"
+)
+
+const (
+	rtoNoDelay   = 30    // minimum rto in no delay mode
+	rtoMin       = 100   // minimum rto
+	rtoDefault   = 200   // initial rto
+	rtoMax       = 60000 // maximum rto
+	cmdPush      = 81    // push data
+	cmdAck       = 82    // ack a segment
+	cmdWindowAsk = 83    // ask the window size of the peer
+	cmdWindowTel = 84    // tell the window size to the peer
+	askSend      = 1     // needs to send cmdWindowAsk
+	askTell      = 2     // needs to send cmdWindowTel
+	wndSnd       = 32    // default send window, in segments
+	wndRcv       = 128   // default receive window, in segments
+	mtuDefault   = 1400  // default mtu, in bytes
+	interval     = 100   // default flush interval, in milliseconds
+	overhead     = 24    // size of the segment header
+	deadLink     = 20    // retransmissions of a segment before the link is dead
+	threshInit   = 2     // initial slow start threshold
+	threshMin    = 2     // minimum slow start threshold
+	probeInit    = 7000  // initial time to probe a zero window, in milliseconds
+	probeLimit   = 120000
+	fastackLimit = 5 // maximum fast retransmissions of a segment
+)
+
+// stateDead is the state of a link that retransmitted a segment too often
+const stateDead = 0xFFFFFFFF
+
+func timediff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
+
+type segment struct {
+	conv     uint32
+	cmd      uint8
+	frg      uint8
+	wnd      uint16
+	ts       uint32
+	sn       uint32
+	una      uint32
+	rto      uint32
+	xmit     uint32
+	resendts uint32
+	fastack  uint32
+	data     []byte
+}
+
+// encode writes the header of the segment to buf, returning the rest of buf
+func (s *segment) encode(buf []byte) []byte {
+	binary.LittleEndian.PutUint32(buf, s.conv)
+	buf[4] = s.cmd
+	buf[5] = s.frg
+	binary.LittleEndian.PutUint16(buf[6:], s.wnd)
+	binary.LittleEndian.PutUint32(buf[8:], s.ts)
+	binary.LittleEndian.PutUint32(buf[12:], s.sn)
+	binary.LittleEndian.PutUint32(buf[16:], s.una)
+	binary.LittleEndian.PutUint32(buf[20:], uint32(len(s.data)))
+	return buf[overhead:]
+}
+
+type ackItem struct {
+	sn uint32
+	ts uint32
+}
+
+// kcp is the state machine of a KCP link, it is not safe for concurrent use.
+// Data queued with send is segmented, sent through output and retransmitted
+// until acknowledged by the peer, whose segments are given to input and read
+// in order with recv. update must be called every few milliseconds.
+type kcp struct {
+	conv, mtu, mss, state            uint32
+	sndUna, sndNxt, rcvNxt           uint32
+	ssthresh                         uint32
+	rxRttvar, rxSrtt                 int32
+	rxRto, rxMinrto                  uint32
+	sndWnd, rcvWnd, rmtWnd, cwnd     uint32
+	probe                            uint32
+	current, interval, tsFlush, xmit uint32
+	nodelay, updated                 uint32
+	tsProbe, probeWait               uint32
+	deadLink, incr                   uint32
+	fastresend                       int32
+	fastlimit                        int32
+	nocwnd, stream                   int32
+
+	sndQueue []segment
+	rcvQueue []segment
+	sndBuf   []segment
+	rcvBuf   []segment
+	acklist  []ackItem
+	buffer   []byte
+	output   func(buf []byte)
+}
+
+func newKCP(conv uint32, output func(buf []byte)) *kcp {
+	k := &kcp{
+		conv:      conv,
+		sndWnd:    wndSnd,
+		rcvWnd:    wndRcv,
+		rmtWnd:    wndRcv,
+		mtu:       mtuDefault,
+		mss:       mtuDefault - overhead,
+		rxRto:     rtoDefault,
+		rxMinrto:  rtoMin,
+		interval:  interval,
+		tsFlush:   interval,
+		ssthresh:  threshInit,
+		fastlimit: fastackLimit,
+		deadLink:  deadLink,
+		output:    output,
+	}
+	k.buffer = make([]byte, (k.mtu+overhead)*3)
+	return k
+}
+
+// peekSize returns the size of the next message, -1 if there is none
+func (k *kcp) peekSize() int {
+	if len(k.rcvQueue) == 0 {
+		return -1
+	}
+
+	seg := &k.rcvQueue[0]
+	if seg.frg == 0 {
+		return len(seg.data)
+	}
+	if len(k.rcvQueue) < int(seg.frg)+1 {
+		return -1
+	}
+
+	length := 0
+	for i := range k.rcvQueue {
+		seg := &k.rcvQueue[i]
+		length += len(seg.data)
+		if seg.frg == 0 {
+			break
+		}
+	}
+	return length
+}
+
+// recv reads the next message into buf, it returns -1 if there is none and
+// -2 if buf is too small
+func (k *kcp) recv(buf []byte) int {
+	size := k.peekSize()
+	if size < 0 {
+		return -1
+	}
+	if size > len(buf) {
+		return -2
+	}
+
+	fastRecover := len(k.rcvQueue) >= int(k.rcvWnd)
+
+	n, count := 0, 0
+	for i := range k.rcvQueue {
+		seg := &k.rcvQueue[i]
+		n += copy(buf[n:], seg.data)
+		count++
+		if seg.frg == 0 {
+			break
+		}
+	}
+	k.rcvQueue = removeFront(k.rcvQueue, count)
+	k.moveToRcvQueue()
+
+	// tell the peer the window opened again
+	if len(k.rcvQueue) < int(k.rcvWnd) && fastRecover {
+		k.probe |= askTell
+	}
+	return n
+}
+
+// send queues data, it returns a negative value if data is empty or too
+// large to be sent as a single message
+func (k *kcp) send(data []byte) int {
+	if len(data) == 0 {
+		return -1
+	}
+
+	// streams fill the last queued segment first
+	if k.stream != 0 {
+		if n := len(k.sndQueue); n > 0 {
+			seg := &k.sndQueue[n-1]
+			if len(seg.data) < int(k.mss) {
+				extend := int(k.mss) - len(seg.data)
+				if extend > len(data) {
+					extend = len(data)
+				}
+				seg.data = append(seg.data, data[:extend]...)
+				data = data[extend:]
+			}
+		}
+		if len(data) == 0 {
+			return 0
+		}
+	}
+
+	count := (len(data) + int(k.mss) - 1) / int(k.mss)
+	if k.stream == 0 && count >= wndRcv {
+		return -2
+	}
+
+	for i := 0; i < count; i++ {
+		size := len(data)
+		if size > int(k.mss) {
+			size = int(k.mss)
+		}
+		seg := segment{data: make([]byte, size)}
+		copy(seg.data, data[:size])
+		if k.stream == 0 {
+			seg.frg = uint8(count - i - 1)
+		}
+		k.sndQueue = append(k.sndQueue, seg)
+		data = data[size:]
+	}
+	return 0
+}
+
+func (k *kcp) updateAck(rtt int32) {
+	if k.rxSrtt == 0 {
+		k.rxSrtt = rtt
+		k.rxRttvar = rtt / 2
+	} else {
+		delta := rtt - k.rxSrtt
+		if delta < 0 {
+			delta = -delta
+		}
+		k.rxRttvar = (3*k.rxRttvar + delta) / 4
+		k.rxSrtt = (7*k.rxSrtt + rtt) / 8
+		if k.rxSrtt < 1 {
+			k.rxSrtt = 1
+		}
+	}
+
+	rto := uint32(k.rxSrtt) + umax(k.interval, uint32(4*k.rxRttvar))
+	k.rxRto = ubound(k.rxMinrto, rto, rtoMax)
+}
+
+func (k *kcp) shrinkBuf() {
+	if len(k.sndBuf) > 0 {
+		k.sndUna = k.sndBuf[0].sn
+	} else {
+		k.sndUna = k.sndNxt
+	}
+}
+
+func (k *kcp) parseAck(sn uint32) {
+	if timediff(sn, k.sndUna) < 0 || timediff(sn, k.sndNxt) >= 0 {
+		return
+	}
+
+	for i := range k.sndBuf {
+		seg := &k.sndBuf[i]
+		if sn == seg.sn {
+			k.sndBuf = append(k.sndBuf[:i], k.sndBuf[i+1:]...)
+			break
+		}
+		if timediff(sn, seg.sn) < 0 {
+			break
+		}
+	}
+}
+
+func (k *kcp) parseFastack(sn uint32) {
+	if timediff(sn, k.sndUna) < 0 || timediff(sn, k.sndNxt) >= 0 {
+		return
+	}
+
+	for i := range k.sndBuf {
+		seg := &k.sndBuf[i]
+		if timediff(sn, seg.sn) < 0 {
+			break
+		} else if sn != seg.sn {
+			seg.fastack++
+		}
+	}
+}
+
+func (k *kcp) parseUna(una uint32) {
+	count := 0
+	for i := range k.sndBuf {
+		if timediff(una, k.sndBuf[i].sn) > 0 {
+			count++
+		} else {
+			break
+		}
+	}
+	k.sndBuf = removeFront(k.sndBuf, count)
+}
+
+func (k *kcp) parseData(newseg segment) {
+	sn := newseg.sn
+	if timediff(sn, k.rcvNxt+k.rcvWnd) >= 0 || timediff(sn, k.rcvNxt) < 0 {
+		return
+	}
+
+	insert := 0
+	for i := len(k.rcvBuf) - 1; i >= 0; i-- {
+		seg := &k.rcvBuf[i]
+		if seg.sn == sn {
+			// repeated
+			return
+		}
+		if timediff(sn, seg.sn) > 0 {
+			insert = i + 1
+			break
+		}
+	}
+
+	k.rcvBuf = append(k.rcvBuf, segment{})
+	copy(k.rcvBuf[insert+1:], k.rcvBuf[insert:])
+	k.rcvBuf[insert] = newseg
+	k.moveToRcvQueue()
+}
+
+// moveToRcvQueue moves the segments received in order to the receive queue
+func (k *kcp) moveToRcvQueue() {
+	count := 0
+	for i := range k.rcvBuf {
+		seg := &k.rcvBuf[i]
+		if seg.sn != k.rcvNxt || len(k.rcvQueue)+count >= int(k.rcvWnd) {
+			break
+		}
+		k.rcvNxt++
+		count++
+	}
+	if count > 0 {
+		k.rcvQueue = append(k.rcvQueue, k.rcvBuf[:count]...)
+		k.rcvBuf = removeFront(k.rcvBuf, count)
+	}
+}
+
+// input handles a packet received from the peer, it returns a negative
+// value if the packet is invalid
+func (k *kcp) input(data []byte) int {
+	prevUna := k.sndUna
+	var maxack uint32
+	acked := false
+
+	if len(data) < overhead {
+		return -1
+	}
+
+	for len(data) >= overhead {
+		conv := binary.LittleEndian.Uint32(data)
+		if conv != k.conv {
+			return -1
+		}
+		cmd := data[4]
+		frg := data[5]
+		wnd := binary.LittleEndian.Uint16(data[6:])
+		ts := binary.LittleEndian.Uint32(data[8:])
+		sn := binary.LittleEndian.Uint32(data[12:])
+		una := binary.LittleEndian.Uint32(data[16:])
+		length := binary.LittleEndian.Uint32(data[20:])
+		data = data[overhead:]
+
+		if uint32(len(data)) < length {
+			return -2
+		}
+		if cmd != cmdPush && cmd != cmdAck && cmd != cmdWindowAsk && cmd != cmdWindowTel {
+			return -3
+		}
+
+		k.rmtWnd = uint32(wnd)
+		k.parseUna(una)
+		k.shrinkBuf()
+
+		switch cmd {
+		case cmdAck:
+			if rtt := timediff(k.current, ts); rtt >= 0 {
+				k.updateAck(rtt)
+			}
+			k.parseAck(sn)
+			k.shrinkBuf()
+			if !acked || timediff(sn, maxack) > 0 {
+				acked = true
+				maxack = sn
+			}
+		case cmdPush:
+			if timediff(sn, k.rcvNxt+k.rcvWnd) < 0 {
+				k.acklist = append(k.acklist, ackItem{sn, ts})
+				if timediff(sn, k.rcvNxt) >= 0 {
+					seg := segment{
+						conv: conv,
+						cmd:  cmd,
+						frg:  frg,
+						wnd:  wnd,
+						ts:   ts,
+						sn:   sn,
+						una:  una,
+						data: make([]byte, length),
+					}
+					copy(seg.data, data[:length])
+					k.parseData(seg)
+				}
+			}
+		case cmdWindowAsk:
+			k.probe |= askTell
+		case cmdWindowTel:
+			// the window size was already read
+		}
+
+		data = data[length:]
+	}
+
+	if acked {
+		k.parseFastack(maxack)
+	}
+
+	// grow the congestion window for acknowledged data
+	if timediff(k.sndUna, prevUna) > 0 && k.cwnd < k.rmtWnd {
+		mss := k.mss
+		if k.cwnd < k.ssthresh {
+			k.cwnd++
+			k.incr += mss
+		} else {
+			if k.incr < mss {
+				k.incr = mss
+			}
+			k.incr += (mss*mss)/k.incr + mss/16
+			if (k.cwnd+1)*mss <= k.incr {
+				k.cwnd = (k.incr + mss - 1) / mss
+			}
+		}
+		if k.cwnd > k.rmtWnd {
+			k.cwnd = k.rmtWnd
+			k.incr = k.rmtWnd * mss
+		}
+	}
+	return 0
+}
+
+func (k *kcp) wndUnused() uint16 {
+	if len(k.rcvQueue) < int(k.rcvWnd) {
+		return uint16(int(k.rcvWnd) - len(k.rcvQueue))
+	}
+	return 0
+}
+
+// flush sends the pending acks, window probes and segments
+func (k *kcp) flush() {
+	current := k.current
+	seg := segment{conv: k.conv, cmd: cmdAck, wnd: k.wndUnused(), una: k.rcvNxt}
+
+	buf := k.buffer
+	ptr := 0
+	makeSpace := func(space int) {
+		if ptr+space > int(k.mtu) {
+			k.output(buf[:ptr])
+			ptr = 0
+		}
+	}
+
+	for _, ack := range k.acklist {
+		makeSpace(overhead)
+		seg.sn, seg.ts = ack.sn, ack.ts
+		seg.encode(buf[ptr:])
+		ptr += overhead
+	}
+	k.acklist = k.acklist[:0]
+
+	// probe the window size while the peer has no room
+	if k.rmtWnd == 0 {
+		if k.probeWait == 0 {
+			k.probeWait = probeInit
+			k.tsProbe = current + k.probeWait
+		} else if timediff(current, k.tsProbe) >= 0 {
+			if k.probeWait < probeInit {
+				k.probeWait = probeInit
+			}
+			k.probeWait += k.probeWait / 2
+			if k.probeWait > probeLimit {
+				k.probeWait = probeLimit
+			}
+			k.tsProbe = current + k.probeWait
+			k.probe |= askSend
+		}
+	} else {
+		k.tsProbe = 0
+		k.probeWait = 0
+	}
+
+	if k.probe&askSend != 0 {
+		seg.cmd = cmdWindowAsk
+		makeSpace(overhead)
+		seg.encode(buf[ptr:])
+		ptr += overhead
+	}
+	if k.probe&askTell != 0 {
+		seg.cmd = cmdWindowTel
+		makeSpace(overhead)
+		seg.encode(buf[ptr:])
+		ptr += overhead
+	}
+	k.probe = 0
+
+	cwnd := umin(k.sndWnd, k.rmtWnd)
+	if k.nocwnd == 0 {
+		cwnd = umin(k.cwnd, cwnd)
+	}
+
+	// move the segments inside the window to the send buffer
+	count := 0
+	for i := range k.sndQueue {
+		if timediff(k.sndNxt, k.sndUna+cwnd) >= 0 {
+			break
+		}
+		newseg := k.sndQueue[i]
+		newseg.conv = k.conv
+		newseg.cmd = cmdPush
+		newseg.sn = k.sndNxt
+		k.sndBuf = append(k.sndBuf, newseg)
+		k.sndNxt++
+		count++
+	}
+	k.sndQueue = removeFront(k.sndQueue, count)
+
+	resent := uint32(k.fastresend)
+	if k.fastresend <= 0 {
+		resent = 0xFFFFFFFF
+	}
+	rtomin := k.rxRto >> 3
+	if k.nodelay != 0 {
+		rtomin = 0
+	}
+
+	change, lost := false, false
+	for i := range k.sndBuf {
+		segment := &k.sndBuf[i]
+		needsend := false
+		if segment.xmit == 0 {
+			needsend = true
+			segment.rto = k.rxRto
+			segment.resendts = current + segment.rto + rtomin
+		} else if timediff(current, segment.resendts) >= 0 {
+			needsend = true
+			k.xmit++
+			if k.nodelay == 0 {
+				segment.rto += umax(segment.rto, k.rxRto)
+			} else if k.nodelay < 2 {
+				segment.rto += segment.rto / 2
+			} else {
+				segment.rto += k.rxRto / 2
+			}
+			segment.resendts = current + segment.rto
+			lost = true
+		} else if segment.fastack >= resent && (segment.xmit <= uint32(k.fastlimit) || k.fastlimit <= 0) {
+			needsend = true
+			segment.fastack = 0
+			segment.resendts = current + segment.rto
+			change = true
+		}
+
+		if needsend {
+			segment.xmit++
+			segment.ts = current
+			segment.wnd = seg.wnd
+			segment.una = k.rcvNxt
+
+			makeSpace(overhead + len(segment.data))
+			segment.encode(buf[ptr:])
+			ptr += overhead
+			ptr += copy(buf[ptr:], segment.data)
+
+			if segment.xmit >= k.deadLink {
+				k.state = stateDead
+			}
+		}
+	}
+
+	if ptr > 0 {
+		k.output(buf[:ptr])
+	}
+
+	// congestion control, fast retransmissions halve the window and
+	// timeouts collapse it
+	if change {
+		inflight := k.sndNxt - k.sndUna
+		k.ssthresh = inflight / 2
+		if k.ssthresh < threshMin {
+			k.ssthresh = threshMin
+		}
+		k.cwnd = k.ssthresh + resent
+		k.incr = k.cwnd * k.mss
+	}
+	if lost {
+		k.ssthresh = cwnd / 2
+		if k.ssthresh < threshMin {
+			k.ssthresh = threshMin
+		}
+		k.cwnd = 1
+		k.incr = k.mss
+	}
+	if k.cwnd < 1 {
+		k.cwnd = 1
+		k.incr = k.mss
+	}
+}
+
+// update advances the clock of the link to current, in milliseconds, and
+// flushes it every interval
+func (k *kcp) update(current uint32) {
+	k.current = current
+	if k.updated == 0 {
+		k.updated = 1
+		k.tsFlush = current
+	}
+
+	slap := timediff(current, k.tsFlush)
+	if slap >= 10000 || slap < -10000 {
+		k.tsFlush = current
+		slap = 0
+	}
+
+	if slap >= 0 {
+		k.tsFlush += k.interval
+		if timediff(current, k.tsFlush) >= 0 {
+			k.tsFlush = current + k.interval
+		}
+		k.flush()
+	}
+}
+
+// setNoDelay tunes the link for latency: nodelay lowers the minimum rto,
+// interval is the flush interval in milliseconds, resend is the number of
+// acks skipping a segment that fast retransmit it and nc disables the
+// congestion window
+func (k *kcp) setNoDelay(nodelay, interval, resend, nc int) {
+	k.nodelay = uint32(nodelay)
+	if nodelay != 0 {
+		k.rxMinrto = rtoNoDelay
+	} else {
+		k.rxMinrto = rtoMin
+	}
+	k.interval = ubound(10, uint32(interval), 5000)
+	k.fastresend = int32(resend)
+	k.nocwnd = int32(nc)
+}
+
+func (k *kcp) setWndSize(snd, rcv int) {
+	k.sndWnd = uint32(snd)
+	k.rcvWnd = umax(uint32(rcv), wndRcv)
+}
+
+// waitSnd returns the number of segments not acknowledged yet
+func (k *kcp) waitSnd() int {
+	return len(k.sndBuf) + len(k.sndQueue)
+}
+
+func removeFront(q []segment, n int) []segment {
+	if n == 0 {
+		return q
+	}
+	remaining := copy(q, q[n:])
+	for i := remaining; i < len(q); i++ {
+		q[i] = segment{}
+	}
+	return q[:remaining]
+}
+
+func umin(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func umax(a, b uint32) uint32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func ubound(lower, middle, upper uint32) uint32 {
+	return umin(umax(lower, middle), upper)
+}
@@ -0,0 +1,169 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package kcp
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// link connects two kcp instances, dropping a share of the packets
+type link struct {
+	rnd     *rand.Rand
+	loss    float64
+	packets [][]byte
+}
+
+func (l *link) output(buf []byte) {
+	if l.rnd.Float64() < l.loss {
+		return
+	}
+	l.packets = append(l.packets, append([]byte{}, buf...))
+}
+
+func (l *link) deliver(k *kcp) {
+	packets := l.packets
+	l.packets = nil
+	for _, p := range packets {
+		k.input(p)
+	}
+}
+
+func newLinkedKCPs(loss float64, stream bool) (*kcp, *kcp, *link, *link) {
+	rnd := rand.New(rand.NewSource(1))
+	ab := &link{rnd: rnd, loss: loss}
+	ba := &link{rnd: rnd, loss: loss}
+	a := newKCP(42, ab.output)
+	b := newKCP(42, ba.output)
+	for _, k := range []*kcp{a, b} {
+		k.setNoDelay(1, 10, 2, 1)
+		if stream {
+			k.stream = 1
+		}
+	}
+	return a, b, ab, ba
+}
+
+func TestKCPDeliversInOrder(t *testing.T) {
+	tables := []struct {
+		name   string
+		loss   float64
+		stream bool
+	}{
+		{"no_loss", 0, false},
+		{"loss", 0.3, false},
+		{"stream_no_loss", 0, true},
+		{"stream_loss", 0.3, true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			a, b, ab, ba := newLinkedKCPs(table.loss, table.stream)
+
+			var sent bytes.Buffer
+			for i := 0; i < 200; i++ {
+				msg := bytes.Repeat([]byte(fmt.Sprintf("message %d;", i)), i%300+1)
+				sent.Write(msg)
+				assert.Equal(t, 0, a.send(msg))
+			}
+
+			var received bytes.Buffer
+			buf := make([]byte, 1<<20)
+			for current := uint32(0); current < 60000 && received.Len() < sent.Len(); current += 10 {
+				a.update(current)
+				b.update(current)
+				ab.deliver(b)
+				ba.deliver(a)
+				for n := b.recv(buf); n > 0; n = b.recv(buf) {
+					received.Write(buf[:n])
+				}
+			}
+
+			assert.Equal(t, sent.Bytes(), received.Bytes())
+			assert.NotEqual(t, uint32(stateDead), a.state)
+		})
+	}
+}
+
+func TestKCPMessages(t *testing.T) {
+	a, b, ab, _ := newLinkedKCPs(0, false)
+
+	large := bytes.Repeat([]byte("a"), 3*int(a.mss)+10)
+	assert.Equal(t, -1, a.send(nil))
+	assert.Equal(t, -2, a.send(make([]byte, wndRcv*int(a.mss))))
+	assert.Equal(t, 0, a.send([]byte("small")))
+	assert.Equal(t, 0, a.send(large))
+
+	a.update(0)
+	ab.deliver(b)
+
+	assert.Equal(t, 5, b.peekSize())
+	assert.Equal(t, -2, b.recv(make([]byte, 4)))
+	buf := make([]byte, len(large))
+	assert.Equal(t, 5, b.recv(buf))
+	assert.Equal(t, "small", string(buf[:5]))
+	assert.Equal(t, len(large), b.peekSize())
+	assert.Equal(t, len(large), b.recv(buf))
+	assert.Equal(t, large, buf)
+	assert.Equal(t, -1, b.recv(buf))
+}
+
+func TestKCPInputRejectsInvalidPackets(t *testing.T) {
+	a, b, ab, _ := newLinkedKCPs(0, false)
+	a.send([]byte("data"))
+	a.update(0)
+	packet := ab.packets[0]
+
+	other := newKCP(7, func([]byte) {})
+	tables := []struct {
+		name   string
+		k      *kcp
+		packet []byte
+		ret    int
+	}{
+		{"short", b, packet[:overhead-1], -1},
+		{"other_conv", other, packet, -1},
+		{"truncated", b, packet[:len(packet)-1], -2},
+		{"unknown_command", b, append(append([]byte{}, packet[:4]...), append([]byte{99}, packet[5:]...)...), -3},
+		{"valid", b, packet, 0},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			assert.Equal(t, table.ret, table.k.input(table.packet))
+		})
+	}
+}
+
+func TestKCPDeadLink(t *testing.T) {
+	a, _, ab, _ := newLinkedKCPs(1, false)
+	a.send([]byte("data"))
+
+	for current := uint32(0); current < 5000000 && a.state != stateDead; current += 50 {
+		a.update(current)
+	}
+	assert.Equal(t, uint32(stateDead), a.state)
+	assert.Empty(t, ab.packets)
+}
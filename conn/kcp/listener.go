@@ -0,0 +1,184 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package kcp
+
+import (
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// acceptBacklog is how many connections wait to be accepted before new
+// ones are refused
+const acceptBacklog = 128
+
+// Listener accepts KCP connections on a UDP address, telling the peers
+// apart by their address
+type Listener struct {
+	pconn     net.PacketConn
+	mu        sync.Mutex
+	conns     map[string]*Conn
+	chAccept  chan *Conn
+	chDie     chan struct{}
+	closeOnce sync.Once
+}
+
+// Listen listens for KCP connections on the UDP address addr
+func Listen(addr string) (*Listener, error) {
+	pconn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		pconn:    pconn,
+		conns:    make(map[string]*Conn),
+		chAccept: make(chan *Conn, acceptBacklog),
+		chDie:    make(chan struct{}),
+	}
+	go l.serve()
+	return l, nil
+}
+
+func (l *Listener) serve() {
+	buf := make([]byte, mtuLimit)
+	for {
+		n, from, err := l.pconn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-l.chDie:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			l.Close()
+			return
+		}
+		l.dispatch(buf[:n], from)
+	}
+}
+
+// dispatch hands a packet to the connection of its sender, creating the
+// connection when the packet opens a new one
+func (l *Listener) dispatch(data []byte, from net.Addr) {
+	key := from.String()
+	l.mu.Lock()
+	conn, ok := l.conns[key]
+	if !ok {
+		if !opens(data) {
+			l.mu.Unlock()
+			return
+		}
+		conv := binary.LittleEndian.Uint32(data)
+		conn = newConn(conv, l.pconn, from, func() { l.remove(key, conn) })
+		select {
+		case l.chAccept <- conn:
+			l.conns[key] = conn
+		default:
+			// the backlog is full
+			conn.Close()
+			l.mu.Unlock()
+			return
+		}
+	}
+	l.mu.Unlock()
+
+	conn.input(data)
+}
+
+// opens returns whether data starts with the first segment sent by a peer,
+// other packets from unknown addresses belong to connections already gone
+func opens(data []byte) bool {
+	return len(data) >= overhead && data[4] == cmdPush && binary.LittleEndian.Uint32(data[12:]) == 0
+}
+
+func (l *Listener) remove(key string, conn *Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[key] == conn {
+		delete(l.conns, key)
+	}
+}
+
+// Accept waits for the next connection
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.chAccept:
+		return conn, nil
+	case <-l.chDie:
+		return nil, io.ErrClosedPipe
+	}
+}
+
+// Close stops listening, closing the connections of the listener
+func (l *Listener) Close() error {
+	err := io.ErrClosedPipe
+	l.closeOnce.Do(func() {
+		close(l.chDie)
+		err = l.pconn.Close()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, conn := range l.conns {
+			conn.Close()
+		}
+	})
+	return err
+}
+
+// Addr returns the address the listener listens on
+func (l *Listener) Addr() net.Addr {
+	return l.pconn.LocalAddr()
+}
+
+// Dial connects to the KCP listener at the UDP address addr
+func Dial(addr string) (net.Conn, error) {
+	remote, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	pconn, err := net.ListenPacket("udp", "")
+	if err != nil {
+		return nil, err
+	}
+
+	conv := rand.New(rand.NewSource(time.Now().UnixNano())).Uint32()
+	conn := newConn(conv, pconn, remote, func() { pconn.Close() })
+	go func() {
+		buf := make([]byte, mtuLimit)
+		for {
+			n, from, err := pconn.ReadFrom(buf)
+			if err != nil {
+				conn.Close()
+				return
+			}
+			if from.String() == remote.String() {
+				conn.input(buf[:n])
+			}
+		}
+	}()
+	return conn, nil
+}
@@ -27,6 +27,7 @@ import (
 )
 
 // Type represents the type of message, which could be Request/Notify/Response/Push
+// or ServerRequest/ClientResponse
 type Type byte
 
 // Message types
@@ -35,6 +36,11 @@ const (
 	Notify   Type = 0x01
 	Response Type = 0x02
 	Push     Type = 0x03
+	// ServerRequest is a request sent by the server to the client, its ids
+	// are not shared with the requests of the client
+	ServerRequest Type = 0x04
+	// ClientResponse is the response of the client to a ServerRequest
+	ClientResponse Type = 0x05
 )
 
 const (
@@ -47,10 +53,12 @@ const (
 )
 
 var types = map[Type]string{
-	Request:  "Request",
-	Notify:   "Notify",
-	Response: "Response",
-	Push:     "Push",
+	Request:        "Request",
+	Notify:         "Notify",
+	Response:       "Response",
+	Push:           "Push",
+	ServerRequest:  "ServerRequest",
+	ClientResponse: "ClientResponse",
 }
 
 var (
@@ -97,11 +105,15 @@ func (m *Message) String() string {
 }
 
 func routable(t Type) bool {
-	return t == Request || t == Notify || t == Push
+	return t == Request || t == Notify || t == Push || t == ServerRequest
+}
+
+func hasID(t Type) bool {
+	return t == Request || t == Response || t == ServerRequest || t == ClientResponse
 }
 
 func invalidType(t Type) bool {
-	return t < Request || t > Push
+	return t < Request || t > ClientResponse
 
 }
 
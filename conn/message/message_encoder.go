@@ -51,14 +51,16 @@ func (me *MessagesEncoder) IsCompressionEnabled() bool {
 // Encode marshals message to binary format. Different message types is corresponding to
 // different message header, message types is identified by 2-4 bit of flag field. The
 // relationship between message types and message header is presented as follows:
-// ------------------------------------------
-// |   type   |  flag  |       other        |
-// |----------|--------|--------------------|
-// | request  |----000-|<message id>|<route>|
-// | notify   |----001-|<route>             |
-// | response |----010-|<message id>        |
-// | push     |----011-|<route>             |
-// ------------------------------------------
+// ------------------------------------------------
+// |      type       |  flag  |       other        |
+// |-----------------|--------|--------------------|
+// | request         |----000-|<message id>|<route>|
+// | notify          |----001-|<route>             |
+// | response        |----010-|<message id>        |
+// | push            |----011-|<route>             |
+// | server request  |----100-|<message id>|<route>|
+// | client response |----101-|<message id>        |
+// ------------------------------------------------
 // The figure above indicates that the bit does not affect the type of message.
 // See ref: https://github.com/tutumagi/pitaya/blob/master/docs/communication_protocol.md
 func (me *MessagesEncoder) Encode(message *Message) ([]byte, error) {
@@ -80,7 +82,7 @@ func (me *MessagesEncoder) Encode(message *Message) ([]byte, error) {
 
 	buf = append(buf, flag)
 
-	if message.Type == Request || message.Type == Response {
+	if hasID(message.Type) {
 		n := message.ID
 		// variant length encode
 		for {
@@ -141,7 +143,7 @@ func Decode(data []byte) (*Message, error) {
 		return nil, ErrWrongMessageType
 	}
 
-	if m.Type == Request || m.Type == Response {
+	if hasID(m.Type) {
 		id := uint(0)
 		// little end byte order
 		// WARNING: must can be stored in 64 bits integer
@@ -52,6 +52,11 @@ var encodeTables = map[string]struct {
 	"test_reponse_type_with_id":   {&Message{Type: Response, ID: 129, Data: []byte{}}, nil, false, 0x0, nil},
 
 	"test_reponse_type_with_error": {&Message{Type: Response, Data: []byte{0x01}, Err: true}, nil, true, 0x0, nil},
+
+	"test_server_request_type":  {&Message{Type: ServerRequest, ID: 129, Route: "a", Data: []byte{0x01}}, nil, false, 0x0, nil},
+	"test_client_response_type": {&Message{Type: ClientResponse, ID: 129, Data: []byte{0x01}}, nil, false, 0x0, nil},
+	"test_client_response_type_with_error": {&Message{Type: ClientResponse, ID: 1, Data: []byte{0x01}, Err: true},
+		nil, true, 0x0, nil},
 	"test_must_gzip": {&Message{Type: Response,
 		Data: []byte("blablablablablablablablablablablablabla"), Err: true}, nil, true, 0x10, nil},
 }
@@ -113,6 +118,11 @@ var decodeTables = map[string]struct {
 	"test_reponse_type_with_id":   {&Message{Type: Response, ID: 129, Data: []byte{}}, nil, false, 0x0, nil},
 
 	"test_reponse_type_with_error": {&Message{Type: Response, Data: []byte{0x01}, Err: true}, nil, true, 0x0, nil},
+
+	"test_server_request_type":  {&Message{Type: ServerRequest, ID: 129, Route: "a", Data: []byte{0x01}}, nil, false, 0x0, nil},
+	"test_client_response_type": {&Message{Type: ClientResponse, ID: 129, Data: []byte{0x01}}, nil, false, 0x0, nil},
+	"test_client_response_type_with_error": {&Message{Type: ClientResponse, ID: 1, Data: []byte{0x01}, Err: true},
+		nil, true, 0x0, nil},
 	"test_must_gzip": {&Message{Type: Response,
 		Data: []byte("blablablablablablablablablablablablabla"), Err: true}, nil, true, 0x10, nil},
 }
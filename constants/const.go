@@ -39,8 +39,15 @@ const (
 	// SessionBindRoute is the route used for binding session
 	SessionBindRoute = "sys.bindsession"
 
+	// SessionBindRoleRoute is the route used for binding a role to a session
+	SessionBindRoleRoute = "sys.bindrole"
+
 	// KickRoute is the route used for kicking an user
 	KickRoute = "sys.kick"
+
+	// RequestClientRoute is the route used for sending requests to the
+	// client of an user
+	RequestClientRoute = "sys.requestclient"
 )
 
 // SessionCtxKey is the context key where the session will be set
@@ -68,6 +75,10 @@ var PeerServiceKey = "peer.service"
 // StartTimeKey is the key holding the request start time (in ns) to be sent over the context
 var StartTimeKey = "req-start-time"
 
+// DeadlineKey is the key holding the time (in ns) left until the deadline
+// of the request to be sent over the context
+var DeadlineKey = "req-deadline"
+
 // RequestIDKey is the key holding the request id to be sent over the context
 var RequestIDKey = "request.id"
 
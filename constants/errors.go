@@ -29,6 +29,8 @@ var (
 	ErrBufferExceed                   = errors.New("session send buffer exceed")
 	ErrChangeDictionaryWhileRunning   = errors.New("you shouldn't change the dictionary while the app is already running")
 	ErrChangeRouteWhileRunning        = errors.New("you shouldn't change routes while app is already running")
+	ErrClientRequestTimeout           = errors.New("client did not answer the request in time")
+	ErrClientRequestsNotSupported     = errors.New("session can not send requests to its client")
 	ErrCloseClosedGroup               = errors.New("close closed group")
 	ErrCloseClosedSession             = errors.New("close closed session")
 	ErrClosedGroup                    = errors.New("group closed")
@@ -39,9 +41,13 @@ var (
 	ErrFrontendTypeNotSpecified       = errors.New("for using SendPushToUsers from a backend server you have to specify a valid frontendType")
 	ErrGroupAlreadyExists             = errors.New("group already exists")
 	ErrGroupNotFound                  = errors.New("group not found")
+	ErrIllegalRoleID                  = errors.New("illegal role id")
 	ErrIllegalUID                     = errors.New("illegal uid")
+	ErrInvalidResumeToken             = errors.New("invalid or expired resume token")
 	ErrInvalidCertificates            = errors.New("certificates must be exactly two")
 	ErrInvalidSpanCarrier             = errors.New("tracing: invalid span carrier")
+	ErrKickingRoles                   = errors.New("failed to kick roles, check array with failed role ids")
+	ErrKickingSessions                = errors.New("failed to kick sessions, check array with failed session ids")
 	ErrKickingUsers                   = errors.New("failed to kick users, check array with failed uids")
 	ErrMemberAlreadyExists            = errors.New("member already exists in group")
 	ErrMemberNotFound                 = errors.New("member not found in the group")
@@ -64,6 +70,9 @@ var (
 	ErrNotifyOnRequest                = errors.New("tried to notify a request route")
 	ErrOnCloseBackend                 = errors.New("onclose callbacks are not allowed on backend servers")
 	ErrProtodescriptor                = errors.New("failed to get protobuf message descriptor")
+	ErrPushReplaced                   = errors.New("push replaced by a later push of the route")
+	ErrPushingToRoles                 = errors.New("failed to push message to roles, check array with failed role ids")
+	ErrPushingToSessions              = errors.New("failed to push message to sessions, check array with failed session ids")
 	ErrPushingToUsers                 = errors.New("failed to push message to users, check array with failed uids")
 	ErrRPCClientNotInitialized        = errors.New("RPC client is not running")
 	ErrRPCJobAlreadyRegistered        = errors.New("rpc job was already registered")
@@ -71,14 +80,23 @@ var (
 	ErrRPCServerNotInitialized        = errors.New("RPC server is not running")
 	ErrReplyShouldBeNotNull           = errors.New("reply must not be null")
 	ErrReplyShouldBePtr               = errors.New("reply must be a pointer")
+	ErrRequestDeadlineExceeded        = errors.New("request deadline exceeded")
 	ErrRequestOnNotify                = errors.New("tried to request a notify route")
 	ErrRouterNotInitialized           = errors.New("router is not initialized")
 	ErrServerNotFound                 = errors.New("server not found")
 	ErrServiceDiscoveryNotInitialized = errors.New("service discovery client is not initialized")
+	ErrRoleMessagesOverflow           = errors.New("too many pending messages for the session")
+	ErrSessionClosed                  = errors.New("session is closed")
 	ErrSessionAlreadyBound            = errors.New("session is already bound to an uid")
+	ErrSessionAlreadyBoundToRole      = errors.New("session is already bound to a role")
+	ErrSessionVersionConflict         = errors.New("session data was changed by another server")
 	ErrSessionDuplication             = errors.New("session exists in the current group")
 	ErrSessionNotFound                = errors.New("session not found")
+	ErrSessionNotStoreOwner           = errors.New("session data is owned by another session in the store")
 	ErrSessionOnNotify                = errors.New("current session working on notify mode")
+	ErrSettingSessionData             = errors.New("failed to set session data, check array with failed session ids")
+	ErrSlowConsumer                   = errors.New("client is not reading its messages in time")
+	ErrTimerBackend                   = errors.New("session timers are not allowed on backend servers")
 	ErrTimeoutTerminatingBinaryModule = errors.New("timeout waiting to binary module to die")
 	ErrWrongValueType                 = errors.New("protobuf: convert on wrong type value")
 	ErrRateLimitExceeded              = errors.New("rate limit exceeded")
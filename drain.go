@@ -0,0 +1,116 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pitaya
+
+import (
+	"os"
+	"time"
+
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/session"
+	"github.com/tutumagi/pitaya/util"
+)
+
+// drainCheckInterval is how often a draining server checks if it is empty
+var drainCheckInterval = 100 * time.Millisecond
+
+// SetDrainMessage sets the message pushed to the connected clients when the
+// server starts draining, e.g. to tell them to reconnect to another server
+func SetDrainMessage(route string, v interface{}) {
+	app.drainRoute = route
+	app.drainMessage = v
+}
+
+// Drain makes the server stop taking new clients and shut down once the
+// connected clients leave, or after pitaya.drain.timeout at most
+func Drain() {
+	select {
+	case <-app.drainChan: // prevent closing closed channel
+	default:
+		close(app.drainChan)
+	}
+}
+
+// IsDraining returns whether the server is draining
+func IsDraining() bool {
+	select {
+	case <-app.drainChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// drain removes the server from service discovery, stops the acceptors and
+// waits for the sessions to leave and for the requests being processed to
+// finish, up to pitaya.drain.timeout. Another signal or a shutdown stops
+// the wait
+func drain(sg <-chan os.Signal) {
+	timeout := app.config.GetDuration("pitaya.drain.timeout")
+	logger.Log.Warnf("draining server for up to %s", timeout)
+
+	if app.serviceDiscovery != nil {
+		if err := app.serviceDiscovery.Deregister(); err != nil {
+			logger.Log.Errorf("failed to remove server from service discovery: %s", err.Error())
+		}
+	}
+
+	for _, acc := range app.acceptors {
+		acc.Stop()
+	}
+
+	if app.drainRoute != "" {
+		data, err := util.SerializeOrRaw(app.serializer, app.drainMessage)
+		if err != nil {
+			logger.Log.Errorf("failed to serialize drain message: %s", err.Error())
+		} else if _, err := session.PushToSessions(app.drainRoute, data); err != nil {
+			logger.Log.Errorf("failed to push drain message: %s", err.Error())
+		}
+	}
+
+	deadline := app.clock.Now().Add(timeout)
+	ticker := app.clock.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+	for !drained() {
+		if !app.clock.Now().Before(deadline) {
+			logger.Log.Warnf("drain timed out with %d sessions connected", session.Count())
+			return
+		}
+		select {
+		case <-ticker.C():
+		case s := <-sg:
+			logger.Log.Warn("got signal: ", s, ", shutting down without draining")
+			return
+		case <-app.dieChan:
+			logger.Log.Warn("shutdown while draining")
+			return
+		}
+	}
+	logger.Log.Info("server drained")
+}
+
+func drained() bool {
+	if handlerService != nil && handlerService.InFlight() > 0 {
+		return false
+	}
+	// sessions waiting to be resumed are not counted
+	return session.Count() == 0
+}
@@ -0,0 +1,180 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pitaya
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/acceptor"
+	"github.com/tutumagi/pitaya/clock"
+	clustermocks "github.com/tutumagi/pitaya/cluster/mocks"
+	"github.com/tutumagi/pitaya/config"
+	"github.com/tutumagi/pitaya/mocks"
+	"github.com/tutumagi/pitaya/session"
+	sessionmocks "github.com/tutumagi/pitaya/session/mocks"
+)
+
+// startDrain runs drain with a manual clock, returning the clock and a
+// channel closed when drain returns
+func startDrain(timeout time.Duration) (*clock.Manual, chan bool) {
+	return startDrainWithSignals(timeout, nil)
+}
+
+// startDrainWithSignals runs drain as startDrain, stopped by the signals of sg
+func startDrainWithSignals(timeout time.Duration, sg chan os.Signal) (*clock.Manual, chan bool) {
+	cfg := viper.New()
+	cfg.Set("pitaya.drain.timeout", timeout)
+	app.config = config.NewConfig(cfg)
+	m := clock.NewManual(time.Now())
+	app.clock = m
+
+	done := make(chan bool)
+	go func() {
+		drain(sg)
+		close(done)
+	}()
+	return m, done
+}
+
+// advanceUntil advances the clock until drain returns
+func advanceUntil(t *testing.T, m *clock.Manual, done chan bool, step time.Duration) {
+	for i := 0; i < 100; i++ {
+		m.Advance(step)
+		select {
+		case <-done:
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	t.Fatal("drain did not finish")
+}
+
+func TestDrain(t *testing.T) {
+	initApp()
+	defer initApp()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sd := clustermocks.NewMockServiceDiscovery(ctrl)
+	acc := mocks.NewMockAcceptor(ctrl)
+	app.serviceDiscovery = sd
+	app.acceptors = []acceptor.Acceptor{acc}
+	SetDrainMessage("onMigrate", []byte("bye"))
+
+	entity := sessionmocks.NewMockNetworkEntity(ctrl)
+	s := session.New(entity, true)
+
+	pushed := make(chan bool)
+	sd.EXPECT().Deregister()
+	acc.EXPECT().Stop()
+	entity.EXPECT().Push("onMigrate", []byte("bye")).Do(func(string, interface{}) { close(pushed) })
+
+	m, done := startDrain(time.Minute)
+	<-pushed
+
+	// drain waits for the client to leave
+	m.Advance(drainCheckInterval)
+	select {
+	case <-done:
+		t.Fatal("drain finished with a session connected")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	entity.EXPECT().Close()
+	s.Close()
+	advanceUntil(t, m, done, drainCheckInterval)
+}
+
+func TestDrainTimeout(t *testing.T) {
+	initApp()
+	defer initApp()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := sessionmocks.NewMockNetworkEntity(ctrl)
+	s := session.New(entity, true)
+
+	m, done := startDrain(time.Minute)
+	advanceUntil(t, m, done, 10*time.Second)
+	assert.NotNil(t, session.GetSessionByID(s.ID()))
+
+	entity.EXPECT().Close()
+	s.Close()
+}
+
+func TestDrainStoppedBySignal(t *testing.T) {
+	initApp()
+	defer initApp()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := sessionmocks.NewMockNetworkEntity(ctrl)
+	s := session.New(entity, true)
+
+	sg := make(chan os.Signal, 1)
+	_, done := startDrainWithSignals(time.Minute, sg)
+	sg <- syscall.SIGTERM
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("drain ignored the signal")
+	}
+
+	entity.EXPECT().Close()
+	s.Close()
+}
+
+func TestDrainStoppedByShutdown(t *testing.T) {
+	initApp()
+	defer initApp()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := sessionmocks.NewMockNetworkEntity(ctrl)
+	s := session.New(entity, true)
+
+	_, done := startDrain(time.Minute)
+	Shutdown()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("drain ignored the shutdown")
+	}
+
+	entity.EXPECT().Close()
+	s.Close()
+}
+
+func TestDrainAPI(t *testing.T) {
+	initApp()
+	defer initApp()
+
+	assert.False(t, IsDraining())
+	Drain()
+	Drain()
+	assert.True(t, IsDraining())
+}
@@ -36,6 +36,14 @@ const ErrBadRequestCode = "PIT_400"
 // ErrClientClosedRequest is a string code representing the client closed request error
 const ErrClientClosedRequest = "PIT_499"
 
+// ErrDeadlineExceededCode is a string code representing a request that
+// exceeded its deadline
+const ErrDeadlineExceededCode = "PIT_504"
+
+// ErrTooManyRequestsCode is a string code representing a request dropped
+// because too many were pending
+const ErrTooManyRequestsCode = "PIT_429"
+
 // Error is an error with a code, message and metadata
 type Error struct {
 	Code     string
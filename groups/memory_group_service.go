@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/config"
 	"github.com/tutumagi/pitaya/constants"
 )
@@ -17,6 +18,7 @@ var (
 
 // MemoryGroupService base in server memory solution
 type MemoryGroupService struct {
+	clock clock.Clock
 }
 
 // MemoryGroup is the struct stored in each group key(which is the name of the group)
@@ -26,24 +28,37 @@ type MemoryGroup struct {
 	TTL         int64
 }
 
-// NewMemoryGroupService returns a new group instance
-func NewMemoryGroupService(conf *config.Config) *MemoryGroupService {
+// NewMemoryGroupService returns a new group instance, TTLs are measured
+// with the real clock unless a clock is given
+func NewMemoryGroupService(conf *config.Config, clockOrNil ...clock.Clock) *MemoryGroupService {
+	c := &MemoryGroupService{clock: clock.New()}
+	if len(clockOrNil) > 0 && clockOrNil[0] != nil {
+		c.clock = clockOrNil[0]
+	}
+
 	memoryOnce.Do(func() {
 		memoryGroups = make(map[string]*MemoryGroup)
-		go groupTTLCleanup(conf)
+		go groupTTLCleanup(conf, c.clock)
 	})
-	return &MemoryGroupService{}
+	return c
+}
+
+func groupTTLCleanup(conf *config.Config, clk clock.Clock) {
+	ticker := clk.NewTicker(conf.GetDuration("pitaya.groups.memory.tickduration"))
+	for now := range ticker.C() {
+		cleanupExpiredGroups(now)
+	}
 }
 
-func groupTTLCleanup(conf *config.Config) {
-	for now := range time.Tick(conf.GetDuration("pitaya.groups.memory.tickduration")) {
-		memoryGroupsMu.Lock()
-		for groupName, mg := range memoryGroups {
-			if mg.TTL != 0 && now.UnixNano()-mg.LastRefresh > mg.TTL {
-				delete(memoryGroups, groupName)
-			}
+// cleanupExpiredGroups deletes the groups whose TTL expired at now
+func cleanupExpiredGroups(now time.Time) {
+	memoryGroupsMu.Lock()
+	defer memoryGroupsMu.Unlock()
+
+	for groupName, mg := range memoryGroups {
+		if mg.TTL != 0 && now.UnixNano()-mg.LastRefresh > mg.TTL {
+			delete(memoryGroups, groupName)
 		}
-		memoryGroupsMu.Unlock()
 	}
 }
 
@@ -69,7 +84,7 @@ func (c *MemoryGroupService) GroupCreateWithTTL(ctx context.Context, groupName s
 		return constants.ErrGroupAlreadyExists
 	}
 
-	memoryGroups[groupName] = &MemoryGroup{LastRefresh: time.Now().UnixNano(), TTL: ttlTime.Nanoseconds()}
+	memoryGroups[groupName] = &MemoryGroup{LastRefresh: c.clock.Now().UnixNano(), TTL: ttlTime.Nanoseconds()}
 	return nil
 }
 
@@ -195,7 +210,7 @@ func (c *MemoryGroupService) GroupRenewTTL(ctx context.Context, groupName string
 	}
 
 	if mg.TTL != 0 {
-		mg.LastRefresh = time.Now().UnixNano()
+		mg.LastRefresh = c.clock.Now().UnixNano()
 		memoryGroups[groupName] = mg
 		return nil
 	}
@@ -20,7 +20,16 @@
 
 package groups
 
-import "testing"
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/clock"
+	"github.com/tutumagi/pitaya/config"
+	"github.com/tutumagi/pitaya/constants"
+)
 
 func TestMemoryCreateDuplicatedGroup(t *testing.T) {
 	testCreateDuplicatedGroup(memoryGroupService, t)
@@ -65,3 +74,25 @@ func TestMemoryCount(t *testing.T) {
 func TestMemoryMembers(t *testing.T) {
 	testMembers(memoryGroupService, t)
 }
+
+func TestMemoryGroupTTLWithManualClock(t *testing.T) {
+	c := clock.NewManual(time.Now())
+	gs := NewMemoryGroupService(config.NewConfig(), c)
+	ctx := context.Background()
+
+	err := gs.GroupCreateWithTTL(ctx, "manualClockGroup", time.Minute)
+	assert.NoError(t, err)
+
+	c.Advance(50 * time.Second)
+	assert.NoError(t, gs.GroupRenewTTL(ctx, "manualClockGroup"))
+
+	c.Advance(50 * time.Second)
+	cleanupExpiredGroups(c.Now())
+	_, err = gs.GroupCountMembers(ctx, "manualClockGroup")
+	assert.NoError(t, err)
+
+	c.Advance(11 * time.Second)
+	cleanupExpiredGroups(c.Now())
+	_, err = gs.GroupCountMembers(ctx, "manualClockGroup")
+	assert.Equal(t, constants.ErrGroupNotFound, err)
+}
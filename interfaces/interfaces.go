@@ -32,4 +32,6 @@ type Module interface {
 type BindingStorage interface {
 	GetUserFrontendID(uid, frontendType string) (string, error)
 	PutBinding(uid string) error
+	GetRoleFrontendID(roleID, frontendType string) (string, error)
+	PutRoleBinding(roleID string) error
 }
@@ -123,3 +123,28 @@ func (m *MockBindingStorage) PutBinding(uid string) error {
 func (mr *MockBindingStorageMockRecorder) PutBinding(uid interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutBinding", reflect.TypeOf((*MockBindingStorage)(nil).PutBinding), uid)
 }
+
+// GetRoleFrontendID mocks base method
+func (m *MockBindingStorage) GetRoleFrontendID(roleID, frontendType string) (string, error) {
+	ret := m.ctrl.Call(m, "GetRoleFrontendID", roleID, frontendType)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoleFrontendID indicates an expected call of GetRoleFrontendID
+func (mr *MockBindingStorageMockRecorder) GetRoleFrontendID(roleID, frontendType interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoleFrontendID", reflect.TypeOf((*MockBindingStorage)(nil).GetRoleFrontendID), roleID, frontendType)
+}
+
+// PutRoleBinding mocks base method
+func (m *MockBindingStorage) PutRoleBinding(roleID string) error {
+	ret := m.ctrl.Call(m, "PutRoleBinding", roleID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutRoleBinding indicates an expected call of PutRoleBinding
+func (mr *MockBindingStorageMockRecorder) PutRoleBinding(roleID interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutRoleBinding", reflect.TypeOf((*MockBindingStorage)(nil).PutRoleBinding), roleID)
+}
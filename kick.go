@@ -61,3 +61,35 @@ func SendKickToUsers(uids []string, frontendType string) ([]string, error) {
 
 	return nil, nil
 }
+
+// SendKickToRoles sends kick to a role array
+func SendKickToRoles(roleIDs []string, frontendType string) ([]string, error) {
+	if !app.server.Frontend && frontendType == "" {
+		return roleIDs, constants.ErrFrontendTypeNotSpecified
+	}
+
+	var notKickedRoleIDs []string
+
+	for _, roleID := range roleIDs {
+		if s := session.GetSessionByRoleID(roleID); s != nil {
+			if err := s.Kick(context.Background()); err != nil {
+				notKickedRoleIDs = append(notKickedRoleIDs, roleID)
+				logger.Log.Errorf("Session kick error, ID=%d, RoleID=%s, ERROR=%s", s.ID(), s.RoleID(), err.Error())
+			}
+		} else if app.rpcClient != nil {
+			kick := &protos.KickMsg{RoleID: roleID}
+			if err := app.rpcClient.SendKick("", frontendType, kick); err != nil {
+				notKickedRoleIDs = append(notKickedRoleIDs, roleID)
+				logger.Log.Errorf("RPCClient send kick error, RoleID=%s, SvType=%s, Error=%s", roleID, frontendType, err.Error())
+			}
+		} else {
+			notKickedRoleIDs = append(notKickedRoleIDs, roleID)
+		}
+	}
+
+	if len(notKickedRoleIDs) != 0 {
+		return notKickedRoleIDs, constants.ErrKickingRoles
+	}
+
+	return nil, nil
+}
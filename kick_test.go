@@ -126,3 +126,25 @@ func TestSendKickToUsersRemoteSession(t *testing.T) {
 		})
 	}
 }
+
+func TestSendKickToRoles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockNetworkEntity := mocks.NewMockNetworkEntity(ctrl)
+	mockRPCClient := clustermocks.NewMockRPCClient(ctrl)
+	app.rpcClient = mockRPCClient
+
+	localRole := uuid.New().String()
+	remoteRole := uuid.New().String()
+	s := session.New(mockNetworkEntity, true)
+	assert.NoError(t, s.Bind(context.Background(), uuid.New().String()))
+	assert.NoError(t, s.BindRole(context.Background(), localRole))
+
+	mockNetworkEntity.EXPECT().Kick(context.Background())
+	mockNetworkEntity.EXPECT().Close()
+	mockRPCClient.EXPECT().SendKick("", "connector", &protos.KickMsg{RoleID: remoteRole}).Return(constants.ErrKickingUsers)
+
+	failedRoleIDs, err := SendKickToRoles([]string{localRole, remoteRole}, "connector")
+	assert.Equal(t, constants.ErrKickingRoles, err)
+	assert.Equal(t, []string{remoteRole}, failedRoleIDs)
+}
@@ -28,4 +28,34 @@ var (
 	// ExceededRateLimiting reports the number of requests made in a connection
 	// after the rate limit was exceeded
 	ExceededRateLimiting = "exceeded_rate_limiting"
+	// ClosedConnections reports the number of closed client connections by
+	// close reason
+	ClosedConnections = "closed_connections"
+	// RejectedConnections reports the number of client connections refused
+	// or closed before finishing the handshake by close reason
+	RejectedConnections = "rejected_connections"
+	// SlowConsumerDrops reports the number of pushes dropped by route because
+	// the client was not reading its messages in time
+	SlowConsumerDrops = "slow_consumer_drops"
+	// ReplacedPushes reports the number of droppable pushes by route replaced
+	// by a later push before being sent
+	ReplacedPushes = "replaced_pushes"
+	// HeartbeatRTT reports the round trip time of the heartbeats echoed by
+	// the clients
+	HeartbeatRTT = "heartbeat_rtt"
+	// HeartbeatJitter reports the jitter of the round trip times of the
+	// sessions
+	HeartbeatJitter = "heartbeat_jitter"
+	// TimerPending reports the number of timers created or stopped that
+	// wait for the next tick to be registered or removed
+	TimerPending = "timer_pending"
+	// TimerCount reports the number of registered timers
+	TimerCount = "timer_count"
+	// TimerExecutions reports the number of executions of the timers by name
+	TimerExecutions = "timer_executions_total"
+	// RoleMessagesQueueDepth reports the depth of the session message queues
+	RoleMessagesQueueDepth = "role_messages_queue_depth"
+	// RoleMessagesDropped reports the number of session messages dropped
+	// because the queue was full
+	RoleMessagesDropped = "role_messages_dropped"
 )
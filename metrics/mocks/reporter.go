@@ -68,3 +68,15 @@ func (m *MockReporter) ReportGauge(metric string, tags map[string]string, value
 func (mr *MockReporterMockRecorder) ReportGauge(metric, tags, value interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportGauge", reflect.TypeOf((*MockReporter)(nil).ReportGauge), metric, tags, value)
 }
+
+// ReportHistogram mocks base method
+func (m *MockReporter) ReportHistogram(metric string, tags map[string]string, value float64) error {
+	ret := m.ctrl.Call(m, "ReportHistogram", metric, tags, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReportHistogram indicates an expected call of ReportHistogram
+func (mr *MockReporterMockRecorder) ReportHistogram(metric, tags, value interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportHistogram", reflect.TypeOf((*MockReporter)(nil).ReportHistogram), metric, tags, value)
+}
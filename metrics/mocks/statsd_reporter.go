@@ -57,6 +57,18 @@ func (mr *MockClientMockRecorder) Gauge(name, value, tags, rate interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Gauge", reflect.TypeOf((*MockClient)(nil).Gauge), name, value, tags, rate)
 }
 
+// Histogram mocks base method
+func (m *MockClient) Histogram(name string, value float64, tags []string, rate float64) error {
+	ret := m.ctrl.Call(m, "Histogram", name, value, tags, rate)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Histogram indicates an expected call of Histogram
+func (mr *MockClientMockRecorder) Histogram(name, value, tags, rate interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Histogram", reflect.TypeOf((*MockClient)(nil).Histogram), name, value, tags, rate)
+}
+
 // TimeInMilliseconds mocks base method
 func (m *MockClient) TimeInMilliseconds(name string, value float64, tags []string, rate float64) error {
 	ret := m.ctrl.Call(m, "TimeInMilliseconds", name, value, tags, rate)
@@ -39,12 +39,13 @@ var (
 
 // PrometheusReporter reports metrics to prometheus
 type PrometheusReporter struct {
-	serverType          string
-	game                string
-	countReportersMap   map[string]*prometheus.CounterVec
-	summaryReportersMap map[string]*prometheus.SummaryVec
-	gaugeReportersMap   map[string]*prometheus.GaugeVec
-	additionalLabels    map[string]string
+	serverType            string
+	game                  string
+	countReportersMap     map[string]*prometheus.CounterVec
+	summaryReportersMap   map[string]*prometheus.SummaryVec
+	gaugeReportersMap     map[string]*prometheus.GaugeVec
+	histogramReportersMap map[string]*prometheus.HistogramVec
+	additionalLabels      map[string]string
 }
 
 func (p *PrometheusReporter) registerCustomMetrics(
@@ -246,6 +247,129 @@ func (p *PrometheusReporter) registerMetrics(
 		append([]string{"status"}, additionalLabelsKeys...),
 	)
 
+	p.gaugeReportersMap[TimerPending] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "timer",
+			Name:        TimerPending,
+			Help:        "the number of timers waiting for the next tick to be registered or removed",
+			ConstLabels: constLabels,
+		},
+		append([]string{"operation"}, additionalLabelsKeys...),
+	)
+
+	p.gaugeReportersMap[TimerCount] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "timer",
+			Name:        TimerCount,
+			Help:        "the number of registered timers",
+			ConstLabels: constLabels,
+		},
+		additionalLabelsKeys,
+	)
+
+	p.gaugeReportersMap[TimerExecutions] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "timer",
+			Name:        TimerExecutions,
+			Help:        "the total executions of the timers by name",
+			ConstLabels: constLabels,
+		},
+		append([]string{"name", "status"}, additionalLabelsKeys...),
+	)
+
+	p.gaugeReportersMap[RoleMessagesQueueDepth] = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "agent",
+			Name:        RoleMessagesQueueDepth,
+			Help:        "the depth of the session message queues, the deepest one and the sum of all",
+			ConstLabels: constLabels,
+		},
+		append([]string{"stat"}, additionalLabelsKeys...),
+	)
+
+	p.countReportersMap[RoleMessagesDropped] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "agent",
+			Name:        RoleMessagesDropped,
+			Help:        "the number of session messages dropped because the queue was full",
+			ConstLabels: constLabels,
+		},
+		append([]string{"policy"}, additionalLabelsKeys...),
+	)
+
+	p.countReportersMap[ClosedConnections] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "acceptor",
+			Name:        ClosedConnections,
+			Help:        "the number of closed client connections by close reason",
+			ConstLabels: constLabels,
+		},
+		append([]string{"reason"}, additionalLabelsKeys...),
+	)
+
+	p.countReportersMap[RejectedConnections] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "acceptor",
+			Name:        RejectedConnections,
+			Help:        "the number of client connections refused or closed before finishing the handshake by close reason",
+			ConstLabels: constLabels,
+		},
+		append([]string{"reason"}, additionalLabelsKeys...),
+	)
+
+	p.countReportersMap[SlowConsumerDrops] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "agent",
+			Name:        SlowConsumerDrops,
+			Help:        "the number of pushes dropped because the client was not reading its messages in time",
+			ConstLabels: constLabels,
+		},
+		append([]string{"route"}, additionalLabelsKeys...),
+	)
+
+	p.countReportersMap[ReplacedPushes] = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "agent",
+			Name:        ReplacedPushes,
+			Help:        "the number of droppable pushes replaced by a later push before being sent",
+			ConstLabels: constLabels,
+		},
+		append([]string{"route"}, additionalLabelsKeys...),
+	)
+
+	p.histogramReportersMap[HeartbeatRTT] = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "agent",
+			Name:        HeartbeatRTT,
+			Help:        "the round trip time of the heartbeats echoed by the clients, in milliseconds",
+			Buckets:     []float64{5, 10, 25, 50, 100, 200, 400, 800, 1600, 3200},
+			ConstLabels: constLabels,
+		},
+		additionalLabelsKeys,
+	)
+
+	p.histogramReportersMap[HeartbeatJitter] = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace:   "pitaya",
+			Subsystem:   "agent",
+			Name:        HeartbeatJitter,
+			Help:        "the jitter of the round trip times of the sessions, in milliseconds",
+			Buckets:     []float64{1, 2, 5, 10, 25, 50, 100, 200, 400},
+			ConstLabels: constLabels,
+		},
+		additionalLabelsKeys,
+	)
+
 	p.countReportersMap[ExceededRateLimiting] = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace:   "pitaya",
@@ -256,7 +380,7 @@ func (p *PrometheusReporter) registerMetrics(
 		},
 		additionalLabelsKeys,
 	)
-	
+
 	//p.countReportersMap[WorkerPushCount] = prometheus.NewCounterVec(
 	//	prometheus.CounterOpts{
 	//		Namespace:   "pitaya",
@@ -281,6 +405,10 @@ func (p *PrometheusReporter) registerMetrics(
 		toRegister = append(toRegister, c)
 	}
 
+	for _, c := range p.histogramReportersMap {
+		toRegister = append(toRegister, c)
+	}
+
 	prometheus.MustRegister(toRegister...)
 }
 
@@ -303,11 +431,12 @@ func GetPrometheusReporter(
 
 	once.Do(func() {
 		prometheusReporter = &PrometheusReporter{
-			serverType:          serverType,
-			game:                game,
-			countReportersMap:   make(map[string]*prometheus.CounterVec),
-			summaryReportersMap: make(map[string]*prometheus.SummaryVec),
-			gaugeReportersMap:   make(map[string]*prometheus.GaugeVec),
+			serverType:            serverType,
+			game:                  game,
+			countReportersMap:     make(map[string]*prometheus.CounterVec),
+			summaryReportersMap:   make(map[string]*prometheus.SummaryVec),
+			gaugeReportersMap:     make(map[string]*prometheus.GaugeVec),
+			histogramReportersMap: make(map[string]*prometheus.HistogramVec),
 		}
 		prometheusReporter.registerMetrics(constLabels, additionalLabels, spec)
 		http.Handle("/metrics", promhttp.Handler())
@@ -352,6 +481,17 @@ func (p *PrometheusReporter) ReportGauge(metric string, labels map[string]string
 	return constants.ErrMetricNotKnown
 }
 
+// ReportHistogram reports a histogram metric
+func (p *PrometheusReporter) ReportHistogram(metric string, labels map[string]string, value float64) error {
+	h := p.histogramReportersMap[metric]
+	if h != nil {
+		labels = p.ensureLabels(labels)
+		h.With(labels).Observe(value)
+		return nil
+	}
+	return constants.ErrMetricNotKnown
+}
+
 // ensureLabels checks if labels contains the additionalLabels values,
 // otherwise adds them with the default values
 func (p *PrometheusReporter) ensureLabels(labels map[string]string) map[string]string {
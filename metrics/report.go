@@ -112,6 +112,21 @@ func ReportExceededRateLimiting(reporters []Reporter) {
 	}
 }
 
+// ReportClosedConnection reports a client connection closed for reason
+func ReportClosedConnection(reporters []Reporter, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(ClosedConnections, map[string]string{"reason": reason}, 1)
+	}
+}
+
+// ReportRejectedConnection reports a client connection refused or closed
+// before finishing the handshake for reason
+func ReportRejectedConnection(reporters []Reporter, reason string) {
+	for _, r := range reporters {
+		r.ReportCount(RejectedConnections, map[string]string{"reason": reason}, 1)
+	}
+}
+
 func tagsFromContext(ctx context.Context) map[string]string {
 	val := pcontext.GetFromPropagateCtx(ctx, constants.MetricTagsKey)
 	if val == nil {
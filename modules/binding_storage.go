@@ -81,6 +81,21 @@ func (b *ETCDBindingStorage) removeBinding(uid string) error {
 	return err
 }
 
+func getRoleBindingKey(roleID, frontendType string) string {
+	return fmt.Sprintf("rolebindings/%s/%s", frontendType, roleID)
+}
+
+// PutRoleBinding puts the role binding info into etcd
+func (b *ETCDBindingStorage) PutRoleBinding(roleID string) error {
+	_, err := b.cli.Put(context.Background(), getRoleBindingKey(roleID, b.thisServer.Type), b.thisServer.ID, clientv3.WithLease(b.leaseID))
+	return err
+}
+
+func (b *ETCDBindingStorage) removeRoleBinding(roleID string) error {
+	_, err := b.cli.Delete(context.Background(), getRoleBindingKey(roleID, b.thisServer.Type))
+	return err
+}
+
 // GetUserFrontendID gets the id of the frontend server a user is connected to
 // TODO: should we set context here?
 // TODO: this could be way more optimized, using watcher and local caching
@@ -95,6 +110,18 @@ func (b *ETCDBindingStorage) GetUserFrontendID(uid, frontendType string) (string
 	return string(etcdRes.Kvs[0].Value), nil
 }
 
+// GetRoleFrontendID gets the id of the frontend server a role is connected to
+func (b *ETCDBindingStorage) GetRoleFrontendID(roleID, frontendType string) (string, error) {
+	etcdRes, err := b.cli.Get(context.Background(), getRoleBindingKey(roleID, frontendType))
+	if err != nil {
+		return "", err
+	}
+	if len(etcdRes.Kvs) == 0 {
+		return "", constants.ErrBindingNotFound
+	}
+	return string(etcdRes.Kvs[0].Value), nil
+}
+
 func (b *ETCDBindingStorage) setupOnSessionCloseCB() {
 	session.OnSessionClose(func(s *session.Session) {
 		if s.UID() != "" {
@@ -103,6 +130,12 @@ func (b *ETCDBindingStorage) setupOnSessionCloseCB() {
 				logger.Log.Errorf("error removing binding info from storage: %v", err)
 			}
 		}
+		if s.RoleID() != "" {
+			err := b.removeRoleBinding(s.RoleID())
+			if err != nil {
+				logger.Log.Errorf("error removing role binding info from storage: %v", err)
+			}
+		}
 	})
 }
 
@@ -110,6 +143,9 @@ func (b *ETCDBindingStorage) setupOnAfterSessionBindCB() {
 	session.OnAfterSessionBind(func(ctx context.Context, s *session.Session) error {
 		return b.PutBinding(s.UID())
 	})
+	session.OnAfterRoleBind(func(ctx context.Context, s *session.Session) error {
+		return b.PutRoleBinding(s.RoleID())
+	})
 }
 
 func (b *ETCDBindingStorage) watchLeaseChan(c <-chan *clientv3.LeaseKeepAliveResponse) {
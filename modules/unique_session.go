@@ -51,7 +51,18 @@ func (u *UniqueSession) OnUserBind(uid, fid string) {
 	oldSession := session.GetSessionByUID(uid)
 	if oldSession != nil {
 		// TODO: it would be nice to set this correctly
-		oldSession.Kick(context.Background())
+		oldSession.KickWithReason(context.Background(), session.CloseReasonDuplicateLogin)
+	}
+}
+
+// OnRoleBind method should be called when a role binds a session in remote servers
+func (u *UniqueSession) OnRoleBind(roleID, fid string) {
+	if u.server.ID == fid {
+		return
+	}
+	oldSession := session.GetSessionByRoleID(roleID)
+	if oldSession != nil {
+		oldSession.KickWithReason(context.Background(), session.CloseReasonDuplicateLogin)
 	}
 }
 
@@ -60,10 +71,17 @@ func (u *UniqueSession) Init() error {
 	session.OnSessionBind(func(ctx context.Context, s *session.Session) error {
 		oldSession := session.GetSessionByUID(s.UID())
 		if oldSession != nil {
-			return oldSession.Kick(ctx)
+			return oldSession.KickWithReason(ctx, session.CloseReasonDuplicateLogin)
 		}
 		err := u.rpcClient.BroadcastSessionBind(s.UID())
 		return err
 	})
+	session.OnRoleBind(func(ctx context.Context, s *session.Session) error {
+		oldSession := session.GetSessionByRoleID(s.RoleID())
+		if oldSession != nil && oldSession != s {
+			return oldSession.KickWithReason(ctx, session.CloseReasonDuplicateLogin)
+		}
+		return u.rpcClient.BroadcastRoleBind(s.RoleID())
+	})
 	return nil
 }
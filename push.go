@@ -74,3 +74,45 @@ func SendPushToUsers(route string, v interface{}, uids []string, frontendType st
 
 	return nil, nil
 }
+
+// SendPushToRoles sends a message to the given list of roles
+func SendPushToRoles(route string, v interface{}, roleIDs []string, frontendType string) ([]string, error) {
+	data, err := util.SerializeOrRaw(app.serializer, v)
+	if err != nil {
+		return roleIDs, err
+	}
+
+	if !app.server.Frontend && frontendType == "" {
+		return roleIDs, constants.ErrFrontendTypeNotSpecified
+	}
+
+	var notPushedRoleIDs []string
+
+	for _, roleID := range roleIDs {
+		if s := session.GetSessionByRoleID(roleID); s != nil && app.server.Type == frontendType {
+			if err := s.Push(route, data); err != nil {
+				notPushedRoleIDs = append(notPushedRoleIDs, roleID)
+				logger.Log.Errorf("Session push message error, ID=%d, RoleID=%s, Error=%s",
+					s.ID(), s.RoleID(), err.Error())
+			}
+		} else if app.rpcClient != nil {
+			push := &protos.Push{
+				Route:  route,
+				RoleID: roleID,
+				Data:   data,
+			}
+			if err = app.rpcClient.SendPush("", &cluster.Server{Type: frontendType}, push); err != nil {
+				notPushedRoleIDs = append(notPushedRoleIDs, roleID)
+				logger.Log.Errorf("RPCClient send message error, RoleID=%s, SvType=%s, Error=%s", roleID, frontendType, err.Error())
+			}
+		} else {
+			notPushedRoleIDs = append(notPushedRoleIDs, roleID)
+		}
+	}
+
+	if len(notPushedRoleIDs) != 0 {
+		return notPushedRoleIDs, constants.ErrPushingToRoles
+	}
+
+	return nil, nil
+}
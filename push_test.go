@@ -21,6 +21,7 @@
 package pitaya
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -142,3 +143,31 @@ func TestSendToUsersRemoteSession(t *testing.T) {
 		})
 	}
 }
+
+func TestSendPushToRoles(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockNetworkEntity := mocks.NewMockNetworkEntity(ctrl)
+	mockRPCClient := clustermocks.NewMockRPCClient(ctrl)
+	app.rpcClient = mockRPCClient
+
+	route := "some.route.bla"
+	data := []byte("hello")
+	localRole := uuid.New().String()
+	remoteRole := uuid.New().String()
+	s := session.New(mockNetworkEntity, true)
+	assert.NoError(t, s.Bind(context.Background(), uuid.New().String()))
+	assert.NoError(t, s.BindRole(context.Background(), localRole))
+
+	mockNetworkEntity.EXPECT().Push(route, data)
+	expectedMsg := &protos.Push{
+		Route:  route,
+		RoleID: remoteRole,
+		Data:   data,
+	}
+	mockRPCClient.EXPECT().SendPush("", gomock.Any(), expectedMsg).Return(constants.ErrPushingToUsers)
+
+	errArr, err := SendPushToRoles(route, data, []string{localRole, remoteRole}, app.server.Type)
+	assert.Equal(t, constants.ErrPushingToRoles, err)
+	assert.Equal(t, []string{remoteRole}, errArr)
+}
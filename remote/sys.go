@@ -43,6 +43,20 @@ func (s *Sys) BindSession(ctx context.Context, sessionData *protos.Session) (*pr
 	if err := sess.Bind(ctx, sessionData.Uid); err != nil {
 		return nil, err
 	}
+	// the backend writes to the store once the session claimed it
+	sess.FlushStored()
+	return &protos.Response{Data: []byte("ack")}, nil
+}
+
+// BindRole binds a role to the local session
+func (s *Sys) BindRole(ctx context.Context, sessionData *protos.Session) (*protos.Response, error) {
+	sess := session.GetSessionByID(sessionData.Id)
+	if sess == nil {
+		return nil, constants.ErrSessionNotFound
+	}
+	if err := sess.BindRole(ctx, sessionData.RoleID); err != nil {
+		return nil, err
+	}
 	return &protos.Response{Data: []byte("ack")}, nil
 }
 
@@ -52,18 +66,35 @@ func (s *Sys) PushSession(ctx context.Context, sessionData *protos.Session) (*pr
 	if sess == nil {
 		return nil, constants.ErrSessionNotFound
 	}
-	if err := sess.SetDataEncoded(sessionData.Data); err != nil {
+	if err := sess.ApplyPush(sessionData); err != nil {
 		return nil, err
 	}
 	return &protos.Response{Data: []byte("ack")}, nil
 }
 
+// RequestClient sends a request to the client of a local user and answers
+// with its response
+func (s *Sys) RequestClient(ctx context.Context, msg *protos.Push) (*protos.Response, error) {
+	sess := session.GetSessionByUID(msg.GetUid())
+	if sess == nil {
+		return nil, constants.ErrSessionNotFound
+	}
+	data, err := sess.Request(ctx, msg.GetRoute(), msg.GetData())
+	if err != nil {
+		return nil, err
+	}
+	return &protos.Response{Data: data}, nil
+}
+
 // Kick kicks a local user
 func (s *Sys) Kick(ctx context.Context, msg *protos.KickMsg) (*protos.KickAnswer, error) {
 	res := &protos.KickAnswer{
 		Kicked: false,
 	}
 	sess := session.GetSessionByUID(msg.GetUserId())
+	if msg.GetRoleID() != "" {
+		sess = session.GetSessionByRoleID(msg.GetRoleID())
+	}
 	if sess == nil {
 		return res, constants.ErrSessionNotFound
 	}
@@ -21,6 +21,7 @@
 package remote
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
@@ -113,6 +114,47 @@ func TestPushSession(t *testing.T) {
 	assert.Equal(t, data.Data, ss.GetDataEncoded())
 }
 
+func TestBindRole(t *testing.T) {
+	t.Parallel()
+	s := &Sys{}
+	ss := session.New(nil, true, uuid.New().String())
+	roleID := uuid.New().String()
+	data := &protos.Session{
+		Id:     ss.ID(),
+		RoleID: roleID,
+	}
+	res, err := s.BindRole(nil, data)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ack"), res.Data)
+	assert.Equal(t, ss, session.GetSessionByRoleID(roleID))
+
+	data.Id = 343
+	_, err = s.BindRole(nil, data)
+	assert.Equal(t, constants.ErrSessionNotFound, err)
+}
+
+func TestPushSessionVersionConflict(t *testing.T) {
+	t.Parallel()
+	s := &Sys{}
+	ss := session.New(nil, true)
+	assert.NoError(t, ss.Set("hello", "test"))
+
+	data := &protos.Session{
+		Id:      ss.ID(),
+		Data:    []byte(`{"hello":"other"}`),
+		Partial: true,
+		Version: ss.Version() - 1,
+	}
+	_, err := s.PushSession(nil, data)
+	assert.Equal(t, constants.ErrSessionVersionConflict, err)
+	assert.Equal(t, "test", ss.String("hello"))
+
+	data.Version = ss.Version()
+	_, err = s.PushSession(nil, data)
+	assert.NoError(t, err)
+	assert.Equal(t, "other", ss.String("hello"))
+}
+
 func TestPushSessionShouldFailIfSessionDoesntExists(t *testing.T) {
 	t.Parallel()
 	s := &Sys{}
@@ -131,6 +173,57 @@ func TestPushSessionShouldFailIfSessionDoesntExists(t *testing.T) {
 	assert.EqualError(t, constants.ErrSessionNotFound, err.Error())
 }
 
+type requesterEntity struct {
+	*mocks.MockNetworkEntity
+	route string
+	data  interface{}
+}
+
+func (r *requesterEntity) Request(ctx context.Context, route string, v interface{}) ([]byte, error) {
+	r.route = route
+	r.data = v
+	return []byte("answer"), nil
+}
+
+func TestRequestClient(t *testing.T) {
+	t.Parallel()
+	s := &Sys{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	entity := &requesterEntity{MockNetworkEntity: mocks.NewMockNetworkEntity(ctrl)}
+	ss := session.New(entity, true)
+	uid := uuid.New().String()
+	_, err := s.BindSession(nil, &protos.Session{Id: ss.ID(), Uid: uid})
+	assert.NoError(t, err)
+
+	res, err := s.RequestClient(nil, &protos.Push{Route: "client.ask", Uid: uid, Data: []byte("question")})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("answer"), res.Data)
+	assert.Equal(t, "client.ask", entity.route)
+	assert.Equal(t, []byte("question"), entity.data)
+}
+
+func TestRequestClientShouldFailIfNotSupported(t *testing.T) {
+	t.Parallel()
+	s := &Sys{}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ss := session.New(mocks.NewMockNetworkEntity(ctrl), true)
+	uid := uuid.New().String()
+	_, err := s.BindSession(nil, &protos.Session{Id: ss.ID(), Uid: uid})
+	assert.NoError(t, err)
+
+	_, err = s.RequestClient(nil, &protos.Push{Route: "client.ask", Uid: uid})
+	assert.Equal(t, constants.ErrClientRequestsNotSupported, err)
+}
+
+func TestRequestClientShouldFailIfSessionDoesntExists(t *testing.T) {
+	t.Parallel()
+	s := &Sys{}
+	_, err := s.RequestClient(nil, &protos.Push{Route: "client.ask", Uid: uuid.New().String()})
+	assert.EqualError(t, constants.ErrSessionNotFound, err.Error())
+}
+
 func TestKick(t *testing.T) {
 	t.Parallel()
 	s := &Sys{}
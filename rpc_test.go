@@ -74,7 +74,7 @@ func TestDoSendRPC(t *testing.T) {
 				mockRPCServer := clustermocks.NewMockRPCServer(ctrl)
 				messageEncoder := message.NewMessagesEncoder(false)
 				router := router.New()
-				svc := service.NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{})
+				svc := service.NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{}, 0, 0)
 				assert.NotNil(t, svc)
 				remoteService = svc
 				app.server.ID = "notmyserver"
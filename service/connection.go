@@ -0,0 +1,104 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package service
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tutumagi/pitaya/acceptor"
+	"github.com/tutumagi/pitaya/logger"
+)
+
+// connectionLimiter counts the open connections of each ip, refusing new
+// connections from ips that reached the maximum
+type connectionLimiter struct {
+	mu    sync.Mutex
+	max   int
+	conns map[string]int
+}
+
+func newConnectionLimiter() *connectionLimiter {
+	return &connectionLimiter{conns: make(map[string]int)}
+}
+
+// acquire counts a connection from ip, it returns false without counting it
+// if ip has too many connections
+func (l *connectionLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.conns[ip] >= l.max {
+		return false
+	}
+	l.conns[ip]++
+	return true
+}
+
+// release forgets a connection from ip
+func (l *connectionLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip] <= 1 {
+		delete(l.conns, ip)
+		return
+	}
+	l.conns[ip]--
+}
+
+// remoteIP returns the ip of addr without its port
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// handshakeDeadline returns until when a connection opened at start may wait
+// for the handshake, the first data must also be received before the first
+// data timeout. A zero time means the connection does not time out.
+func (h *HandlerService) handshakeDeadline(start time.Time, received bool) time.Time {
+	var deadline time.Time
+	if h.handshakeTimeout > 0 {
+		deadline = start.Add(h.handshakeTimeout)
+	}
+	if !received && h.firstDataTimeout > 0 {
+		if first := start.Add(h.firstDataTimeout); deadline.IsZero() || first.Before(deadline) {
+			deadline = first
+		}
+	}
+	return deadline
+}
+
+func setReadDeadline(conn acceptor.PlayerConn, deadline time.Time) {
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		logger.Log.Warnf("failed to set read deadline: %s", err.Error())
+	}
+}
+
+func isTimeout(err error) bool {
+	ne, ok := err.(net.Error)
+	return ok && ne.Timeout()
+}
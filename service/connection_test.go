@@ -0,0 +1,99 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package service
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestConnectionLimiter(t *testing.T) {
+	l := newConnectionLimiter()
+	assert.True(t, l.acquire("1.2.3.4"))
+	assert.True(t, l.acquire("1.2.3.4"))
+
+	l.max = 2
+	assert.False(t, l.acquire("1.2.3.4"))
+	assert.True(t, l.acquire("4.3.2.1"))
+
+	l.release("1.2.3.4")
+	assert.True(t, l.acquire("1.2.3.4"))
+
+	l.release("1.2.3.4")
+	l.release("1.2.3.4")
+	l.release("4.3.2.1")
+	assert.Empty(t, l.conns)
+}
+
+func TestRemoteIP(t *testing.T) {
+	tables := []struct {
+		name string
+		addr net.Addr
+		ip   string
+	}{
+		{"nil", nil, ""},
+		{"ipv4", &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 3250}, "1.2.3.4"},
+		{"ipv6", &net.TCPAddr{IP: net.ParseIP("::1"), Port: 3250}, "::1"},
+		{"without_port", &mockAddr{}, "remote-string"},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			assert.Equal(t, table.ip, remoteIP(table.addr))
+		})
+	}
+}
+
+func TestHandshakeDeadline(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tables := []struct {
+		name      string
+		handshake time.Duration
+		firstData time.Duration
+		received  bool
+		deadline  time.Time
+	}{
+		{"disabled", 0, 0, false, time.Time{}},
+		{"handshake", 10 * time.Second, 0, false, start.Add(10 * time.Second)},
+		{"first_data", 0, 2 * time.Second, false, start.Add(2 * time.Second)},
+		{"first_data_received", 0, 2 * time.Second, true, time.Time{}},
+		{"first_data_before_handshake", 10 * time.Second, 2 * time.Second, false, start.Add(2 * time.Second)},
+		{"handshake_after_first_data", 10 * time.Second, 2 * time.Second, true, start.Add(10 * time.Second)},
+		{"handshake_before_first_data", time.Second, 2 * time.Second, false, start.Add(time.Second)},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			svc := NewHandlerService(nil, nil, nil, nil, time.Second, 1, 1, 1, nil, nil, nil, nil)
+			svc.SetHandshakeTimeouts(table.handshake, table.firstData)
+			assert.Equal(t, table.deadline, svc.handshakeDeadline(start, table.received))
+		})
+	}
+}
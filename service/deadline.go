@@ -0,0 +1,100 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tutumagi/pitaya/constants"
+	pcontext "github.com/tutumagi/pitaya/context"
+	"github.com/tutumagi/pitaya/route"
+)
+
+var handlerTimeouts = struct {
+	sync.RWMutex
+	def    time.Duration
+	routes map[string]time.Duration
+}{routes: make(map[string]time.Duration)}
+
+// SetHandlerTimeout sets the deadline of the requests of route, counted
+// from their arrival at the server. Routes are given as serverType.service.method
+// or service.method, an empty route sets the deadline of the routes without
+// one. Zero removes the deadline.
+func SetHandlerTimeout(rt string, timeout time.Duration) {
+	handlerTimeouts.Lock()
+	defer handlerTimeouts.Unlock()
+
+	if rt == "" {
+		handlerTimeouts.def = timeout
+		return
+	}
+	if timeout <= 0 {
+		delete(handlerTimeouts.routes, rt)
+		return
+	}
+	handlerTimeouts.routes[rt] = timeout
+}
+
+func handlerTimeout(rt *route.Route) time.Duration {
+	handlerTimeouts.RLock()
+	defer handlerTimeouts.RUnlock()
+
+	if timeout, ok := handlerTimeouts.routes[rt.String()]; ok {
+		return timeout
+	}
+	if timeout, ok := handlerTimeouts.routes[rt.Short()]; ok {
+		return timeout
+	}
+	return handlerTimeouts.def
+}
+
+// withHandlerDeadline applies the deadline of rt to ctx. Client requests
+// count it from their start time, requests from other servers from now as
+// they carry the deadline of the caller already.
+func withHandlerDeadline(ctx context.Context, rt *route.Route, remote bool) (context.Context, context.CancelFunc) {
+	timeout := handlerTimeout(rt)
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	start := time.Now()
+	if !remote {
+		if ns, ok := pcontext.GetFromPropagateCtx(ctx, constants.StartTimeKey).(int64); ok {
+			start = time.Unix(0, ns)
+		}
+	}
+	return context.WithDeadline(ctx, start.Add(timeout))
+}
+
+// withPropagatedDeadline applies to ctx the time left until the deadline of
+// the request as sent by the caller
+func withPropagatedDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	var remaining time.Duration
+	switch ns := pcontext.GetFromPropagateCtx(ctx, constants.DeadlineKey).(type) {
+	case float64: // decoded from json
+		remaining = time.Duration(ns)
+	case int64:
+		remaining = time.Duration(ns)
+	default:
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, remaining)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/cluster"
+	"github.com/tutumagi/pitaya/component"
+	"github.com/tutumagi/pitaya/conn/message"
+	"github.com/tutumagi/pitaya/constants"
+	pcontext "github.com/tutumagi/pitaya/context"
+	e "github.com/tutumagi/pitaya/errors"
+	"github.com/tutumagi/pitaya/protos"
+	"github.com/tutumagi/pitaya/route"
+	"github.com/tutumagi/pitaya/session"
+)
+
+func TestHandlerTimeout(t *testing.T) {
+	defer func() {
+		SetHandlerTimeout("", 0)
+		SetHandlerTimeout("sv.room.join", 0)
+		SetHandlerTimeout("room.move", 0)
+	}()
+
+	rt := route.NewRoute("sv", "room", "join")
+	assert.Equal(t, time.Duration(0), handlerTimeout(rt))
+
+	SetHandlerTimeout("", time.Second)
+	SetHandlerTimeout("room.join", 2*time.Second)
+	assert.Equal(t, 2*time.Second, handlerTimeout(rt))
+	SetHandlerTimeout("sv.room.join", 3*time.Second)
+	assert.Equal(t, 3*time.Second, handlerTimeout(rt))
+	assert.Equal(t, time.Second, handlerTimeout(route.NewRoute("sv", "room", "leave")))
+
+	SetHandlerTimeout("sv.room.join", 0)
+	SetHandlerTimeout("room.join", 0)
+	assert.Equal(t, time.Second, handlerTimeout(rt))
+}
+
+func TestWithHandlerDeadline(t *testing.T) {
+	rt := route.NewRoute("", "room", "join")
+	SetHandlerTimeout("room.join", time.Minute)
+	defer SetHandlerTimeout("room.join", 0)
+
+	start := time.Now().Add(-10 * time.Second)
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.StartTimeKey, start.UnixNano())
+
+	// client requests count from their start time
+	c, cancel := withHandlerDeadline(ctx, rt, false)
+	defer cancel()
+	deadline, ok := c.Deadline()
+	assert.True(t, ok)
+	assert.Equal(t, start.Add(time.Minute).UnixNano(), deadline.UnixNano())
+
+	// requests of other servers count from now
+	c, cancel = withHandlerDeadline(ctx, rt, true)
+	defer cancel()
+	deadline, ok = c.Deadline()
+	assert.True(t, ok)
+	assert.True(t, deadline.After(start.Add(time.Minute)))
+
+	// routes without timeout have no deadline
+	c, cancel = withHandlerDeadline(ctx, route.NewRoute("", "room", "leave"), false)
+	defer cancel()
+	_, ok = c.Deadline()
+	assert.False(t, ok)
+}
+
+func TestWithPropagatedDeadline(t *testing.T) {
+	tables := []struct {
+		name      string
+		remaining interface{}
+		deadline  bool
+	}{
+		{"none", nil, false},
+		{"decoded", float64(time.Minute), true},
+		{"local", int64(time.Minute), true},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ctx := context.Background()
+			if table.remaining != nil {
+				ctx = pcontext.AddToPropagateCtx(ctx, constants.DeadlineKey, table.remaining)
+			}
+			c, cancel := withPropagatedDeadline(ctx)
+			defer cancel()
+			deadline, ok := c.Deadline()
+			assert.Equal(t, table.deadline, ok)
+			if ok {
+				assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+			}
+		})
+	}
+}
+
+func TestProcessHandlerMessageExpired(t *testing.T) {
+	rt := route.NewRoute("", "room", "expired")
+	handlers[rt.Short()] = &component.Handler{}
+	defer func() { delete(handlers, rt.Short()) }()
+	SetHandlerTimeout(rt.Short(), time.Second)
+	defer SetHandlerTimeout(rt.Short(), 0)
+
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.StartTimeKey, time.Now().Add(-time.Minute).UnixNano())
+	out, err := processHandlerMessage(ctx, rt, nil, session.New(nil, false), nil, message.Request, false)
+	assert.Nil(t, out)
+	assert.Equal(t, e.NewError(constants.ErrRequestDeadlineExceeded, e.ErrDeadlineExceededCode), err)
+}
+
+func TestRemoteServiceCallRejectsExpiredRequest(t *testing.T) {
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, &cluster.Server{}, 0, 0)
+
+	ctx := pcontext.AddToPropagateCtx(context.Background(), constants.DeadlineKey, int64(0))
+	metadata, err := pcontext.Encode(ctx)
+	assert.NoError(t, err)
+	req := &protos.Request{
+		Type:     protos.RPCType_User,
+		Msg:      &protos.Msg{Route: "sv.MyComp.Remote1"},
+		Metadata: metadata,
+	}
+
+	res, err := svc.Call(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, e.ErrDeadlineExceededCode, res.Error.Code)
+	assert.Equal(t, constants.ErrRequestDeadlineExceeded.Error(), res.Error.Msg)
+}
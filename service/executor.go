@@ -0,0 +1,147 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package service
+
+import (
+	"context"
+
+	"github.com/tutumagi/pitaya/component"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/protos"
+	"github.com/tutumagi/pitaya/route"
+	"github.com/tutumagi/pitaya/util"
+)
+
+type (
+	// Executor runs the processing of the remote requests received by the
+	// server
+	Executor interface {
+		Execute(fn func())
+	}
+
+	// inlineExecutor runs the requests on the dispatch goroutine, one at a
+	// time and together with the timers
+	inlineExecutor struct{}
+
+	// workerPool runs the requests on a fixed number of goroutines
+	workerPool struct {
+		ch chan func()
+	}
+
+	// goroutineExecutor runs every request on a goroutine of its own, for
+	// requests that wait for a client instead of the server
+	goroutineExecutor struct{}
+
+	// mailboxExecutor runs the requests of an entity one at a time and in
+	// order, on the mailbox of its key
+	mailboxExecutor struct {
+		mailboxes *keyedDispatcher
+		key       string
+	}
+)
+
+func (inlineExecutor) Execute(fn func()) {
+	fn()
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &workerPool{ch: make(chan func(), size)}
+	for i := 0; i < size; i++ {
+		go p.run()
+	}
+	return p
+}
+
+// Execute enqueues fn, it blocks while all workers are busy and the queue
+// is full
+func (p *workerPool) Execute(fn func()) {
+	p.ch <- fn
+}
+
+func (p *workerPool) run() {
+	for fn := range p.ch {
+		p.exec(fn)
+	}
+}
+
+func (p *workerPool) exec(fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Log.Errorf("Call pooled remote error, Error=%v", err)
+		}
+	}()
+
+	fn()
+}
+
+func (goroutineExecutor) Execute(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Log.Errorf("Call remote error, Error=%v", err)
+			}
+		}()
+		fn()
+	}()
+}
+
+func (m *mailboxExecutor) Execute(fn func()) {
+	m.mailboxes.dispatch(m.key, fn)
+}
+
+// executor returns where req is processed, from the dispatch of its remote.
+// Requests of handlers, of unknown remotes and Keyed requests with an
+// empty key are processed inline. Requests to clients wait for the client
+// to answer, they run on goroutines of their own so that slow clients never
+// hold the dispatch goroutines.
+func (r *RemoteService) executor(req *protos.Request) Executor {
+	if req.GetType() != protos.RPCType_User {
+		return inlineExecutor{}
+	}
+	rt, err := route.Decode(req.GetMsg().GetRoute())
+	if err != nil {
+		return inlineExecutor{}
+	}
+	if rt.Short() == constants.RequestClientRoute {
+		return goroutineExecutor{}
+	}
+	remote, ok := remotes[rt.Short()]
+	if !ok {
+		return inlineExecutor{}
+	}
+
+	switch remote.Dispatch {
+	case component.Pooled:
+		return r.pool
+	case component.Keyed:
+		ctx, err := util.GetContextFromRequest(req, r.server.ID)
+		if err != nil {
+			ctx = context.Background()
+		}
+		if key := remote.DispatchKey(ctx, req.GetMsg().GetData()); key != "" {
+			return &mailboxExecutor{mailboxes: r.mailboxes, key: key}
+		}
+	}
+	return inlineExecutor{}
+}
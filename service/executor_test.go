@@ -0,0 +1,128 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package service
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/cluster"
+	"github.com/tutumagi/pitaya/component"
+	"github.com/tutumagi/pitaya/helpers"
+	"github.com/tutumagi/pitaya/protos"
+)
+
+func TestWorkerPool(t *testing.T) {
+	p := newWorkerPool(2)
+
+	// both workers run at the same time
+	var wg sync.WaitGroup
+	wg.Add(2)
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		p.Execute(func() {
+			wg.Done()
+			<-release
+		})
+	}
+	wg.Wait()
+	close(release)
+
+	// a panic does not stop the worker
+	p.Execute(func() { panic("boom") })
+	done := make(chan bool, 1)
+	p.Execute(func() { done <- true })
+	helpers.ShouldEventuallyReceive(t, done)
+}
+
+func TestGoroutineExecutor(t *testing.T) {
+	// a request waiting for its client does not hold the caller
+	release := make(chan struct{})
+	defer close(release)
+	goroutineExecutor{}.Execute(func() { <-release })
+
+	goroutineExecutor{}.Execute(func() { panic("boom") })
+	done := make(chan bool, 1)
+	goroutineExecutor{}.Execute(func() { done <- true })
+	helpers.ShouldEventuallyReceive(t, done)
+}
+
+func TestRemoteServiceExecutor(t *testing.T) {
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, &cluster.Server{}, 1, 1)
+	roleKey := func(ctx context.Context, data []byte) string { return string(data) }
+	err := svc.Register(&MyComp{}, []component.Option{
+		component.WithDispatch(component.Pooled, "Remote1"),
+		component.WithDispatchKey(roleKey, "Remote2"),
+	})
+	assert.NoError(t, err)
+	defer func() { remotes = make(map[string]*component.Remote, 0) }()
+
+	tables := []struct {
+		name     string
+		rpcType  protos.RPCType
+		route    string
+		data     []byte
+		executor Executor
+	}{
+		{"sys", protos.RPCType_Sys, "sv.MyComp.Remote1", nil, inlineExecutor{}},
+		{"bad_route", protos.RPCType_User, "bad", nil, inlineExecutor{}},
+		{"unknown_remote", protos.RPCType_User, "sv.MyComp.Unknown", nil, inlineExecutor{}},
+		{"ordered", protos.RPCType_User, "sv.MyComp.RemoteRes", nil, inlineExecutor{}},
+		{"pooled", protos.RPCType_User, "sv.MyComp.Remote1", nil, svc.pool},
+		{"keyed", protos.RPCType_User, "sv.MyComp.Remote2", []byte("role1"), &mailboxExecutor{mailboxes: svc.mailboxes, key: "role1"}},
+		{"keyed_without_key", protos.RPCType_User, "sv.MyComp.Remote2", nil, inlineExecutor{}},
+		{"request_client", protos.RPCType_User, "connector.sys.requestclient", nil, goroutineExecutor{}},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			req := &protos.Request{
+				Type: table.rpcType,
+				Msg:  &protos.Msg{Route: table.route, Data: table.data},
+			}
+			assert.Equal(t, table.executor, svc.executor(req))
+		})
+	}
+}
+
+func TestMailboxExecutorOrder(t *testing.T) {
+	m := &mailboxExecutor{mailboxes: newKeyedDispatcher(10), key: "role1"}
+
+	var mu sync.Mutex
+	order := []int{}
+	for i := 0; i < 10; i++ {
+		i := i
+		m.Execute(func() {
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+	helpers.ShouldEventuallyReturn(t, func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(order)
+	}, 10)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order)
+}
@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/tutumagi/pitaya/acceptor"
@@ -32,6 +33,7 @@ import (
 	"github.com/google/uuid"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/tutumagi/pitaya/agent"
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/cluster"
 	"github.com/tutumagi/pitaya/component"
 	"github.com/tutumagi/pitaya/conn/codec"
@@ -53,18 +55,14 @@ import (
 var (
 	handlers    = make(map[string]*component.Handler) // all handler method
 	handlerType = "handler"
-	// TODO: 后续移到配置文件或采用其他实现方式
-	mapFilterRoutes = map[string]bool{
-		// "baseapp.scene.syncpos": true,
-		// "baseapp.scene.stopsyncpos": true,
-		// "baseapp.scene.syncskypos": true,
-	}
 )
 
 type (
 	// HandlerService service
 	HandlerService struct {
+		inFlight           int64                 // requests being processed, first for 64-bit alignment
 		appDieChan         chan bool             // die channel app
+		clock              clock.Clock           // time source of the agents
 		chLocalProcess     chan unhandledMessage // channel of messages that will be processed locally
 		chRemoteProcess    chan unhandledMessage // channel of messages that will be processed remotely
 		MessageChanSize    int
@@ -78,6 +76,22 @@ type (
 		services           map[string]*component.Service // all registered service
 		messageEncoder     message.Encoder
 		metricsReporters   []metrics.Reporter
+		keyed              *keyedDispatcher // processes the messages of Keyed handlers
+		pooledRemoteRoutes map[string]bool  // routes of other server types forwarded by the pool
+		overflowPolicy     agent.OverflowPolicy
+		overflowTimeout    time.Duration
+		sendKickReason     bool
+		writeTimeout       time.Duration
+		coalesceSize       int
+		coalesceInterval   time.Duration
+		requestTimeout     time.Duration
+		handshakeTimeout   time.Duration
+		firstDataTimeout   time.Duration
+		connsByIP          *connectionLimiter
+
+		slowConsumerPolicy    agent.SlowConsumerPolicy
+		slowConsumerThreshold float64
+		slowConsumerWindow    time.Duration
 	}
 
 	unhandledMessage struct {
@@ -88,7 +102,8 @@ type (
 	}
 )
 
-// NewHandlerService creates and returns a new handler service
+// NewHandlerService creates and returns a new handler service, its agents
+// use the real clock unless a clock is given
 func NewHandlerService(
 	dieChan chan bool,
 	packetDecoder codec.PacketDecoder,
@@ -102,7 +117,12 @@ func NewHandlerService(
 	remoteService *RemoteService,
 	messageEncoder message.Encoder,
 	metricsReporters []metrics.Reporter,
+	clockOrNil ...clock.Clock,
 ) *HandlerService {
+	var clk clock.Clock
+	if len(clockOrNil) > 0 {
+		clk = clockOrNil[0]
+	}
 	h := &HandlerService{
 		services:           make(map[string]*component.Service),
 		chLocalProcess:     make(chan unhandledMessage, localProcessBufferSize),
@@ -118,11 +138,77 @@ func NewHandlerService(
 		remoteService:      remoteService,
 		messageEncoder:     messageEncoder,
 		metricsReporters:   metricsReporters,
+		clock:              clk,
+		keyed:              newKeyedDispatcher(localProcessBufferSize),
+		connsByIP:          newConnectionLimiter(),
+		pooledRemoteRoutes: make(map[string]bool),
 	}
 
 	return h
 }
 
+// SetOverflowPolicy sets what the agents created by the service do when
+// their message queue is full
+func (h *HandlerService) SetOverflowPolicy(policy agent.OverflowPolicy, timeout time.Duration) {
+	h.overflowPolicy = policy
+	h.overflowTimeout = timeout
+}
+
+// SetSendKickReason sets whether the agents created by the service send the
+// reason of kicks to their clients
+func (h *HandlerService) SetSendKickReason(enabled bool) {
+	h.sendKickReason = enabled
+}
+
+// SetWriteTimeout sets the write deadline of the agents created by the service
+func (h *HandlerService) SetWriteTimeout(timeout time.Duration) {
+	h.writeTimeout = timeout
+}
+
+// SetCoalescing sets how many bytes of queued packets the agents created by
+// the service join in a single write, and how long they wait for them
+func (h *HandlerService) SetCoalescing(size int, interval time.Duration) {
+	h.coalesceSize = size
+	h.coalesceInterval = interval
+}
+
+// SetRequestTimeout sets how long the agents created by the service wait for
+// the responses of their clients to server requests
+func (h *HandlerService) SetRequestTimeout(timeout time.Duration) {
+	h.requestTimeout = timeout
+}
+
+// SetHandshakeTimeouts sets how long clients have to finish the handshake
+// and to send their first data after connecting, zero disables the timeout
+func (h *HandlerService) SetHandshakeTimeouts(handshake, firstData time.Duration) {
+	h.handshakeTimeout = handshake
+	h.firstDataTimeout = firstData
+}
+
+// SetMaxConnectionsPerIP sets how many connections the service accepts from
+// the same ip, zero means unlimited
+func (h *HandlerService) SetMaxConnectionsPerIP(max int) {
+	h.connsByIP.max = max
+}
+
+// SetSlowConsumerPolicy sets what the agents created by the service do when
+// their clients read messages slower than they are sent
+func (h *HandlerService) SetSlowConsumerPolicy(policy agent.SlowConsumerPolicy, threshold float64, window time.Duration) {
+	h.slowConsumerPolicy = policy
+	h.slowConsumerThreshold = threshold
+	h.slowConsumerWindow = window
+}
+
+// SetPooledRemoteRoutes sets the routes of other server types that are
+// forwarded by the dispatch goroutines instead of the queue of the agent,
+// their messages are not forwarded in order
+func (h *HandlerService) SetPooledRemoteRoutes(routes ...string) {
+	h.pooledRemoteRoutes = make(map[string]bool, len(routes))
+	for _, r := range routes {
+		h.pooledRemoteRoutes[r] = true
+	}
+}
+
 // Dispatch message to corresponding logic handler
 func (h *HandlerService) Dispatch(thread int) {
 	// TODO: This timer is being stopped multiple times, it probably doesn't need to be stopped here
@@ -148,28 +234,24 @@ func (h *HandlerService) Dispatch(thread int) {
 		case rm := <-h.chRemoteProcess:
 			// logger.Log.Debugf("pitaya.handler Dispatch -> remoteProcess <0> for SessionID=%d, UID=%s, route=%s", rm.agent.Session.ID(), rm.agent.Session.UID(), rm.msg.Route)
 			metrics.ReportMessageProcessDelayFromCtx(rm.ctx, h.metricsReporters, "remote")
-			h.remoteService.remoteProcess(rm.ctx, nil, rm.agent, rm.route, rm.msg)
+			h.remoteProcess(rm.ctx, rm.agent, rm.route, rm.msg)
 			// logger.Log.Debugf("pitaya.handler Dispatch -> remoteProcess <1> for SessionID=%d, UID=%s, route=%s", rm.agent.Session.ID(), rm.agent.Session.UID(), rm.msg.Route)
 
 		// 收到 rpc call/post 后，处理消息
 		case rpcReq := <-h.remoteService.rpcServer.GetUnhandledRequestsChannel():
 			// logger.Log.Infof("pitaya.handler Dispatch -> rpc.ProcessSingleMessage <0> for ", zap.Any("rpcReq", rpcReq))
 			// logger.Log.Debugf("pitaya.handler Dispatch -> rpc.ProcessSingleMessage <0> for route=%s", rpcReq.Msg.Route)
-			h.remoteService.rpcServer.ProcessSingleMessage(rpcReq)
+			atomic.AddInt64(&h.inFlight, 1)
+			h.remoteService.executor(rpcReq).Execute(func() {
+				defer atomic.AddInt64(&h.inFlight, -1)
+				h.remoteService.rpcServer.ProcessSingleMessage(rpcReq)
+			})
 			// logger.Log.Infof("pitaya.handler Dispatch -> rpc.ProcessSingleMessage <1> for ", zap.Any("rpcReq", rpcReq))
 			// logger.Log.Debugf("pitaya.handler Dispatch -> rpc.ProcessSingleMessage <1> for route=%s", rpcReq.Msg.Route)
 
 		// timer tick
-		case <-timer.GlobalTicker.C: // execute cron task
+		case <-timer.GlobalTicker.C: // register/remove pending timers and execute cron task
 			timer.Cron()
-
-		// timer create
-		case t := <-timer.Manager.ChCreatedTimer: // new Timers
-			timer.AddTimer(t)
-
-		// timer close
-		case id := <-timer.Manager.ChClosingTimer: // closing Timers
-			timer.RemoveTimer(id)
 		}
 	}
 }
@@ -196,11 +278,28 @@ func (h *HandlerService) Register(comp component.Component, opts []component.Opt
 
 // Handle handles messages from a conn
 func (h *HandlerService) Handle(conn acceptor.PlayerConn) {
+	if h.connsByIP.max > 0 {
+		ip := remoteIP(conn.RemoteAddr())
+		if !h.connsByIP.acquire(ip) {
+			logger.Log.Warnf("Refusing connection, too many connections from %s", ip)
+			metrics.ReportRejectedConnection(h.metricsReporters, session.CloseReasonConnectionLimit.String())
+			conn.Close()
+			return
+		}
+		defer h.connsByIP.release(ip)
+	}
+
 	// create a client agent and startup write goroutine
-	a := agent.NewAgent(conn, h.decoder, h.encoder, h.serializer, h.heartbeatTimeout, h.messagesBufferSize, h.appDieChan, h.messageEncoder, h.metricsReporters)
+	a := agent.NewAgent(conn, h.decoder, h.encoder, h.serializer, h.heartbeatTimeout, h.messagesBufferSize, h.appDieChan, h.messageEncoder, h.metricsReporters, h.clock)
 	if a.ChRoleMessages == nil {
 		a.ChRoleMessages = make(chan agent.UnhandledRoleMessage, h.MessageChanSize)
 	}
+	a.SetOverflowPolicy(h.overflowPolicy, h.overflowTimeout)
+	a.SetSendKickReason(h.sendKickReason)
+	a.SetWriteTimeout(h.writeTimeout)
+	a.SetCoalescing(h.coalesceSize, h.coalesceInterval)
+	a.SetRequestTimeout(h.requestTimeout)
+	a.SetSlowConsumerPolicy(h.slowConsumerPolicy, h.slowConsumerThreshold, h.slowConsumerWindow)
 
 	// startup agent goroutine
 	go a.Handle()
@@ -209,20 +308,43 @@ func (h *HandlerService) Handle(conn acceptor.PlayerConn) {
 	logger.Log.Debugf("New session established: %s", a.String())
 
 	// guarantee agent related resource is destroyed
+	reason := session.CloseReasonProtocolError
 	defer func() {
 		// a.Session.Close()
-		a.CloseByReason(agent.AgentCloseByMessageEnd)
-		logger.Log.Debugf("Session read goroutine exit, Session:", a.Session.DebugString())
+		a.CloseByReason(reason)
+		logger.Log.Debugf("Session read goroutine exit, Session:", a.GetSession().DebugString())
 	}()
 
+	// the client must send data and finish the handshake in time
+	start := time.Now()
+	received := false
+	handshaking := h.handshakeTimeout > 0 || h.firstDataTimeout > 0
+	if handshaking {
+		setReadDeadline(conn, h.handshakeDeadline(start, received))
+	}
+
 	for {
 		// logger.Log.Debugf("pitaya.handler begin to get nextmessage for SessionID=%d, UID=%s", a.Session.ID(), a.Session.UID())
 		msg, err := conn.GetNextMessage()
 
+		if err != nil && handshaking && isTimeout(err) {
+			logger.Log.Warnf("Client did not finish the handshake in time, %s", a.GetSession().DebugString())
+			reason = session.CloseReasonHandshakeTimeout
+			metrics.ReportRejectedConnection(h.metricsReporters, reason.String())
+			return
+		}
 		if err != nil {
-			logger.Log.Errorf("Error reading next available message(session:) err: %s", a.Session.DebugString(), err.Error())
+			logger.Log.Errorf("Error reading next available message(session:) err: %s", a.GetSession().DebugString(), err.Error())
+			reason = session.CloseReasonClientDisconnect
+			if err == constants.ErrRateLimitExceeded {
+				reason = session.CloseReasonRateLimit
+			}
 			return
 		}
+		if handshaking && !received {
+			received = true
+			setReadDeadline(conn, h.handshakeDeadline(start, received))
+		}
 
 		packets, err := h.decoder.Decode(msg)
 		if err != nil {
@@ -244,6 +366,11 @@ func (h *HandlerService) Handle(conn acceptor.PlayerConn) {
 				return
 			}
 		}
+
+		if handshaking && a.GetStatus() == constants.StatusWorking {
+			handshaking = false
+			setReadDeadline(conn, time.Time{})
+		}
 	}
 }
 
@@ -257,24 +384,33 @@ func (h *HandlerService) processPacket(a *agent.Agent, p *packet.Packet) error {
 			logger.Log.Errorf("%v", err)
 			return err
 		}
+		// Parse the json sent with the handshake by the client
+		handshakeData := &session.HandshakeData{}
+		err := json.Unmarshal(p.Data, handshakeData)
+		if err == nil {
+			if token := handshakeData.Sys.ResumeToken; token != "" {
+				if rerr := a.ResumeSession(token, handshakeData.Sys.ReceivedPushes); rerr != nil {
+					logger.Log.Infof("Failed to resume session, starting a new one: %s", rerr.Error())
+				}
+			}
+			a.GetSession().IssueResumeToken()
+		}
+
 		// logger.Log.Infof("pitaya.handler end to processPacket :handshake packet for SessionID=%d, UID=%s", a.Session.ID(), a.Session.UID())
 		if err := a.SendHandshakeResponse(); err != nil {
 			logger.Log.Errorf("Error sending handshake response: %s", err.Error())
 			return err
 		}
-		logger.Log.Debugf("Session handshake Id=%d, Remote=%s", a.Session.ID(), a.RemoteAddr())
+		logger.Log.Debugf("Session handshake Id=%d, Remote=%s", a.GetSession().ID(), a.RemoteAddr())
 
-		// Parse the json sent with the handshake by the client
-		handshakeData := &session.HandshakeData{}
-		err := json.Unmarshal(p.Data, handshakeData)
 		if err != nil {
 			a.SetStatus(constants.StatusClosed)
-			return fmt.Errorf("Invalid handshake data. Id=%d", a.Session.ID())
+			return fmt.Errorf("Invalid handshake data. Id=%d", a.GetSession().ID())
 		}
 
-		a.Session.SetHandshakeData(handshakeData)
+		a.GetSession().SetHandshakeData(handshakeData)
 		a.SetStatus(constants.StatusHandshake)
-		err = a.Session.Set(constants.IPVersionKey, a.IPVersion())
+		err = a.GetSession().Set(constants.IPVersionKey, a.IPVersion())
 		if err != nil {
 			logger.Log.Warnf("failed to save ip version on session: %q\n", err)
 		}
@@ -289,7 +425,10 @@ func (h *HandlerService) processPacket(a *agent.Agent, p *packet.Packet) error {
 			return err
 		}
 		a.SetStatus(constants.StatusWorking)
-		logger.Log.Debugf("Receive handshake ACK Id=%d, Remote=%s", a.Session.ID(), a.RemoteAddr())
+		logger.Log.Debugf("Receive handshake ACK Id=%d, Remote=%s", a.GetSession().ID(), a.RemoteAddr())
+		if err := a.GetSession().ReplayPushes(); err != nil {
+			logger.Log.Warnf("Failed to replay pushes of resumed session: %s", err.Error())
+		}
 		// logger.Log.Infof("pitaya.handler end to processPacket :handshake ACK for SessionID=%d, UID=%s", a.Session.ID(), a.Session.UID())
 
 	case packet.Data:
@@ -303,12 +442,18 @@ func (h *HandlerService) processPacket(a *agent.Agent, p *packet.Packet) error {
 			return err
 		}
 
+		if msg.Type == message.ClientResponse {
+			a.HandleClientResponse(msg)
+			break
+		}
+
 		// logger.Log.Debugf("pitaya.handler begin to processMessage for SessionID=%d, UID=%s, route=%s", a.Session.ID(), a.Session.UID(), msg.Route)
 		h.processMessage(a, msg)
 		// logger.Log.Debugf("pitaya.handler end to processMessage for SessionID=%d, UID=%s, route=%s", a.Session.ID(), a.Session.UID(), msg.Route)
 
 	case packet.Heartbeat:
-		// expected
+		// clients that echo the heartbeat data let the round trip time be measured
+		a.HandleHeartbeat(p.Data)
 	}
 
 	a.SetLastAt()
@@ -324,11 +469,11 @@ func (h *HandlerService) processMessage(a *agent.Agent, msg *message.Message) {
 		"local.id":   h.server.ID,
 		"span.kind":  "server",
 		"msg.type":   strings.ToLower(msg.Type.String()),
-		"user.id":    a.Session.UID(),
+		"user.id":    a.GetSession().UID(),
 		"request.id": requestID.String(),
 	}
 	ctx = tracing.StartSpan(ctx, msg.Route, tags)
-	ctx = context.WithValue(ctx, constants.SessionCtxKey, a.Session)
+	ctx = context.WithValue(ctx, constants.SessionCtxKey, a.GetSession())
 
 	r, err := route.Decode(msg.Route)
 	if err != nil {
@@ -341,46 +486,90 @@ func (h *HandlerService) processMessage(a *agent.Agent, msg *message.Message) {
 		r.SvType = h.server.Type
 	}
 
-	// 若走 Dispatch() 协程池， 则打开以下代码 (玩家消息执行顺序无法保证!)
-	if _, ok := mapFilterRoutes[msg.Route]; ok {
+	// handlers of other server types are not known, their messages are
+	// processed in order unless their route is set as pooled
+	dispatch := component.Ordered
+	var key string
+	remote := r.SvType != h.server.Type
+	if !remote {
+		if handler, ok := handlers[r.Short()]; ok {
+			dispatch = handler.Dispatch
+			if dispatch == component.Keyed {
+				key = handler.DispatchKey(ctx, msg.Data)
+			}
+		}
+	} else if h.pooledRemoteRoutes[r.String()] {
+		dispatch = component.Pooled
+	}
 
-		//该消息由协程池竞争执行
+	switch {
+	case dispatch == component.Pooled:
+		// 该消息由协程池竞争执行 (玩家消息执行顺序无法保证!)
 		message := unhandledMessage{
 			ctx:   ctx,
 			agent: a,
 			route: r,
 			msg:   msg,
 		}
-		if r.SvType == h.server.Type {
+		if !remote {
 			h.chLocalProcess <- message
+		} else if h.remoteService != nil {
+			h.chRemoteProcess <- message
 		} else {
-			if h.remoteService != nil {
-				h.chRemoteProcess <- message
-			} else {
-				logger.Log.Warnf("request made to another server type but no remoteService running")
-			}
+			logger.Log.Warnf("request made to another server type but no remoteService running")
 		}
 
-	} else {
+	case dispatch == component.Keyed && key != "":
+		// 相同key的消息顺序执行, 例如同一个房间的消息
+		h.dispatchKeyed(key, a, agent.UnhandledRoleMessage{Ctx: ctx, Route: r, Msg: msg})
 
-		//进入用户自己的队列，顺序执行
+	default:
+		// 进入用户自己的队列，顺序执行
 		message := agent.UnhandledRoleMessage{
 			Ctx:   ctx,
 			Route: r,
 			Msg:   msg,
 		}
 
-		a.ChRoleMessages <- message
+		if err := a.PushRoleMessage(message); err != nil {
+			logger.Log.Warnf("failed to enqueue message, route=%s: %s", r.String(), err.Error())
+		}
+	}
+}
+
+// dispatchKeyed enqueues a message of a Keyed handler in the queue of key,
+// applying the overflow policy of the agents when the queue is full. The
+// queue is shared by every player sending messages with the key, so the
+// dropoldest policy drops the new message as dropnewest does
+func (h *HandlerService) dispatchKeyed(key string, a *agent.Agent, m agent.UnhandledRoleMessage) {
+	fn := func() {
+		metrics.ReportMessageProcessDelayFromCtx(m.Ctx, h.metricsReporters, "local")
+		h.localProcess(m.Ctx, a, m.Route, m.Msg)
+	}
+	timeout := time.Duration(-1)
+	if h.overflowPolicy == agent.OverflowBlock {
+		timeout = h.overflowTimeout
+	}
+	if h.keyed.tryDispatch(key, fn, timeout) {
+		return
+	}
+
+	logger.Log.Warnf("queue of key %s is full, route=%s", key, m.Route.String())
+	if h.overflowPolicy == agent.OverflowKick {
+		a.KickOverflowed(m.Ctx)
+		return
 	}
+	a.DropRoleMessage(m)
 }
 
 func (h *HandlerService) processGameMessage(a *agent.Agent) {
 
-	sid := a.Session.ID()
-	uid := a.Session.UID()
+	sid := a.GetSession().ID()
+	uid := a.GetSession().UID()
 
 	defer func() {
-		a.Session.Close()
+		// a retained session is closed when it expires
+		a.CloseSession()
 		logger.Log.Infof("processGameMessage exit, SessionID=%d, UID=%s", sid, uid)
 	}()
 
@@ -388,6 +577,11 @@ func (h *HandlerService) processGameMessage(a *agent.Agent) {
 		select {
 		case n := <-a.ChRoleMessages:
 
+			if n.Fn != nil {
+				pexec(a, n.Fn)
+				continue
+			}
+
 			if n.Ctx != nil && n.Route != nil && n.Msg != nil {
 
 				m := unhandledMessage{
@@ -397,7 +591,7 @@ func (h *HandlerService) processGameMessage(a *agent.Agent) {
 					msg:   n.Msg,
 				}
 
-				uid = a.Session.UID()
+				uid = a.GetSession().UID()
 
 				if m.route.SvType == h.server.Type {
 
@@ -411,7 +605,7 @@ func (h *HandlerService) processGameMessage(a *agent.Agent) {
 
 						// logger.Log.Debugf("pitaya.handler processGameMessage -> remoteProcess <0> for SessionID=%d, UID=%s, route=%s", m.agent.Session.ID(), m.agent.Session.UID(), m.msg.Route)
 						metrics.ReportMessageProcessDelayFromCtx(m.ctx, h.metricsReporters, "remote")
-						h.remoteService.remoteProcess(m.ctx, nil, m.agent, m.route, m.msg)
+						h.remoteProcess(m.ctx, m.agent, m.route, m.msg)
 
 						// logger.Log.Debugf("pitaya.handler processGameMessage -> remoteProcess <1> for SessionID=%d, UID=%s, route=%s", m.agent.Session.ID(), m.agent.Session.UID(), m.msg.Route)
 
@@ -427,7 +621,32 @@ func (h *HandlerService) processGameMessage(a *agent.Agent) {
 	}
 }
 
+// execute function enqueued to the agent with protection
+func pexec(a *agent.Agent, fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Log.Errorf("Call session function error, Session=%s, Error=%v", a.GetSession().DebugString(), err)
+		}
+	}()
+
+	fn()
+}
+
+// InFlight returns the number of requests being processed
+func (h *HandlerService) InFlight() int64 {
+	return atomic.LoadInt64(&h.inFlight)
+}
+
+func (h *HandlerService) remoteProcess(ctx context.Context, a *agent.Agent, route *route.Route, msg *message.Message) {
+	atomic.AddInt64(&h.inFlight, 1)
+	defer atomic.AddInt64(&h.inFlight, -1)
+	h.remoteService.remoteProcess(ctx, nil, a, route, msg)
+}
+
 func (h *HandlerService) localProcess(ctx context.Context, a *agent.Agent, route *route.Route, msg *message.Message) {
+	atomic.AddInt64(&h.inFlight, 1)
+	defer atomic.AddInt64(&h.inFlight, -1)
+
 	var mid uint
 	switch msg.Type {
 	case message.Request:
@@ -436,13 +655,13 @@ func (h *HandlerService) localProcess(ctx context.Context, a *agent.Agent, route
 		mid = 0
 	}
 
-	ret, err := processHandlerMessage(ctx, route, h.serializer, a.Session, msg.Data, msg.Type, false)
+	ret, err := processHandlerMessage(ctx, route, h.serializer, a.GetSession(), msg.Data, msg.Type, false)
 	if msg.Type != message.Notify {
 		if err != nil {
 			logger.Log.Errorf("Failed to process handler(route:%s) message: %s", route.Short(), err.Error())
 			a.AnswerWithError(ctx, mid, err)
 		} else {
-			err := a.Session.ResponseMID(ctx, mid, ret)
+			err := a.GetSession().ResponseMID(ctx, mid, ret)
 			if err != nil {
 				tracing.FinishSpan(ctx, err)
 				metrics.ReportTimingFromCtx(ctx, h.metricsReporters, handlerType, err)
@@ -22,9 +22,12 @@ package service
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"net"
 	"reflect"
 	"sync"
 	"testing"
@@ -34,6 +37,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/tutumagi/pitaya/agent"
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/cluster"
 	"github.com/tutumagi/pitaya/component"
 	"github.com/tutumagi/pitaya/conn/codec"
@@ -49,6 +53,7 @@ import (
 	"github.com/tutumagi/pitaya/route"
 	"github.com/tutumagi/pitaya/serialize/json"
 	serializemocks "github.com/tutumagi/pitaya/serialize/mocks"
+	"github.com/tutumagi/pitaya/session"
 )
 
 var (
@@ -105,6 +110,7 @@ func TestNewHandlerService(t *testing.T) {
 		remoteSvc,
 		messageEncoder,
 		mockMetricsReporters,
+		nil,
 	)
 
 	assert.NotNil(t, svc)
@@ -156,15 +162,26 @@ func TestHandlerServiceRegisterFailsIfNoHandlerMethods(t *testing.T) {
 }
 
 func TestHandlerServiceProcessMessage(t *testing.T) {
+	handlers["k.k"] = &component.Handler{Dispatch: component.Pooled}
+	defer delete(handlers, "k.k")
+	handlers["k.keyed"] = &component.Handler{
+		Dispatch:    component.Keyed,
+		DispatchKey: func(ctx context.Context, data []byte) string { return "" },
+	}
+	defer delete(handlers, "k.keyed")
+
 	tables := []struct {
-		name  string
-		msg   *message.Message
-		err   interface{}
-		local bool
+		name   string
+		msg    *message.Message
+		err    interface{}
+		local  bool
+		remote bool
 	}{
-		{"failed_decode", &message.Message{ID: 1, Route: "k.k.k.k"}, &protos.Error{Msg: "invalid route", Code: "PIT-400"}, false},
-		{"local_process", &message.Message{ID: 1, Route: "k.k"}, nil, true},
-		{"remote_process", &message.Message{ID: 1, Route: "k.k.k"}, nil, false},
+		{"failed_decode", &message.Message{ID: 1, Route: "k.k.k.k"}, &protos.Error{Msg: "invalid route", Code: "PIT-400"}, false, false},
+		{"local_process", &message.Message{ID: 1, Route: "k.k"}, nil, true, false},
+		{"remote_process", &message.Message{ID: 1, Route: "k.k.k"}, nil, false, false},
+		{"pooled_remote_process", &message.Message{ID: 1, Route: "k.k.pooled"}, nil, false, true},
+		{"keyed_without_key", &message.Message{ID: 1, Route: "k.keyed"}, nil, false, false},
 	}
 
 	for _, table := range tables {
@@ -177,6 +194,7 @@ func TestHandlerServiceProcessMessage(t *testing.T) {
 			mockConn := connmock.NewMockPlayerConn(ctrl)
 			sv := &cluster.Server{}
 			svc := NewHandlerService(nil, nil, nil, nil, 1*time.Second, 1, 1, 1, sv, &RemoteService{}, nil, nil)
+			svc.SetPooledRemoteRoutes("k.k.pooled")
 
 			if table.err != nil {
 				mockSerializer.EXPECT().Marshal(table.err).Return([]byte("err"), nil)
@@ -185,14 +203,21 @@ func TestHandlerServiceProcessMessage(t *testing.T) {
 			messageEncoder := message.NewMessagesEncoder(false)
 			mockSerializer.EXPECT().GetName()
 			ag := agent.NewAgent(mockConn, nil, packetEncoder, mockSerializer, 1*time.Second, 1, nil, messageEncoder, nil)
+			ag.ChRoleMessages = make(chan agent.UnhandledRoleMessage, 1)
 			svc.processMessage(ag, table.msg)
 
 			if table.err == nil {
 				var recvMsg unhandledMessage
 				if table.err == nil && table.local {
+					// pooled handler
 					recvMsg = helpers.ShouldEventuallyReceive(t, svc.chLocalProcess).(unhandledMessage)
-				} else if table.err == nil {
+				} else if table.remote {
+					// pooled route of another server type
 					recvMsg = helpers.ShouldEventuallyReceive(t, svc.chRemoteProcess).(unhandledMessage)
+				} else if table.err == nil {
+					// handlers of other servers and messages without key are processed in order
+					roleMsg := helpers.ShouldEventuallyReceive(t, ag.ChRoleMessages).(agent.UnhandledRoleMessage)
+					recvMsg = unhandledMessage{ctx: roleMsg.Ctx, msg: roleMsg.Msg}
 				}
 				assert.Equal(t, table.msg, recvMsg.msg)
 				assert.NotNil(t, pcontext.GetFromPropagateCtx(recvMsg.ctx, constants.StartTimeKey))
@@ -202,6 +227,46 @@ func TestHandlerServiceProcessMessage(t *testing.T) {
 	}
 }
 
+func TestHandlerServiceKeyedOverflow(t *testing.T) {
+	handlers["k.room"] = &component.Handler{
+		Dispatch:    component.Keyed,
+		DispatchKey: func(ctx context.Context, data []byte) string { return "room" },
+	}
+	defer delete(handlers, "k.room")
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	svc := NewHandlerService(nil, nil, nil, nil, 1*time.Second, 1, 1, 1, &cluster.Server{}, &RemoteService{}, nil, nil)
+	svc.SetOverflowPolicy(agent.OverflowDropNewest, 0)
+
+	// the running function and the queued one fill the queue of the key
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan bool, 1)
+	svc.keyed.dispatch("room", func() {
+		started <- true
+		<-block
+	})
+	helpers.ShouldEventuallyReceive(t, started, time.Second)
+	svc.keyed.dispatch("room", func() {})
+
+	mockSerializer.EXPECT().GetName()
+	mockMetricsReporter.EXPECT().ReportGauge(metrics.ConnectedClients, gomock.Any(), gomock.Any()).AnyTimes()
+	ag := agent.NewAgent(mockConn, nil, codec.NewPomeloPacketEncoder(), mockSerializer, 1*time.Second, 1, nil, message.NewMessagesEncoder(false), []metrics.Reporter{mockMetricsReporter})
+	ag.SetOverflowPolicy(svc.overflowPolicy, svc.overflowTimeout)
+
+	mockMetricsReporter.EXPECT().ReportCount(metrics.RoleMessagesDropped, map[string]string{"policy": "dropnewest"}, float64(1))
+	done := make(chan bool, 1)
+	go func() {
+		svc.processMessage(ag, &message.Message{Type: message.Notify, Route: "k.room"})
+		done <- true
+	}()
+	helpers.ShouldEventuallyReceive(t, done, time.Second)
+}
+
 func TestHandlerServiceLocalProcess(t *testing.T) {
 	tObj := &MyComp{}
 	m, ok := reflect.TypeOf(tObj).MethodByName("HandlerRawRaw")
@@ -286,6 +351,41 @@ func TestHandlerServiceProcessPacketHandshake(t *testing.T) {
 	}
 }
 
+func TestHandlerServiceProcessPacketHandshakeResume(t *testing.T) {
+	session.SetResumeGracePeriod(time.Minute)
+	defer session.SetResumeGracePeriod(0)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	retained := session.New(nil, true)
+	token := retained.IssueResumeToken()
+	retained.SetCloseReason(session.CloseReasonClientDisconnect)
+	assert.True(t, session.Retain(retained, func() {}))
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName().AnyTimes()
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	mockConn.EXPECT().RemoteAddr().Return(&mockAddr{}).AnyTimes()
+	packetEncoder := codec.NewPomeloPacketEncoder()
+	messageEncoder := message.NewMessagesEncoder(false)
+	svc := NewHandlerService(nil, nil, nil, nil, 1*time.Second, 1, 1, 1, nil, nil, nil, nil)
+	ag := agent.NewAgent(mockConn, nil, packetEncoder, mockSerializer, 1*time.Second, 1, nil, messageEncoder, nil)
+
+	mockConn.EXPECT().Write(gomock.Any()).Do(func(d []byte) {
+		assert.Contains(t, string(d), `"resumed":true`)
+		assert.NotContains(t, string(d), token)
+	})
+	data := fmt.Sprintf(`{"sys":{"platform":"mac","resumeToken":"%s","receivedPushes":0}}`, token)
+	err := svc.processPacket(ag, &packet.Packet{Type: packet.Handshake, Data: []byte(data)})
+	assert.NoError(t, err)
+	assert.Equal(t, retained, ag.GetSession())
+	assert.NotEqual(t, token, ag.GetSession().ResumeToken())
+
+	err = svc.processPacket(ag, &packet.Packet{Type: packet.HandshakeAck})
+	assert.NoError(t, err)
+	assert.Equal(t, constants.StatusWorking, ag.GetStatus())
+}
+
 func TestHandlerServiceProcessPacketHandshakeAck(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -326,6 +426,29 @@ func TestHandlerServiceProcessPacketHeartbeat(t *testing.T) {
 	assert.Contains(t, ag.String(), fmt.Sprintf("LastTime=%d", time.Now().Unix()))
 }
 
+func TestHandlerServiceProcessPacketHeartbeatEcho(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	packetEncoder := codec.NewPomeloPacketEncoder()
+	messageEncoder := message.NewMessagesEncoder(false)
+	svc := NewHandlerService(nil, nil, nil, nil, 1*time.Second, 1, 1, 1, nil, nil, nil, nil)
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName()
+
+	c := clock.NewManual(time.Unix(1000, 0))
+	ag := agent.NewAgent(mockConn, nil, packetEncoder, mockSerializer, 1*time.Second, 1, nil, messageEncoder, nil, c)
+	echo := make([]byte, 8)
+	binary.BigEndian.PutUint64(echo, uint64(c.Now().UnixNano()/int64(time.Millisecond)))
+	c.Advance(50 * time.Millisecond)
+
+	err := svc.processPacket(ag, &packet.Packet{Type: packet.Heartbeat, Length: len(echo), Data: echo})
+	assert.NoError(t, err)
+	assert.Equal(t, 50*time.Millisecond, ag.Session.RTT())
+}
+
 func TestHandlerServiceProcessPacketData(t *testing.T) {
 	msg := &message.Message{Type: message.Request, ID: 1, Data: []byte("ok")}
 	messageEncoder := message.NewMessagesEncoder(false)
@@ -369,6 +492,34 @@ func TestHandlerServiceProcessPacketData(t *testing.T) {
 	}
 }
 
+func TestHandlerServiceProcessPacketClientResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	packetEncoder := codec.NewPomeloPacketEncoder()
+	messageEncoder := message.NewMessagesEncoder(false)
+	svc := NewHandlerService(nil, nil, nil, nil, 1*time.Second, 1, 1, 1, &cluster.Server{}, nil, nil, nil)
+	ag := agent.NewAgent(mockConn, nil, packetEncoder, json.NewSerializer(), 1*time.Second, 1, nil, messageEncoder, nil)
+	ag.SetStatus(constants.StatusWorking)
+
+	done := make(chan []byte, 1)
+	go func() {
+		data, err := ag.Request(context.Background(), "client.ask", []byte("question"))
+		assert.NoError(t, err)
+		done <- data
+	}()
+
+	encodedMsg, err := messageEncoder.Encode(&message.Message{Type: message.ClientResponse, ID: 1, Data: []byte("answer")})
+	assert.NoError(t, err)
+	// the response is dropped until the request is sent
+	helpers.ShouldEventuallyReturn(t, func() bool {
+		assert.NoError(t, svc.processPacket(ag, &packet.Packet{Type: packet.Data, Data: encodedMsg}))
+		return len(done) == 1
+	}, true)
+	assert.Equal(t, []byte("answer"), helpers.ShouldEventuallyReceive(t, done))
+}
+
 func TestHandlerServiceHandle(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -405,3 +556,100 @@ func TestHandlerServiceHandle(t *testing.T) {
 	go svc.Handle(mockConn)
 	wg.Wait()
 }
+
+func TestHandlerServiceHandleConnectionLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	mockMetricsReporter := metricsmocks.NewMockReporter(ctrl)
+	svc := NewHandlerService(nil, nil, nil, nil, 1*time.Second, 1, 1, 1, nil, nil, nil, []metrics.Reporter{mockMetricsReporter})
+	svc.SetMaxConnectionsPerIP(1)
+	assert.True(t, svc.connsByIP.acquire("1.2.3.4"))
+
+	mockConn.EXPECT().RemoteAddr().Return(&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 3250})
+	mockMetricsReporter.EXPECT().ReportCount(metrics.RejectedConnections, map[string]string{"reason": "connection_limit"}, float64(1))
+	mockConn.EXPECT().Close()
+
+	svc.Handle(mockConn)
+	assert.Equal(t, 1, svc.connsByIP.conns["1.2.3.4"])
+}
+
+func TestHandlerServiceHandleClientDisconnect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName().AnyTimes()
+
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	packetEncoder := codec.NewPomeloPacketEncoder()
+	packetDecoder := codec.NewPomeloPacketDecoder()
+	messageEncoder := message.NewMessagesEncoder(false)
+	svc := NewHandlerService(nil, packetDecoder, packetEncoder, mockSerializer, 1*time.Second, 1, 1, 1, nil, nil, messageEncoder, nil)
+
+	handshakeBuffer := `{"sys":{"platform":"mac","libVersion":"0.3.5-release","clientBuildNumber":"20","clientVersion":"2.1"},"user":{"age":30}}`
+	handshake, err := packetEncoder.Encode(packet.Handshake, []byte(handshakeBuffer))
+	assert.NoError(t, err)
+
+	// the client goes away after the handshake
+	first := mockConn.EXPECT().GetNextMessage().Return(handshake, nil)
+	mockConn.EXPECT().GetNextMessage().Return(nil, io.EOF).After(first)
+	mockConn.EXPECT().RemoteAddr().Return(&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 3250}).AnyTimes()
+	mockConn.EXPECT().Write(gomock.Any()).AnyTimes()
+	mockConn.EXPECT().Close().MaxTimes(1)
+
+	var closeReason session.CloseReason
+	callbacks := session.SessionCloseCallbacks
+	defer func() { session.SessionCloseCallbacks = callbacks }()
+	session.OnSessionClose(func(s *session.Session) {
+		closeReason = s.CloseReason()
+	})
+
+	svc.Handle(mockConn)
+	assert.Equal(t, session.CloseReasonClientDisconnect, closeReason)
+}
+
+func TestHandlerServiceHandleHandshakeTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockSerializer := serializemocks.NewMockSerializer(ctrl)
+	mockSerializer.EXPECT().GetName().AnyTimes()
+
+	mockConn := connmock.NewMockPlayerConn(ctrl)
+	packetEncoder := codec.NewPomeloPacketEncoder()
+	packetDecoder := codec.NewPomeloPacketDecoder()
+	messageEncoder := message.NewMessagesEncoder(false)
+	svc := NewHandlerService(nil, packetDecoder, packetEncoder, mockSerializer, 1*time.Second, 1, 1, 1, nil, nil, messageEncoder, nil)
+	svc.SetHandshakeTimeouts(10*time.Second, 2*time.Second)
+	svc.SetMaxConnectionsPerIP(1)
+
+	handshakeBuffer := `{"sys":{"platform":"mac","libVersion":"0.3.5-release","clientBuildNumber":"20","clientVersion":"2.1"},"user":{"age":30}}`
+	handshake, err := packetEncoder.Encode(packet.Handshake, []byte(handshakeBuffer))
+	assert.NoError(t, err)
+
+	// the first data must arrive before the handshake deadline
+	var deadlines []time.Time
+	mockConn.EXPECT().SetReadDeadline(gomock.Any()).Do(func(d time.Time) {
+		deadlines = append(deadlines, d)
+	}).Times(2)
+	first := mockConn.EXPECT().GetNextMessage().Return(handshake, nil)
+	mockConn.EXPECT().GetNextMessage().Return(nil, timeoutError{}).After(first)
+	mockConn.EXPECT().RemoteAddr().Return(&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 3250}).AnyTimes()
+	mockConn.EXPECT().Write(gomock.Any()).AnyTimes()
+	mockConn.EXPECT().Close().MaxTimes(1)
+
+	var closeReason session.CloseReason
+	callbacks := session.SessionCloseCallbacks
+	defer func() { session.SessionCloseCallbacks = callbacks }()
+	session.OnSessionClose(func(s *session.Session) {
+		closeReason = s.CloseReason()
+	})
+
+	svc.Handle(mockConn)
+	assert.Equal(t, session.CloseReasonHandshakeTimeout, closeReason)
+	assert.Len(t, deadlines, 2)
+	assert.Equal(t, 8*time.Second, deadlines[1].Sub(deadlines[0]))
+	assert.Empty(t, svc.connsByIP.conns)
+}
@@ -0,0 +1,142 @@
+// Copyright (c) nano Authors and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tutumagi/pitaya/logger"
+)
+
+type (
+	// keyedDispatcher runs functions sharing a key one at a time and in
+	// order, each key with pending functions has its own goroutine
+	keyedDispatcher struct {
+		mu        sync.Mutex
+		queues    map[string]*keyedQueue
+		queueSize int
+	}
+
+	keyedQueue struct {
+		ch      chan func()
+		pending int // functions enqueued and not finished, guarded by mu
+	}
+)
+
+func newKeyedDispatcher(queueSize int) *keyedDispatcher {
+	return &keyedDispatcher{
+		queues:    make(map[string]*keyedQueue),
+		queueSize: queueSize,
+	}
+}
+
+// dispatch enqueues fn to run after the previous functions of key, it
+// blocks while the queue of key is full
+func (d *keyedDispatcher) dispatch(key string, fn func()) {
+	q := d.queue(key)
+	q.ch <- fn
+}
+
+// tryDispatch enqueues fn like dispatch but waits at most timeout for room
+// in the queue of key, a zero timeout waits forever and a negative one
+// doesn't wait. It returns whether fn was enqueued
+func (d *keyedDispatcher) tryDispatch(key string, fn func(), timeout time.Duration) bool {
+	q := d.queue(key)
+	select {
+	case q.ch <- fn:
+		return true
+	default:
+	}
+
+	if timeout >= 0 {
+		var expired <-chan time.Time
+		if timeout > 0 {
+			t := time.NewTimer(timeout)
+			defer t.Stop()
+			expired = t.C
+		}
+		select {
+		case q.ch <- fn:
+			return true
+		case <-expired:
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	q.pending--
+	if q.pending == 0 {
+		// nothing is queued, stop the goroutine of the key
+		delete(d.queues, key)
+		close(q.ch)
+	}
+	return false
+}
+
+// queue returns the queue of key counting a new pending function, starting
+// the goroutine of the key if it has none
+func (d *keyedDispatcher) queue(key string) *keyedQueue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	q, ok := d.queues[key]
+	if !ok {
+		q = &keyedQueue{ch: make(chan func(), d.queueSize)}
+		d.queues[key] = q
+		go d.run(key, q)
+	}
+	q.pending++
+	return q
+}
+
+// run executes the functions of key until none is pending
+func (d *keyedDispatcher) run(key string, q *keyedQueue) {
+	for fn := range q.ch {
+		d.exec(key, fn)
+
+		d.mu.Lock()
+		q.pending--
+		if q.pending == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		d.mu.Unlock()
+	}
+}
+
+func (d *keyedDispatcher) exec(key string, fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Log.Errorf("Call keyed function error, Key=%s, Error=%v", key, err)
+		}
+	}()
+
+	fn()
+}
+
+// size returns the number of keys with pending functions
+func (d *keyedDispatcher) size() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.queues)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) nano Authors and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/helpers"
+)
+
+func TestKeyedDispatcherOrder(t *testing.T) {
+	t.Parallel()
+	d := newKeyedDispatcher(10)
+
+	var (
+		mu     sync.Mutex
+		result = map[string][]int{}
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 100; i++ {
+		for _, key := range []string{"room1", "room2"} {
+			i, key := i, key
+			wg.Add(1)
+			d.dispatch(key, func() {
+				defer wg.Done()
+				mu.Lock()
+				result[key] = append(result[key], i)
+				mu.Unlock()
+			})
+		}
+	}
+	wg.Wait()
+
+	for _, key := range []string{"room1", "room2"} {
+		assert.Len(t, result[key], 100)
+		for i, v := range result[key] {
+			assert.Equal(t, i, v)
+		}
+	}
+	helpers.ShouldEventuallyReturn(t, func() int { return d.size() }, 0)
+}
+
+func TestKeyedDispatcherKeysRunConcurrently(t *testing.T) {
+	t.Parallel()
+	d := newKeyedDispatcher(1)
+
+	block := make(chan struct{})
+	done := make(chan bool, 1)
+	d.dispatch("blocked", func() { <-block })
+	d.dispatch("free", func() { done <- true })
+
+	helpers.ShouldEventuallyReceive(t, done, time.Second)
+	assert.Equal(t, 1, d.size())
+	close(block)
+	helpers.ShouldEventuallyReturn(t, func() int { return d.size() }, 0)
+}
+
+func TestKeyedDispatcherRecoversPanic(t *testing.T) {
+	t.Parallel()
+	d := newKeyedDispatcher(1)
+
+	done := make(chan bool, 1)
+	d.dispatch("key", func() { panic("bla") })
+	d.dispatch("key", func() { done <- true })
+	helpers.ShouldEventuallyReceive(t, done, time.Second)
+}
+
+func TestKeyedDispatcherTryDispatchFullQueue(t *testing.T) {
+	t.Parallel()
+	d := newKeyedDispatcher(1)
+
+	block := make(chan struct{})
+	started := make(chan bool, 1)
+	d.dispatch("key", func() {
+		started <- true
+		<-block
+	})
+	helpers.ShouldEventuallyReceive(t, started, time.Second)
+	assert.True(t, d.tryDispatch("key", func() {}, -1))
+
+	// the queue is full, the function is not enqueued
+	assert.False(t, d.tryDispatch("key", func() {}, -1))
+	start := time.Now()
+	assert.False(t, d.tryDispatch("key", func() {}, 20*time.Millisecond))
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+
+	close(block)
+	helpers.ShouldEventuallyReturn(t, func() int { return d.size() }, 0)
+}
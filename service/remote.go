@@ -58,6 +58,8 @@ type RemoteService struct {
 	messageEncoder         message.Encoder
 	server                 *cluster.Server // server obj
 	remoteBindingListeners []cluster.RemoteBindingListener
+	pool                   *workerPool      // processes the requests of Pooled remotes
+	mailboxes              *keyedDispatcher // processes the requests of Keyed remotes
 }
 
 // NewRemoteService creates and return a new RemoteService
@@ -70,6 +72,8 @@ func NewRemoteService(
 	router *router.Router,
 	messageEncoder message.Encoder,
 	server *cluster.Server,
+	poolSize,
+	mailboxSize int,
 ) *RemoteService {
 	return &RemoteService{
 		services:               make(map[string]*component.Service),
@@ -82,6 +86,8 @@ func NewRemoteService(
 		messageEncoder:         messageEncoder,
 		server:                 server,
 		remoteBindingListeners: make([]cluster.RemoteBindingListener, 0),
+		pool:                   newWorkerPool(poolSize),
+		mailboxes:              newKeyedDispatcher(mailboxSize),
 	}
 }
 
@@ -94,22 +100,24 @@ func (r *RemoteService) remoteProcess(
 	route *route.Route,
 	msg *message.Message,
 ) {
+	ctx, cancel := withHandlerDeadline(ctx, route, false)
+	defer cancel()
 
 	switch msg.Type {
 	case message.Request:
-		res, err := r.remoteCall(ctx, server, protos.RPCType_Sys, route, a.Session, msg)
+		res, err := r.remoteCall(ctx, server, protos.RPCType_Sys, route, a.GetSession(), msg)
 		if err != nil {
 			logger.Log.Errorf("Failed to process remote(%s): %s", route, err.Error())
 			a.AnswerWithError(ctx, msg.ID, err)
 			return
 		}
-		err = a.Session.ResponseMID(ctx, msg.ID, res.Data)
+		err = a.GetSession().ResponseMID(ctx, msg.ID, res.Data)
 		if err != nil {
 			logger.Log.Errorf("Failed to respond remote(%s): %s", route, err.Error())
 			a.AnswerWithError(ctx, msg.ID, err)
 		}
 	case message.Notify:
-		err := r.remoteSend(ctx, server, protos.RPCType_Sys, route, a.Session, msg)
+		err := r.remoteSend(ctx, server, protos.RPCType_Sys, route, a.GetSession(), msg)
 		defer tracing.FinishSpan(ctx, err)
 
 		if err != nil {
@@ -136,7 +144,10 @@ func (r *RemoteService) Call(ctx context.Context, req *protos.Request) (*protos.
 			},
 		}
 	} else {
-		res = processRemoteMessage(c, req, r)
+		var cancel context.CancelFunc
+		c, cancel = withPropagatedDeadline(c)
+		defer cancel()
+		res = r.processUnexpired(c, req)
 	}
 
 	if res.Error != nil {
@@ -149,19 +160,26 @@ func (r *RemoteService) Call(ctx context.Context, req *protos.Request) (*protos.
 
 // SessionBindRemote is called when a remote server binds a user session and want us to acknowledge it
 func (r *RemoteService) SessionBindRemote(ctx context.Context, msg *protos.BindMsg) (*protos.Response, error) {
-	for _, r := range r.remoteBindingListeners {
-		r.OnUserBind(msg.Uid, msg.Fid)
+	for _, l := range r.remoteBindingListeners {
+		if msg.RoleID == "" {
+			l.OnUserBind(msg.Uid, msg.Fid)
+		} else if rl, ok := l.(cluster.RemoteRoleBindingListener); ok {
+			rl.OnRoleBind(msg.RoleID, msg.Fid)
+		}
 	}
 	return &protos.Response{
 		Data: []byte("ack"),
 	}, nil
 }
 
-// PushToUser sends a push to user
+// PushToUser sends a push to user, or to a role if the push has a role id
 func (r *RemoteService) PushToUser(ctx context.Context, push *protos.Push) (*protos.Response, error) {
 	// 去掉这个日志打印 by 涂飞
 	// logger.Log.Debugf("sending push to user %s: %v", push.GetUid(), string(push.Data))
 	s := session.GetSessionByUID(push.GetUid())
+	if push.GetRoleID() != "" {
+		s = session.GetSessionByRoleID(push.GetRoleID())
+	}
 	if s != nil {
 		err := s.Push(push.Route, push.Data)
 		if err != nil {
@@ -174,10 +192,13 @@ func (r *RemoteService) PushToUser(ctx context.Context, push *protos.Push) (*pro
 	return nil, constants.ErrSessionNotFound
 }
 
-// KickUser sends a kick to user
+// KickUser sends a kick to user, or to a role if the kick has a role id
 func (r *RemoteService) KickUser(ctx context.Context, kick *protos.KickMsg) (*protos.KickAnswer, error) {
 	logger.Log.Debugf("sending kick to user %s", kick.GetUserId())
 	s := session.GetSessionByUID(kick.GetUserId())
+	if kick.GetRoleID() != "" {
+		s = session.GetSessionByRoleID(kick.GetRoleID())
+	}
 	if s != nil {
 		err := s.Kick(ctx)
 		if err != nil {
@@ -312,6 +333,22 @@ func (r *RemoteService) Register(comp component.Component, opts []component.Opti
 	return nil
 }
 
+// processUnexpired processes req unless its deadline passed already
+func (r *RemoteService) processUnexpired(ctx context.Context, req *protos.Request) *protos.Response {
+	if ctx.Err() != nil {
+		return &protos.Response{
+			Error: &protos.Error{
+				Code: e.ErrDeadlineExceededCode,
+				Msg:  constants.ErrRequestDeadlineExceeded.Error(),
+				Metadata: map[string]string{
+					"route": req.GetMsg().GetRoute(),
+				},
+			},
+		}
+	}
+	return processRemoteMessage(ctx, req, r)
+}
+
 func processRemoteMessage(ctx context.Context, req *protos.Request, r *RemoteService) *protos.Response {
 	rt, err := route.Decode(req.GetMsg().GetRoute())
 	if err != nil {
@@ -80,7 +80,7 @@ func TestNewRemoteService(t *testing.T) {
 	mockMessageEncoder := messagemocks.NewMockEncoder(ctrl)
 	router := router.New()
 	sv := &cluster.Server{}
-	svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, mockMessageEncoder, sv)
+	svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, mockMessageEncoder, sv, 0, 0)
 
 	assert.NotNil(t, svc)
 	assert.Empty(t, svc.services)
@@ -94,7 +94,7 @@ func TestNewRemoteService(t *testing.T) {
 }
 
 func TestRemoteServiceRegister(t *testing.T) {
-	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil)
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
 	err := svc.Register(&MyComp{}, []component.Option{})
 	assert.NoError(t, err)
 	defer func() { remotes = make(map[string]*component.Remote, 0) }()
@@ -117,7 +117,7 @@ func TestRemoteServiceRegister(t *testing.T) {
 }
 
 func TestRemoteServiceAddRemoteBindingListener(t *testing.T) {
-	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil)
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockBindingListener := clustermocks.NewMockRemoteBindingListener(ctrl)
@@ -127,7 +127,7 @@ func TestRemoteServiceAddRemoteBindingListener(t *testing.T) {
 }
 
 func TestRemoteServiceSessionBindRemote(t *testing.T) {
-	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil)
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 	mockBindingListener := clustermocks.NewMockRemoteBindingListener(ctrl)
@@ -147,8 +147,60 @@ func TestRemoteServiceSessionBindRemote(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+type roleBindingListener struct {
+	*clustermocks.MockRemoteBindingListener
+	*clustermocks.MockRemoteRoleBindingListener
+}
+
+func TestRemoteServiceSessionBindRemoteRole(t *testing.T) {
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	userListener := clustermocks.NewMockRemoteBindingListener(ctrl)
+	roleListener := clustermocks.NewMockRemoteRoleBindingListener(ctrl)
+
+	// only listeners of role bindings are told about them
+	svc.AddRemoteBindingListener(userListener)
+	svc.AddRemoteBindingListener(&roleBindingListener{
+		clustermocks.NewMockRemoteBindingListener(ctrl),
+		roleListener,
+	})
+
+	msg := &protos.BindMsg{
+		RoleID: "role",
+		Fid:    "fid",
+	}
+	roleListener.EXPECT().OnRoleBind(msg.RoleID, msg.Fid)
+
+	_, err := svc.SessionBindRemote(context.Background(), msg)
+	assert.NoError(t, err)
+}
+
+func TestRemoteServicePushToRole(t *testing.T) {
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockNetEntity := sessionmocks.NewMockNetworkEntity(ctrl)
+	ss := session.New(mockNetEntity, true)
+	ss.SetRoleID("role1")
+
+	push := &protos.Push{Route: "sv.svc.mth", RoleID: "role1", Data: []byte{0x01}}
+	mockNetEntity.EXPECT().Push(push.Route, push.Data)
+	_, err := svc.PushToUser(context.Background(), push)
+	assert.NoError(t, err)
+
+	mockNetEntity.EXPECT().Kick(context.Background())
+	mockNetEntity.EXPECT().Close()
+	_, err = svc.KickUser(context.Background(), &protos.KickMsg{RoleID: "role1"})
+	assert.NoError(t, err)
+
+	_, err = svc.PushToUser(context.Background(), &protos.Push{RoleID: "role2"})
+	assert.Equal(t, constants.ErrSessionNotFound, err)
+}
+
 func TestRemoteServicePushToUser(t *testing.T) {
-	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil)
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -190,7 +242,7 @@ func TestRemoteServicePushToUser(t *testing.T) {
 }
 
 func TestRemoteServiceKickUser(t *testing.T) {
-	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil)
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -230,7 +282,7 @@ func TestRemoteServiceKickUser(t *testing.T) {
 }
 
 func TestRemoteServiceRegisterFailsIfRegisterTwice(t *testing.T) {
-	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil)
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
 	err := svc.Register(&MyComp{}, []component.Option{})
 	assert.NoError(t, err)
 	err = svc.Register(&MyComp{}, []component.Option{})
@@ -238,7 +290,7 @@ func TestRemoteServiceRegisterFailsIfRegisterTwice(t *testing.T) {
 }
 
 func TestRemoteServiceRegisterFailsIfNoRemoteMethods(t *testing.T) {
-	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil)
+	svc := NewRemoteService(nil, nil, nil, nil, nil, nil, nil, nil, 0, 0)
 	err := svc.Register(&NoHandlerRemoteComp{}, []component.Option{})
 	assert.Equal(t, errors.New("type NoHandlerRemoteComp has no exported methods of remote type"), err)
 }
@@ -264,7 +316,7 @@ func TestRemoteServiceRemoteCall(t *testing.T) {
 			defer ctrl.Finish()
 			mockRPCClient := clustermocks.NewMockRPCClient(ctrl)
 			router := router.New()
-			svc := NewRemoteService(mockRPCClient, nil, nil, nil, nil, router, nil, nil)
+			svc := NewRemoteService(mockRPCClient, nil, nil, nil, nil, router, nil, nil, 0, 0)
 			assert.NotNil(t, svc)
 
 			msg := &message.Message{}
@@ -329,7 +381,7 @@ func TestRemoteServiceHandleRPCUser(t *testing.T) {
 			mockRPCServer := clustermocks.NewMockRPCServer(ctrl)
 			messageEncoder := message.NewMessagesEncoder(false)
 			router := router.New()
-			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{})
+			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{}, 0, 0)
 			assert.NotNil(t, svc)
 			res := svc.handleRPCUser(context.Background(), table.req, table.rt)
 			assert.NoError(t, err)
@@ -375,7 +427,7 @@ func TestRemoteServiceHandleRPCSys(t *testing.T) {
 			mockRPCServer := clustermocks.NewMockRPCServer(ctrl)
 			messageEncoder := message.NewMessagesEncoder(false)
 			router := router.New()
-			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{})
+			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{}, 0, 0)
 			assert.NotNil(t, svc)
 
 			if table.errSubstring == "" {
@@ -420,7 +472,7 @@ func TestRemoteServiceRemoteProcess(t *testing.T) {
 			mockRPCServer := clustermocks.NewMockRPCServer(ctrl)
 			messageEncoder := message.NewMessagesEncoder(false)
 			router := router.New()
-			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{})
+			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{}, 0, 0)
 			assert.NotNil(t, svc)
 
 			expectedMsg := &message.Message{
@@ -477,7 +529,7 @@ func TestRemoteServiceRPC(t *testing.T) {
 			mockRPCServer := clustermocks.NewMockRPCServer(ctrl)
 			messageEncoder := message.NewMessagesEncoder(false)
 			router := router.New()
-			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{})
+			svc := NewRemoteService(mockRPCClient, mockRPCServer, mockSD, packetEncoder, mockSerializer, router, messageEncoder, &cluster.Server{}, 0, 0)
 			assert.NotNil(t, svc)
 
 			if table.serverID != "" {
@@ -162,6 +162,12 @@ func processHandlerMessage(
 	}
 	ctx = context.WithValue(ctx, constants.SessionCtxKey, session)
 	ctx = util.CtxWithDefaultLogger(ctx, rt.String(), session.UID())
+	ctx, cancel := withHandlerDeadline(ctx, rt, remote)
+	defer cancel()
+	if ctx.Err() != nil {
+		// expired while waiting to be processed
+		return nil, e.NewError(constants.ErrRequestDeadlineExceeded, e.ErrDeadlineExceededCode)
+	}
 
 	h, err := getHandler(rt)
 	if err != nil {
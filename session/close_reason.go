@@ -0,0 +1,102 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// CloseReason is the reason a session was closed for
+type CloseReason int32
+
+const (
+	// CloseReasonUnknown is the reason of sessions closed without a reason
+	CloseReasonUnknown CloseReason = iota
+	// CloseReasonClientDisconnect is the reason of sessions whose client closed the connection
+	CloseReasonClientDisconnect
+	// CloseReasonHeartbeatTimeout is the reason of sessions whose client stopped sending heartbeats
+	CloseReasonHeartbeatTimeout
+	// CloseReasonKicked is the reason of sessions kicked by the application
+	CloseReasonKicked
+	// CloseReasonDuplicateLogin is the reason of sessions kicked because the user logged in again
+	CloseReasonDuplicateLogin
+	// CloseReasonServerShutdown is the reason of sessions closed because the server is stopping
+	CloseReasonServerShutdown
+	// CloseReasonRateLimit is the reason of sessions whose client exceeded the rate limit
+	CloseReasonRateLimit
+	// CloseReasonProtocolError is the reason of sessions whose client sent invalid packets
+	CloseReasonProtocolError
+	// CloseReasonOverflow is the reason of sessions whose message queue overflowed
+	CloseReasonOverflow
+	// CloseReasonSlowConsumer is the reason of sessions whose client did not read its messages in time
+	CloseReasonSlowConsumer
+	// CloseReasonHandshakeTimeout is the reason of connections whose client did not send data or finish the handshake in time
+	CloseReasonHandshakeTimeout
+	// CloseReasonConnectionLimit is the reason of connections refused because their ip has too many connections
+	CloseReasonConnectionLimit
+)
+
+var closeReasonNames = map[CloseReason]string{
+	CloseReasonUnknown:          "unknown",
+	CloseReasonClientDisconnect: "client_disconnect",
+	CloseReasonHeartbeatTimeout: "heartbeat_timeout",
+	CloseReasonKicked:           "kicked",
+	CloseReasonDuplicateLogin:   "duplicate_login",
+	CloseReasonServerShutdown:   "server_shutdown",
+	CloseReasonRateLimit:        "rate_limit",
+	CloseReasonProtocolError:    "protocol_error",
+	CloseReasonOverflow:         "overflow",
+	CloseReasonSlowConsumer:     "slow_consumer",
+	CloseReasonHandshakeTimeout: "handshake_timeout",
+	CloseReasonConnectionLimit:  "connection_limit",
+}
+
+func (r CloseReason) String() string {
+	if name, ok := closeReasonNames[r]; ok {
+		return name
+	}
+	return closeReasonNames[CloseReasonUnknown]
+}
+
+// CloseReason returns the reason the session was closed for, it can be read
+// by the close callbacks
+func (s *Session) CloseReason() CloseReason {
+	return CloseReason(atomic.LoadInt32(&s.closeReason))
+}
+
+// SetCloseReason sets the reason the session is being closed for. Only the
+// first reason is kept, it returns whether reason was set
+func (s *Session) SetCloseReason(reason CloseReason) bool {
+	return atomic.CompareAndSwapInt32(&s.closeReason, int32(CloseReasonUnknown), int32(reason))
+}
+
+// resetCloseReason clears the reason of a resumed session
+func (s *Session) resetCloseReason() {
+	atomic.StoreInt32(&s.closeReason, int32(CloseReasonUnknown))
+}
+
+// KickWithReason kicks the user, giving the reason to the close callbacks and
+// to the client if the server sends kick reasons
+func (s *Session) KickWithReason(ctx context.Context, reason CloseReason) error {
+	s.SetCloseReason(reason)
+	return s.Kick(ctx)
+}
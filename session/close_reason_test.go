@@ -0,0 +1,95 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/session/mocks"
+)
+
+func TestCloseReasonString(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "duplicate_login", CloseReasonDuplicateLogin.String())
+	assert.Equal(t, "unknown", CloseReason(100).String())
+}
+
+func TestSetCloseReason(t *testing.T) {
+	t.Parallel()
+	ss := New(nil, true)
+	defer forget(ss)
+
+	assert.Equal(t, CloseReasonUnknown, ss.CloseReason())
+	assert.True(t, ss.SetCloseReason(CloseReasonHeartbeatTimeout))
+	assert.False(t, ss.SetCloseReason(CloseReasonClientDisconnect))
+	assert.Equal(t, CloseReasonHeartbeatTimeout, ss.CloseReason())
+}
+
+func TestKickCloseReason(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tables := []struct {
+		name     string
+		kick     func(s *Session) error
+		expected CloseReason
+	}{
+		{"kick", func(s *Session) error { return s.Kick(context.Background()) }, CloseReasonKicked},
+		{"kick_with_reason", func(s *Session) error {
+			return s.KickWithReason(context.Background(), CloseReasonDuplicateLogin)
+		}, CloseReasonDuplicateLogin},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			entity := mocks.NewMockNetworkEntity(ctrl)
+			ss := New(entity, true)
+			defer forget(ss)
+
+			// the reason is set before the client is told about the kick
+			entity.EXPECT().Kick(gomock.Any()).Do(func(context.Context) {
+				assert.Equal(t, table.expected, ss.CloseReason())
+			})
+			entity.EXPECT().Close()
+			assert.NoError(t, table.kick(ss))
+		})
+	}
+}
+
+func TestResumeResetsCloseReason(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 10)
+
+	ss := New(nil, true)
+	fresh := New(nil, true)
+	defer forget(ss, fresh)
+	token := ss.IssueResumeToken()
+	assert.True(t, Retain(lose(ss), func() {}))
+
+	_, err := Resume(token, fresh, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, CloseReasonUnknown, ss.CloseReason())
+}
@@ -0,0 +1,242 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/protos"
+)
+
+var dataTypes sync.Map // key -> reflect.Type of the values kept in the key
+
+// RegisterDataType registers the type of the values kept in a session key,
+// so they are decoded as that type instead of the generic types produced by
+// the data decoder, e.g. after RegisterDataType("level", int(0)) the level
+// is still an int when read in a backend session
+func RegisterDataType(key string, sample interface{}) {
+	if sample == nil {
+		dataTypes.Delete(key)
+		return
+	}
+	dataTypes.Store(key, reflect.TypeOf(sample))
+}
+
+// convertDataTypes converts the decoded values of registered keys to their types
+func convertDataTypes(data map[string]interface{}) error {
+	for k, v := range data {
+		t, ok := dataTypes.Load(k)
+		if !ok || v == nil || reflect.TypeOf(v) == t.(reflect.Type) {
+			continue
+		}
+		b, err := dataEncoder(v)
+		if err != nil {
+			return err
+		}
+		ptr := reflect.New(t.(reflect.Type))
+		if err := dataDecoder(b, ptr.Interface()); err != nil {
+			return err
+		}
+		data[k] = ptr.Elem().Interface()
+	}
+	return nil
+}
+
+func decodeData(encodedData []byte) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	if err := dataDecoder(encodedData, &data); err != nil {
+		return nil, err
+	}
+	if err := convertDataTypes(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Version returns the version of the session data, frontends bump it on
+// every change
+func (s *Session) Version() int64 {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.version
+}
+
+// SetVersion sets the version of the frontend data a backend session is based on
+func (s *Session) SetVersion(version int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.version = version
+}
+
+// touch records a change of key, frontends bump the version and backends
+// keep the key to push only the changed ones. It is called holding the lock
+func (s *Session) touch(key string, removed bool) {
+	if s.IsFrontend {
+		s.version++
+		if s.keyVersions == nil {
+			s.keyVersions = make(map[string]int64)
+		}
+		s.keyVersions[key] = s.version
+		return
+	}
+	if s.dirty == nil {
+		s.dirty = make(map[string]bool)
+	}
+	s.dirty[key] = removed
+}
+
+// touchAll records that the whole data was replaced. It is called holding the lock
+func (s *Session) touchAll() {
+	if s.IsFrontend {
+		s.version++
+		s.replacedAt = s.version
+		s.keyVersions = nil
+		return
+	}
+	s.replaced = true
+	s.dirty = nil
+}
+
+// pushData fills the data a backend pushes to the frontend, only the keys
+// changed since the last push unless the whole data was replaced
+func (s *Session) pushData(sessionData *protos.Session) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	sessionData.Version = s.version
+	if s.Stored() {
+		// written to the store already
+		sessionData.Partial = true
+		return nil
+	}
+	if s.replaced {
+		sessionData.Data = s.encodedData
+		return nil
+	}
+	changed := make(map[string]interface{}, len(s.dirty))
+	for k, removed := range s.dirty {
+		if removed {
+			sessionData.Removed = append(sessionData.Removed, k)
+		} else {
+			changed[k] = s.data[k]
+		}
+	}
+	b, err := dataEncoder(changed)
+	if err != nil {
+		return err
+	}
+	sessionData.Partial = true
+	sessionData.Data = b
+	return nil
+}
+
+// pushed clears the changes accepted by the frontend, which bumped the version
+func (s *Session) pushed() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.replaced = false
+	s.dirty = nil
+	s.version++
+}
+
+// changedAfter returns if any of the keys changed in the frontend after
+// version, any key if none is given. It is called holding the lock
+func (s *Session) changedAfter(version int64, keys ...string) bool {
+	if len(keys) == 0 {
+		return s.version > version
+	}
+	if s.replacedAt > version {
+		return true
+	}
+	for _, k := range keys {
+		if s.keyVersions[k] > version {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyPush applies the data a backend sent with PushToFront, it fails with
+// ErrSessionVersionConflict if a key it changes or removes changed after
+// the backend got the data, or if it replaces the whole data and anything
+// changed. The backend may get the session again and retry. Pushes without
+// version, sent by older backends, always win. Stored sessions reload their
+// data instead, backends wrote it to the store
+func (s *Session) ApplyPush(sessionData *protos.Session) error {
+	if s.Stored() {
+		if err := s.LoadStoredData(); err != nil {
+			return err
+		}
+		s.Lock()
+		s.version++
+		s.Unlock()
+		return nil
+	}
+
+	var data map[string]interface{}
+	if len(sessionData.Data) > 0 {
+		var err error
+		if data, err = decodeData(sessionData.Data); err != nil {
+			return err
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	var keys []string
+	if sessionData.Partial {
+		keys = append(keys, sessionData.Removed...)
+		for k := range data {
+			keys = append(keys, k)
+		}
+	}
+	if sessionData.Version != 0 && (!sessionData.Partial || len(keys) > 0) &&
+		s.changedAfter(sessionData.Version, keys...) {
+		return constants.ErrSessionVersionConflict
+	}
+	s.version++
+	if sessionData.Partial {
+		if s.keyVersions == nil {
+			s.keyVersions = make(map[string]int64)
+		}
+		for k, v := range data {
+			s.data[k] = v
+			s.keyVersions[k] = s.version
+		}
+		for _, k := range sessionData.Removed {
+			delete(s.data, k)
+			s.keyVersions[k] = s.version
+		}
+	} else {
+		if data != nil {
+			s.data = data
+		}
+		s.replacedAt = s.version
+		s.keyVersions = nil
+	}
+	return s.updateEncodedData()
+}
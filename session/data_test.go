@@ -0,0 +1,156 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/protos"
+	"github.com/tutumagi/pitaya/session/mocks"
+)
+
+func TestRegisterDataType(t *testing.T) {
+	RegisterDataType("level", int(0))
+	defer RegisterDataType("level", nil)
+
+	ss := New(nil, false)
+	assert.NoError(t, ss.SetDataEncoded([]byte(`{"level":3,"other":3}`)))
+	assert.Equal(t, 3, ss.Int("level"))
+	assert.Equal(t, float64(3), ss.Get("other"))
+}
+
+func pushedSession(t *testing.T, entity *mocks.MockNetworkEntity, ss *Session) *protos.Session {
+	t.Helper()
+	var pushed protos.Session
+	entity.EXPECT().SendRequest(gomock.Any(), ss.frontendID, constants.SessionPushRoute, gomock.Any()).
+		Do(func(_ context.Context, _, _ string, b []byte) {
+			assert.NoError(t, proto.Unmarshal(b, &pushed))
+		})
+	assert.NoError(t, ss.PushToFront(context.Background()))
+	return &pushed
+}
+
+func TestPushToFrontOnlyChangedKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, false, "uid")
+	assert.NoError(t, ss.SetDataEncoded([]byte(`{"a":"x","b":"y","c":"z"}`)))
+	ss.SetVersion(4)
+	assert.NoError(t, ss.Set("a", "w"))
+	assert.NoError(t, ss.Remove("b"))
+
+	pushed := pushedSession(t, entity, ss)
+	assert.True(t, pushed.Partial)
+	assert.Equal(t, int64(4), pushed.Version)
+	assert.Equal(t, []string{"b"}, pushed.Removed)
+	assert.JSONEq(t, `{"a":"w"}`, string(pushed.Data))
+	assert.Equal(t, int64(5), ss.Version())
+
+	pushed = pushedSession(t, entity, ss)
+	assert.True(t, pushed.Partial)
+	assert.Equal(t, int64(5), pushed.Version)
+	assert.Empty(t, pushed.Removed)
+	assert.JSONEq(t, `{}`, string(pushed.Data))
+}
+
+func TestPushToFrontReplacedData(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, false, "uid")
+	assert.NoError(t, ss.Set("a", "x"))
+	assert.NoError(t, ss.SetData(map[string]interface{}{"b": "y"}))
+
+	pushed := pushedSession(t, entity, ss)
+	assert.False(t, pushed.Partial)
+	assert.JSONEq(t, `{"b":"y"}`, string(pushed.Data))
+}
+
+func TestApplyPush(t *testing.T) {
+	RegisterDataType("count", int64(0))
+	defer RegisterDataType("count", nil)
+
+	ss := New(nil, true)
+	defer forget(ss)
+	assert.NoError(t, ss.Set("a", "x"))
+	assert.Equal(t, int64(2), ss.Version())
+
+	err := ss.ApplyPush(&protos.Session{Version: 1, Partial: true, Data: []byte(`{"a":"y"}`)})
+	assert.Equal(t, constants.ErrSessionVersionConflict, err)
+	err = ss.ApplyPush(&protos.Session{Version: 1, Partial: true, Removed: []string{"a"}})
+	assert.Equal(t, constants.ErrSessionVersionConflict, err)
+
+	err = ss.ApplyPush(&protos.Session{Version: 2, Partial: true, Data: []byte(`{"count":2}`), Removed: []string{"a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"count": int64(2)}, ss.GetData())
+	assert.Equal(t, int64(3), ss.Version())
+
+	// replacing the whole data conflicts with any change
+	err = ss.ApplyPush(&protos.Session{Version: 2, Data: []byte(`{"c":"z"}`)})
+	assert.Equal(t, constants.ErrSessionVersionConflict, err)
+	err = ss.ApplyPush(&protos.Session{Version: 3, Data: []byte(`{"c":"z"}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"c": "z"}, ss.GetData())
+	assert.JSONEq(t, `{"c":"z"}`, string(ss.GetDataEncoded()))
+}
+
+func TestApplyPushOtherKeys(t *testing.T) {
+	ss := New(nil, true)
+	defer forget(ss)
+	assert.NoError(t, ss.Set("a", "x"))
+	base := ss.Version()
+
+	// two backends got the data at the same version and change other keys
+	err := ss.ApplyPush(&protos.Session{Version: base, Partial: true, Data: []byte(`{"b":"y"}`)})
+	assert.NoError(t, err)
+	err = ss.ApplyPush(&protos.Session{Version: base, Partial: true, Data: []byte(`{"c":"z"}`), Removed: []string{"a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"b": "y", "c": "z"}, ss.GetData())
+
+	// but not the same one
+	err = ss.ApplyPush(&protos.Session{Version: base, Partial: true, Data: []byte(`{"b":"w"}`)})
+	assert.Equal(t, constants.ErrSessionVersionConflict, err)
+
+	// nor after the whole data was replaced
+	assert.NoError(t, ss.SetData(map[string]interface{}{"d": "v"}))
+	err = ss.ApplyPush(&protos.Session{Version: base + 2, Partial: true, Data: []byte(`{"e":"u"}`)})
+	assert.Equal(t, constants.ErrSessionVersionConflict, err)
+}
+
+func TestApplyPushWithoutVersion(t *testing.T) {
+	ss := New(nil, true)
+	defer forget(ss)
+	assert.NoError(t, ss.Set("a", "x"))
+
+	// backends on older versions don't send the version, the last push wins
+	err := ss.ApplyPush(&protos.Session{Data: []byte(`{"a":"y"}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": "y"}, ss.GetData())
+	assert.Equal(t, int64(3), ss.Version())
+}
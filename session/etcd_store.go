@@ -0,0 +1,209 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/clientv3/namespace"
+	"github.com/tutumagi/pitaya/config"
+	"github.com/tutumagi/pitaya/constants"
+)
+
+// EtcdStore is a Store that keeps the session data in etcd, the fields and
+// the owner of a uid are kept in a single key so every write is atomic
+type EtcdStore struct {
+	cli     *clientv3.Client
+	timeout time.Duration
+}
+
+// storedSession is the value kept for a uid
+type storedSession struct {
+	Owner  string            `json:"owner"`
+	Fields map[string][]byte `json:"fields"`
+}
+
+// NewEtcdStore returns a new etcd store, a client is created with the
+// pitaya.session.store.etcd configurations if none is given
+func NewEtcdStore(conf *config.Config, clientOrNil *clientv3.Client) (*EtcdStore, error) {
+	cli := clientOrNil
+	if cli == nil {
+		var err error
+		cli, err = clientv3.New(clientv3.Config{
+			Endpoints:   conf.GetStringSlice("pitaya.session.store.etcd.endpoints"),
+			DialTimeout: conf.GetDuration("pitaya.session.store.etcd.dialtimeout"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		cli.KV = namespace.NewKV(cli.KV, conf.GetString("pitaya.session.store.etcd.prefix"))
+	}
+	return &EtcdStore{
+		cli:     cli,
+		timeout: conf.GetDuration("pitaya.session.store.etcd.transactiontimeout"),
+	}, nil
+}
+
+// sessionKey escapes the uid so that no key is a prefix of another
+func sessionKey(uid string) string {
+	return "sessions/" + url.PathEscape(uid)
+}
+
+// get returns what is stored for the uid and the revision it was written
+// at, nil and zero if nothing is
+func (e *EtcdStore) get(ctx context.Context, uid string) (*storedSession, int64, error) {
+	res, err := e.cli.Get(ctx, sessionKey(uid))
+	if err != nil || len(res.Kvs) == 0 {
+		return nil, 0, err
+	}
+	stored := &storedSession{}
+	if err := json.Unmarshal(res.Kvs[0].Value, stored); err != nil {
+		return nil, 0, err
+	}
+	if stored.Fields == nil {
+		stored.Fields = make(map[string][]byte)
+	}
+	return stored, res.Kvs[0].ModRevision, nil
+}
+
+// put writes stored for the uid unless it was written after rev, it returns
+// if it was written
+func (e *EtcdStore) put(ctx context.Context, uid string, stored *storedSession, rev int64) (bool, error) {
+	b, err := json.Marshal(stored)
+	if err != nil {
+		return false, err
+	}
+	key := sessionKey(uid)
+	res, err := e.cli.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+		Then(clientv3.OpPut(key, string(b))).
+		Commit()
+	if err != nil {
+		return false, err
+	}
+	return res.Succeeded, nil
+}
+
+// update changes the fields of the uid with fn if owner owns them, again
+// when another server wrote them in between
+func (e *EtcdStore) update(uid, owner string, fn func(fields map[string][]byte) map[string][]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	for {
+		stored, rev, err := e.get(ctx, uid)
+		if err != nil {
+			return err
+		}
+		if stored == nil || stored.Owner != owner {
+			return constants.ErrSessionNotStoreOwner
+		}
+		stored.Fields = fn(stored.Fields)
+		if ok, err := e.put(ctx, uid, stored, rev); ok || err != nil {
+			return err
+		}
+	}
+}
+
+// Load returns the fields stored for the uid
+func (e *EtcdStore) Load(uid string) (map[string][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	stored, _, err := e.get(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return map[string][]byte{}, nil
+	}
+	return stored.Fields, nil
+}
+
+// Save stores the given fields for the uid, keeping the others, if owner
+// owns them
+func (e *EtcdStore) Save(uid, owner string, fields map[string][]byte) error {
+	return e.update(uid, owner, func(stored map[string][]byte) map[string][]byte {
+		for k, v := range fields {
+			stored[k] = v
+		}
+		return stored
+	})
+}
+
+// Delete removes the given fields of the uid, or all of them if no key is
+// given, if owner owns them
+func (e *EtcdStore) Delete(uid, owner string, keys ...string) error {
+	return e.update(uid, owner, func(stored map[string][]byte) map[string][]byte {
+		if len(keys) == 0 {
+			return map[string][]byte{}
+		}
+		for _, k := range keys {
+			delete(stored, k)
+		}
+		return stored
+	})
+}
+
+// Replace stores fields as the only fields of the uid if owner owns them
+func (e *EtcdStore) Replace(uid, owner string, fields map[string][]byte) error {
+	return e.update(uid, owner, func(map[string][]byte) map[string][]byte {
+		return fields
+	})
+}
+
+// Claim stores fields as the only fields of the uid and makes owner their
+// owner
+func (e *EtcdStore) Claim(uid, owner string, fields map[string][]byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	b, err := json.Marshal(&storedSession{Owner: owner, Fields: fields})
+	if err != nil {
+		return err
+	}
+	_, err = e.cli.Put(ctx, sessionKey(uid), string(b))
+	return err
+}
+
+// Release removes all the fields of the uid if owner still owns them
+func (e *EtcdStore) Release(uid, owner string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	for {
+		stored, rev, err := e.get(ctx, uid)
+		if err != nil || stored == nil || stored.Owner != owner {
+			return err
+		}
+		key := sessionKey(uid)
+		res, err := e.cli.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", rev)).
+			Then(clientv3.OpDelete(key)).
+			Commit()
+		if err != nil || res.Succeeded {
+			return err
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/coreos/etcd/integration"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/config"
+)
+
+func TestEtcdStore(t *testing.T) {
+	c := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer c.Terminate(t)
+	e, err := NewEtcdStore(config.NewConfig(), c.RandClient())
+	assert.NoError(t, err)
+
+	testStore(t, e)
+}
+
+func TestEtcdStoreUIDsWithSlashes(t *testing.T) {
+	c := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer c.Terminate(t)
+	e, err := NewEtcdStore(config.NewConfig(), c.RandClient())
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Claim("a", "owner", map[string][]byte{"x": []byte("1")}))
+	assert.NoError(t, e.Claim("a/b", "owner", map[string][]byte{"y": []byte("2")}))
+	fields, err := e.Load("a")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"x": []byte("1")}, fields)
+
+	assert.NoError(t, e.Release("a", "owner"))
+	fields, _ = e.Load("a/b")
+	assert.Equal(t, map[string][]byte{"y": []byte("2")}, fields)
+}
+
+func TestEtcdStoreLargeWrites(t *testing.T) {
+	c := integration.NewClusterV3(t, &integration.ClusterConfig{Size: 1})
+	defer c.Terminate(t)
+	e, err := NewEtcdStore(config.NewConfig(), c.RandClient())
+	assert.NoError(t, err)
+
+	// more fields than etcd takes operations in a transaction
+	fields := make(map[string][]byte, 300)
+	for i := 0; i < 300; i++ {
+		fields[fmt.Sprintf("k%d", i)] = []byte(fmt.Sprintf("%d", i))
+	}
+	assert.NoError(t, e.Claim("uid", "owner", fields))
+	stored, err := e.Load("uid")
+	assert.NoError(t, err)
+	assert.Equal(t, fields, stored)
+
+	assert.NoError(t, e.Replace("uid", "owner", fields))
+	stored, _ = e.Load("uid")
+	assert.Equal(t, fields, stored)
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	assert.NoError(t, e.Delete("uid", "owner", keys...))
+	stored, _ = e.Load("uid")
+	assert.Empty(t, stored)
+}
@@ -0,0 +1,72 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import "time"
+
+// RecordRTT records a round trip time measured by a heartbeat echoed by the
+// client. The smoothed round trip time and the jitter are estimated like TCP
+// and RTP do, with gains of 1/8 and 1/16.
+func (s *Session) RecordRTT(rtt time.Duration) {
+	if rtt < 0 {
+		rtt = 0
+	}
+
+	s.latencyMu.Lock()
+	defer s.latencyMu.Unlock()
+
+	if s.rttSamples == 0 {
+		s.smoothedRTT = rtt
+	} else {
+		s.smoothedRTT += (rtt - s.smoothedRTT) / 8
+		delta := rtt - s.rtt
+		if delta < 0 {
+			delta = -delta
+		}
+		s.jitter += (delta - s.jitter) / 16
+	}
+	s.rtt = rtt
+	s.rttSamples++
+}
+
+// RTT returns the last round trip time measured for the session, zero if
+// the client never echoed a heartbeat
+func (s *Session) RTT() time.Duration {
+	s.latencyMu.Lock()
+	defer s.latencyMu.Unlock()
+	return s.rtt
+}
+
+// SmoothedRTT returns the moving average of the round trip times of the
+// session
+func (s *Session) SmoothedRTT() time.Duration {
+	s.latencyMu.Lock()
+	defer s.latencyMu.Unlock()
+	return s.smoothedRTT
+}
+
+// Jitter returns the mean deviation between consecutive round trip times of
+// the session
+func (s *Session) Jitter() time.Duration {
+	s.latencyMu.Lock()
+	defer s.latencyMu.Unlock()
+	return s.jitter
+}
@@ -0,0 +1,59 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordRTT(t *testing.T) {
+	t.Parallel()
+
+	tables := []struct {
+		name     string
+		samples  []time.Duration
+		rtt      time.Duration
+		smoothed time.Duration
+		jitter   time.Duration
+	}{
+		{"no_samples", nil, 0, 0, 0},
+		{"first_sample", []time.Duration{80 * time.Millisecond}, 80 * time.Millisecond, 80 * time.Millisecond, 0},
+		{"stable", []time.Duration{80 * time.Millisecond, 80 * time.Millisecond}, 80 * time.Millisecond, 80 * time.Millisecond, 0},
+		{"zero_first_sample", []time.Duration{0, 160 * time.Millisecond}, 160 * time.Millisecond, 20 * time.Millisecond, 10 * time.Millisecond},
+		{"spike", []time.Duration{80 * time.Millisecond, 240 * time.Millisecond}, 240 * time.Millisecond, 100 * time.Millisecond, 10 * time.Millisecond},
+		{"negative", []time.Duration{-time.Millisecond}, 0, 0, 0},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ss := New(nil, false)
+			for _, rtt := range table.samples {
+				ss.RecordRTT(rtt)
+			}
+			assert.Equal(t, table.rtt, ss.RTT())
+			assert.Equal(t, table.smoothed, ss.SmoothedRTT())
+			assert.Equal(t, table.jitter, ss.Jitter())
+		})
+	}
+}
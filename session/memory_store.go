@@ -0,0 +1,137 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"sync"
+
+	"github.com/tutumagi/pitaya/constants"
+)
+
+// MemoryStore is a Store that keeps the session data in the server memory,
+// it is only shared by servers running in the same process
+type MemoryStore struct {
+	mu     sync.RWMutex
+	data   map[string]map[string][]byte
+	owners map[string]string
+}
+
+// NewMemoryStore returns a new memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		data:   make(map[string]map[string][]byte),
+		owners: make(map[string]string),
+	}
+}
+
+// Load returns the fields stored for the uid
+func (m *MemoryStore) Load(uid string) (map[string][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return copyFields(m.data[uid]), nil
+}
+
+// Save stores the given fields for the uid, keeping the others, if owner
+// owns them
+func (m *MemoryStore) Save(uid, owner string, fields map[string][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owners[uid] != owner {
+		return constants.ErrSessionNotStoreOwner
+	}
+	stored, ok := m.data[uid]
+	if !ok {
+		stored = make(map[string][]byte, len(fields))
+		m.data[uid] = stored
+	}
+	for k, v := range fields {
+		stored[k] = v
+	}
+	return nil
+}
+
+// Delete removes the given fields of the uid, or all of them if no key is
+// given, if owner owns them
+func (m *MemoryStore) Delete(uid, owner string, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owners[uid] != owner {
+		return constants.ErrSessionNotStoreOwner
+	}
+	if len(keys) == 0 {
+		delete(m.data, uid)
+		return nil
+	}
+	for _, k := range keys {
+		delete(m.data[uid], k)
+	}
+	if len(m.data[uid]) == 0 {
+		delete(m.data, uid)
+	}
+	return nil
+}
+
+// Replace stores fields as the only fields of the uid if owner owns them
+func (m *MemoryStore) Replace(uid, owner string, fields map[string][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owners[uid] != owner {
+		return constants.ErrSessionNotStoreOwner
+	}
+	m.data[uid] = copyFields(fields)
+	return nil
+}
+
+// Claim stores fields as the only fields of the uid and makes owner their
+// owner
+func (m *MemoryStore) Claim(uid, owner string, fields map[string][]byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data[uid] = copyFields(fields)
+	m.owners[uid] = owner
+	return nil
+}
+
+// Release removes all the fields of the uid if owner still owns them
+func (m *MemoryStore) Release(uid, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.owners[uid] != owner {
+		return nil
+	}
+	delete(m.data, uid)
+	delete(m.owners, uid)
+	return nil
+}
+
+func copyFields(fields map[string][]byte) map[string][]byte {
+	copied := make(map[string][]byte, len(fields))
+	for k, v := range fields {
+		copied[k] = v
+	}
+	return copied
+}
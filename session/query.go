@@ -0,0 +1,241 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/logger"
+)
+
+// Filter reports whether a session is selected by a query
+type Filter func(s *Session) bool
+
+// WithPlatform selects the sessions of clients of any of the given platforms
+func WithPlatform(platforms ...string) Filter {
+	return func(s *Session) bool {
+		hd := s.GetHandshakeData()
+		if hd == nil {
+			return false
+		}
+		for _, platform := range platforms {
+			if hd.Sys.Platform == platform {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WithClientVersion selects the sessions of clients of any of the given versions
+func WithClientVersion(versions ...string) Filter {
+	return func(s *Session) bool {
+		hd := s.GetHandshakeData()
+		if hd == nil {
+			return false
+		}
+		for _, version := range versions {
+			if hd.Sys.Version == version {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// WithClientVersionBelow selects the sessions of clients older than version.
+// Versions are compared by their dot separated parts, by the number they
+// start with first, so 1.10.0 is newer than 1.9.2 and 1.10-beta newer than
+// 1.9. A part with a suffix is older than the same number alone, 1.0-rc is
+// older than 1.0. Sessions whose client sent no version are not selected.
+func WithClientVersionBelow(version string) Filter {
+	return func(s *Session) bool {
+		hd := s.GetHandshakeData()
+		if hd == nil || hd.Sys.Version == "" {
+			return false
+		}
+		return compareVersions(hd.Sys.Version, version) < 0
+	}
+}
+
+// WithData selects the sessions whose value of key satisfies f, sessions
+// without the key are given a nil value
+func WithData(key string, f func(value interface{}) bool) Filter {
+	return func(s *Session) bool {
+		return f(s.Get(key))
+	}
+}
+
+// Not selects the sessions that are not selected by filter
+func Not(filter Filter) Filter {
+	return func(s *Session) bool {
+		return !filter(s)
+	}
+}
+
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		// missing parts count as zero, so 1.2 is the same as 1.2.0
+		ap, bp := "0", "0"
+		if i < len(as) {
+			ap = as[i]
+		}
+		if i < len(bs) {
+			bp = bs[i]
+		}
+		if c := compareVersionParts(ap, bp); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareVersionParts compares the numbers the parts start with, then what
+// follows them, a part with nothing after the number is the newer
+func compareVersionParts(a, b string) int {
+	an, arest := splitVersionPart(a)
+	bn, brest := splitVersionPart(b)
+	switch {
+	case an < bn:
+		return -1
+	case an > bn:
+		return 1
+	case arest == brest:
+		return 0
+	case arest == "":
+		return 1
+	case brest == "":
+		return -1
+	}
+	return strings.Compare(arest, brest)
+}
+
+// splitVersionPart splits the number a part starts with, -1 if it does not
+func splitVersionPart(part string) (int, string) {
+	i := 0
+	for i < len(part) && part[i] >= '0' && part[i] <= '9' {
+		i++
+	}
+	n, err := strconv.Atoi(part[:i])
+	if err != nil {
+		return -1, part
+	}
+	return n, part[i:]
+}
+
+func selected(s *Session, filters []Filter) bool {
+	for _, filter := range filters {
+		if !filter(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Range calls f for every session of this frontend server selected by all
+// the filters, stopping when f returns false. Sessions waiting to be resumed
+// have no connection and are skipped, so Sessions, Count and the other
+// queries never select them
+func Range(f func(s *Session) bool, filters ...Filter) {
+	sessionsByID.Range(func(_, value interface{}) bool {
+		s := value.(*Session)
+		if s.Detached() || !selected(s, filters) {
+			return true
+		}
+		return f(s)
+	})
+}
+
+// Sessions returns the sessions of this frontend server selected by all the filters
+func Sessions(filters ...Filter) []*Session {
+	var sessions []*Session
+	Range(func(s *Session) bool {
+		sessions = append(sessions, s)
+		return true
+	}, filters...)
+	return sessions
+}
+
+// Count returns the number of sessions of this frontend server selected by all the filters
+func Count(filters ...Filter) int {
+	count := 0
+	Range(func(s *Session) bool {
+		count++
+		return true
+	}, filters...)
+	return count
+}
+
+// PushToSessions pushes a message to the sessions selected by all the filters,
+// returning the ids of the sessions that failed
+func PushToSessions(route string, v interface{}, filters ...Filter) ([]int64, error) {
+	var failed []int64
+	Range(func(s *Session) bool {
+		if err := s.Push(route, v); err != nil {
+			failed = append(failed, s.ID())
+			logger.Log.Errorf("Session push message error, ID=%d, UID=%s, Error=%s", s.ID(), s.UID(), err.Error())
+		}
+		return true
+	}, filters...)
+	if len(failed) != 0 {
+		return failed, constants.ErrPushingToSessions
+	}
+	return nil, nil
+}
+
+// KickSessions kicks the sessions selected by all the filters, returning the
+// ids of the sessions that failed
+func KickSessions(ctx context.Context, filters ...Filter) ([]int64, error) {
+	var failed []int64
+	// kicked sessions leave the map, so they are collected before
+	for _, s := range Sessions(filters...) {
+		if err := s.Kick(ctx); err != nil {
+			failed = append(failed, s.ID())
+			logger.Log.Errorf("Session kick error, ID=%d, UID=%s, Error=%s", s.ID(), s.UID(), err.Error())
+		}
+	}
+	if len(failed) != 0 {
+		return failed, constants.ErrKickingSessions
+	}
+	return nil, nil
+}
+
+// SetOnSessions sets key to value on the sessions selected by all the filters,
+// returning the ids of the sessions that failed
+func SetOnSessions(key string, value interface{}, filters ...Filter) ([]int64, error) {
+	var failed []int64
+	Range(func(s *Session) bool {
+		if err := s.Set(key, value); err != nil {
+			failed = append(failed, s.ID())
+			logger.Log.Errorf("Session set error, ID=%d, UID=%s, Key=%s, Error=%s", s.ID(), s.UID(), key, err.Error())
+		}
+		return true
+	}, filters...)
+	if len(failed) != 0 {
+		return failed, constants.ErrSettingSessionData
+	}
+	return nil, nil
+}
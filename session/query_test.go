@@ -0,0 +1,164 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/session/mocks"
+)
+
+func newQuerySession(entity NetworkEntity, platform, version string) *Session {
+	s := New(entity, true)
+	s.SetHandshakeData(&HandshakeData{
+		Sys: HandshakeClientData{Platform: platform, Version: version},
+	})
+	return s
+}
+
+func TestCompareVersions(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.9.2", "1.10.0", -1},
+		{"2.0", "1.99.99", 1},
+		{"1.0.0-beta", "1.0.0-rc", -1},
+		{"1.0.1", "1.0.0-rc", 1},
+		{"1.10-beta", "1.9", 1},
+		{"1.9-beta", "1.10", -1},
+		{"1.0-rc", "1.0", -1},
+		{"1.0", "1.0-rc", 1},
+		{"1.x", "1.0", -1},
+	}
+	for _, table := range tables {
+		t.Run(table.a+"_"+table.b, func(t *testing.T) {
+			assert.Equal(t, table.expected, compareVersions(table.a, table.b))
+		})
+	}
+}
+
+func TestQuerySessions(t *testing.T) {
+	t.Parallel()
+	platform := uuid.New().String()
+	old := newQuerySession(nil, platform, "1.9.2")
+	current := newQuerySession(nil, platform, "1.10.0")
+	other := newQuerySession(nil, uuid.New().String(), "1.0.0")
+	noHandshake := New(nil, true)
+	defer forget(old, current, other, noHandshake)
+	assert.NoError(t, current.Set("level", 10))
+
+	assert.Equal(t, 2, Count(WithPlatform(platform)))
+	assert.Equal(t, 3, Count(WithPlatform(platform, other.GetHandshakeData().Sys.Platform)))
+	assert.ElementsMatch(t, []*Session{old}, Sessions(WithPlatform(platform), WithClientVersionBelow("1.10")))
+	assert.ElementsMatch(t, []*Session{current}, Sessions(WithPlatform(platform), WithClientVersion("1.10.0")))
+	assert.ElementsMatch(t, []*Session{old}, Sessions(WithPlatform(platform), Not(WithData("level", func(v interface{}) bool {
+		return v != nil
+	}))))
+
+	visited := 0
+	Range(func(s *Session) bool {
+		visited++
+		return false
+	}, WithPlatform(platform))
+	assert.Equal(t, 1, visited)
+}
+
+func TestQuerySkipsDetachedSessions(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 1)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	platform := uuid.New().String()
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	connected := newQuerySession(nil, platform, "1.0")
+	detached := newQuerySession(entity, platform, "1.0")
+	defer forget(connected, detached)
+	detached.IssueResumeToken()
+	assert.True(t, Retain(lose(detached), func() {}))
+
+	assert.Equal(t, []*Session{connected}, Sessions(WithPlatform(platform)))
+	assert.Equal(t, 1, Count(WithPlatform(platform)))
+}
+
+func TestPushToSessions(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	platform := uuid.New().String()
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	failing := mocks.NewMockNetworkEntity(ctrl)
+	ok := newQuerySession(entity, platform, "1.0")
+	failed := newQuerySession(failing, platform, "1.0")
+	defer forget(ok, failed)
+
+	entity.EXPECT().Push("route", "msg")
+	failing.EXPECT().Push("route", "msg").Return(errors.New("broken"))
+
+	failedIDs, err := PushToSessions("route", "msg", WithPlatform(platform))
+	assert.Equal(t, constants.ErrPushingToSessions, err)
+	assert.Equal(t, []int64{failed.ID()}, failedIDs)
+}
+
+func TestKickSessions(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	platform := uuid.New().String()
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	old := newQuerySession(entity, platform, "1.0")
+	current := newQuerySession(nil, platform, "2.0")
+	defer forget(old, current)
+
+	entity.EXPECT().Kick(gomock.Any())
+	entity.EXPECT().Close()
+
+	failedIDs, err := KickSessions(context.Background(), WithPlatform(platform), WithClientVersionBelow("2"))
+	assert.NoError(t, err)
+	assert.Nil(t, failedIDs)
+}
+
+func TestSetOnSessions(t *testing.T) {
+	t.Parallel()
+	platform := uuid.New().String()
+	s1 := newQuerySession(nil, platform, "1.0")
+	s2 := newQuerySession(nil, platform, "1.0")
+	defer forget(s1, s2)
+
+	failedIDs, err := SetOnSessions("banned", true, WithPlatform(platform))
+	assert.NoError(t, err)
+	assert.Nil(t, failedIDs)
+	assert.Equal(t, true, s1.Get("banned"))
+	assert.Equal(t, true, s2.Get("banned"))
+}
@@ -0,0 +1,285 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/timer"
+)
+
+type (
+	// retainedSession is a session whose connection closed, waiting for the
+	// client to resume it
+	retainedSession struct {
+		session  *Session
+		expire   *timer.Timer
+		onExpire func()
+	}
+
+	// loggedPush is a push kept to be replayed when the session resumes
+	loggedPush struct {
+		seq     uint64
+		route   string
+		payload interface{}
+	}
+)
+
+var resume = struct {
+	sync.Mutex
+	grace    time.Duration
+	backlog  int
+	retained map[string]*retainedSession // by resume token
+}{
+	backlog:  100,
+	retained: make(map[string]*retainedSession),
+}
+
+// SetResumeGracePeriod sets how long a session is kept after its connection
+// closes, waiting for the client to resume it. Zero disables resuming.
+func SetResumeGracePeriod(grace time.Duration) {
+	resume.Lock()
+	defer resume.Unlock()
+	resume.grace = grace
+}
+
+// SetResumeBacklog sets how many of the last pushes of each session are
+// kept to be replayed when it resumes
+func SetResumeBacklog(backlog int) {
+	resume.Lock()
+	defer resume.Unlock()
+	resume.backlog = backlog
+}
+
+func resumeGracePeriod() time.Duration {
+	resume.Lock()
+	defer resume.Unlock()
+	return resume.grace
+}
+
+func newResumeToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// IssueResumeToken creates the token the client presents on the handshake
+// to resume the session, replacing the previous one. It returns an empty
+// string when resuming is disabled.
+func (s *Session) IssueResumeToken() string {
+	if resumeGracePeriod() <= 0 {
+		return ""
+	}
+
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	s.resumeToken = newResumeToken()
+	return s.resumeToken
+}
+
+// ResumeToken returns the token issued to resume the session
+func (s *Session) ResumeToken() string {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	return s.resumeToken
+}
+
+// revokeResumeToken prevents the session from being resumed
+func (s *Session) revokeResumeToken() {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	s.resumeToken = ""
+}
+
+// Generation returns how many times the session was retained, a connection
+// attached to an older generation of the session no longer owns it
+func (s *Session) Generation() uint64 {
+	return atomic.LoadUint64(&s.generation)
+}
+
+// Detached returns if the connection of the session closed and it is
+// waiting to be resumed
+func (s *Session) Detached() bool {
+	return atomic.LoadInt32(&s.detached) == 1
+}
+
+// PushCount returns the number of pushes made through the session, the
+// client reports how many it received when resuming
+func (s *Session) PushCount() uint64 {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	return s.pushSeq
+}
+
+// logPush keeps a push to be replayed, if the session can be resumed
+func (s *Session) logPush(route string, v interface{}) {
+	s.resumeMu.Lock()
+	defer s.resumeMu.Unlock()
+	if s.resumeToken == "" {
+		return
+	}
+
+	resume.Lock()
+	backlog := resume.backlog
+	resume.Unlock()
+
+	s.pushSeq++
+	s.pushes = append(s.pushes, loggedPush{seq: s.pushSeq, route: route, payload: v})
+	if len(s.pushes) > backlog {
+		s.pushes = s.pushes[len(s.pushes)-backlog:]
+	}
+}
+
+// connectionLost returns if sessions closed for r lost their connection,
+// rather than being closed on purpose
+func (r CloseReason) connectionLost() bool {
+	return r == CloseReasonClientDisconnect || r == CloseReasonHeartbeatTimeout
+}
+
+// Retain keeps s for the grace period after its connection was lost so the
+// client can resume it, onExpire is called if it does not in time. It
+// returns false if s can not be resumed or was closed on purpose. The grace
+// period is measured by a timer, on the clock set with timer.SetClock.
+func Retain(s *Session, onExpire func()) bool {
+	token := s.ResumeToken()
+	if token == "" || !s.CloseReason().connectionLost() {
+		return false
+	}
+
+	resume.Lock()
+	defer resume.Unlock()
+	if resume.grace <= 0 {
+		return false
+	}
+
+	r := &retainedSession{session: s, onExpire: onExpire}
+	atomic.AddUint64(&s.generation, 1)
+	atomic.StoreInt32(&s.detached, 1)
+	resume.retained[token] = r
+	// expired off the timer goroutine, the close callbacks may block
+	r.expire = timer.NewTimer(func() { go expireRetained(token, r) }, resume.grace, 1)
+	logger.Log.Debugf("session retained to be resumed %s", s.DebugString())
+	return true
+}
+
+func expireRetained(token string, r *retainedSession) {
+	resume.Lock()
+	if resume.retained[token] != r {
+		// resumed or expired already
+		resume.Unlock()
+		return
+	}
+	delete(resume.retained, token)
+	resume.Unlock()
+
+	r.expire.Stop()
+	atomic.StoreInt32(&r.session.detached, 0)
+	logger.Log.Debugf("retained session expired %s", r.session.DebugString())
+	r.onExpire()
+}
+
+// expire closes s now if it is waiting to be resumed
+func (s *Session) expire() {
+	token := s.ResumeToken()
+	if token == "" || !s.Detached() {
+		return
+	}
+	resume.Lock()
+	r := resume.retained[token]
+	resume.Unlock()
+	if r != nil {
+		expireRetained(token, r)
+	}
+}
+
+// Resume attaches the retained session of token to the connection of fresh,
+// the session created for the new connection, which is discarded. received
+// is the number of pushes the client got, the later ones are replayed by
+// ReplayPushes.
+func Resume(token string, fresh *Session, received uint64) (*Session, error) {
+	resume.Lock()
+	r, ok := resume.retained[token]
+	if ok {
+		delete(resume.retained, token)
+	}
+	resume.Unlock()
+	if !ok {
+		return nil, constants.ErrInvalidResumeToken
+	}
+	r.expire.Stop()
+
+	s := r.session
+	s.networkMu.Lock()
+	s.network = fresh.networkEntity()
+	s.networkMu.Unlock()
+	atomic.StoreInt32(&s.detached, 0)
+	s.resetCloseReason()
+	sessionsByID.Store(s.id, s)
+	if uid := s.UID(); uid != "" {
+		sessionsByUID.Store(uid, s)
+	}
+	if roleID := s.RoleID(); roleID != "" {
+		sessionsByRoleID.Store(roleID, s)
+	}
+
+	s.resumeMu.Lock()
+	s.replayAfter = received
+	s.replayPending = true
+	s.resumeMu.Unlock()
+
+	sessionsByID.Delete(fresh.id)
+	atomic.AddInt64(&SessionCount, -1)
+
+	logger.Log.Debugf("session resumed %s", s.DebugString())
+	return s, nil
+}
+
+// ReplayPushes sends again the pushes the client did not receive before the
+// session resumed, it does nothing if the session was not resumed
+func (s *Session) ReplayPushes() error {
+	s.resumeMu.Lock()
+	if !s.replayPending {
+		s.resumeMu.Unlock()
+		return nil
+	}
+	s.replayPending = false
+	pending := make([]loggedPush, 0, len(s.pushes))
+	for _, p := range s.pushes {
+		if p.seq > s.replayAfter {
+			pending = append(pending, p)
+		}
+	}
+	s.resumeMu.Unlock()
+
+	for _, p := range pending {
+		if err := s.networkEntity().Push(p.route, p.payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
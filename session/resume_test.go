@@ -0,0 +1,247 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/clock"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/helpers"
+	"github.com/tutumagi/pitaya/session/mocks"
+	"github.com/tutumagi/pitaya/timer"
+)
+
+func enableResume(grace time.Duration, backlog int) {
+	SetResumeGracePeriod(grace)
+	SetResumeBacklog(backlog)
+}
+
+func disableResume() {
+	SetResumeGracePeriod(0)
+	SetResumeBacklog(100)
+}
+
+// lose marks the connection of s as lost, only those sessions are retained
+func lose(s *Session) *Session {
+	s.SetCloseReason(CloseReasonClientDisconnect)
+	return s
+}
+
+// forget removes sessions left registered by a test
+func forget(sessions ...*Session) {
+	for _, s := range sessions {
+		sessionsByID.Delete(s.ID())
+		deleteIfSame(&sessionsByUID, s.UID(), s)
+	}
+}
+
+func TestIssueResumeToken(t *testing.T) {
+	defer disableResume()
+	ss := New(nil, true)
+	defer forget(ss)
+
+	assert.Empty(t, ss.IssueResumeToken())
+	assert.Empty(t, ss.ResumeToken())
+
+	enableResume(time.Minute, 10)
+	token := ss.IssueResumeToken()
+	assert.Len(t, token, 32)
+	assert.Equal(t, token, ss.ResumeToken())
+	assert.NotEqual(t, token, ss.IssueResumeToken())
+}
+
+func TestRetainWithoutToken(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 10)
+	ss := New(nil, true)
+	defer forget(ss)
+
+	assert.False(t, Retain(lose(ss), func() {}))
+	assert.False(t, ss.Detached())
+}
+
+func TestRetainDeliberateClose(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 10)
+
+	for _, reason := range []CloseReason{CloseReasonUnknown, CloseReasonServerShutdown, CloseReasonOverflow} {
+		ss := New(nil, true)
+		ss.IssueResumeToken()
+		ss.SetCloseReason(reason)
+		assert.False(t, Retain(ss, func() {}), reason.String())
+		assert.False(t, ss.Detached())
+		forget(ss)
+	}
+}
+
+func TestResume(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 2)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	oldEntity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(oldEntity, true)
+	token := ss.IssueResumeToken()
+	for _, route := range []string{"a", "b", "c"} {
+		oldEntity.EXPECT().Push(route, route)
+		assert.NoError(t, ss.Push(route, route))
+	}
+	assert.Equal(t, uint64(3), ss.PushCount())
+
+	expired := false
+	assert.True(t, Retain(lose(ss), func() { expired = true }))
+	assert.True(t, ss.Detached())
+
+	// closing a retained session only closes its connection
+	oldEntity.EXPECT().Close()
+	ss.Close()
+	assert.Equal(t, ss, GetSessionByID(ss.ID()))
+
+	// the session is registered again when resumed
+	sessionsByID.Delete(ss.ID())
+	newEntity := mocks.NewMockNetworkEntity(ctrl)
+	fresh := New(newEntity, true)
+	resumed, err := Resume(token, fresh, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, ss, resumed)
+	assert.False(t, ss.Detached())
+	assert.Nil(t, GetSessionByID(fresh.ID()))
+	assert.Equal(t, ss, GetSessionByID(ss.ID()))
+
+	// only the last two pushes are kept
+	newEntity.EXPECT().Push("b", "b")
+	newEntity.EXPECT().Push("c", "c")
+	assert.NoError(t, ss.ReplayPushes())
+	assert.NoError(t, ss.ReplayPushes())
+
+	_, err = Resume(token, fresh, 0)
+	assert.Equal(t, constants.ErrInvalidResumeToken, err)
+	assert.False(t, expired)
+
+	newEntity.EXPECT().Close()
+	ss.Close()
+}
+
+func TestResumeWhilePushing(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 2)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	oldEntity := mocks.NewMockNetworkEntity(ctrl)
+	oldEntity.EXPECT().Push("route", gomock.Any()).AnyTimes()
+	ss := New(oldEntity, true)
+	defer forget(ss)
+	token := ss.IssueResumeToken()
+	assert.True(t, Retain(lose(ss), func() {}))
+	assert.Equal(t, uint64(1), ss.Generation())
+
+	newEntity := mocks.NewMockNetworkEntity(ctrl)
+	newEntity.EXPECT().Push("route", gomock.Any()).AnyTimes()
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			ss.Push("route", i)
+		}
+	}()
+	_, err := Resume(token, New(newEntity, true), 0)
+	assert.NoError(t, err)
+	<-done
+	assert.Equal(t, newEntity, ss.networkEntity())
+}
+
+func TestRetainedSessionExpires(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 10)
+	clk := clock.NewManual(time.Now())
+	timer.SetClock(clk)
+	defer timer.SetClock(clock.New())
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, true)
+	token := ss.IssueResumeToken()
+
+	expired := make(chan bool, 1)
+	assert.True(t, Retain(lose(ss), func() { expired <- true }))
+	clk.Advance(time.Minute - time.Second)
+	timer.Cron()
+	assert.True(t, ss.Detached())
+
+	clk.Advance(time.Second)
+	timer.Cron()
+	helpers.ShouldEventuallyReceive(t, expired)
+	assert.False(t, ss.Detached())
+
+	fresh := New(nil, true)
+	defer forget(fresh)
+	_, err := Resume(token, fresh, 0)
+	assert.Equal(t, constants.ErrInvalidResumeToken, err)
+
+	entity.EXPECT().Close()
+	ss.Close()
+}
+
+func TestKickRetainedSession(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 10)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, true)
+	token := ss.IssueResumeToken()
+	fresh := New(nil, true)
+	defer forget(ss, fresh)
+
+	expired := false
+	assert.True(t, Retain(lose(ss), func() { expired = true }))
+	assert.NoError(t, ss.Kick(context.Background()))
+	assert.True(t, expired)
+	assert.False(t, ss.Detached())
+
+	_, err := Resume(token, fresh, 0)
+	assert.Equal(t, constants.ErrInvalidResumeToken, err)
+}
+
+func TestKickRevokesResumeToken(t *testing.T) {
+	defer disableResume()
+	enableResume(time.Minute, 10)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, true)
+	defer forget(ss)
+	ss.IssueResumeToken()
+
+	entity.EXPECT().Kick(gomock.Any())
+	entity.EXPECT().Close()
+	assert.NoError(t, ss.Kick(context.Background()))
+	assert.False(t, Retain(ss, func() {}))
+}
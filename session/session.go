@@ -35,6 +35,7 @@ import (
 	"github.com/tutumagi/pitaya/constants"
 	"github.com/tutumagi/pitaya/logger"
 	"github.com/tutumagi/pitaya/protos"
+	"github.com/tutumagi/pitaya/timer"
 )
 
 // NetworkEntity represent low-level network instance
@@ -47,9 +48,24 @@ type NetworkEntity interface {
 	SendRequest(ctx context.Context, serverID, route string, v interface{}) (*protos.Response, error)
 }
 
+// Executor is implemented by network entities that own a goroutine
+// processing the session messages in order, functions passed to Execute
+// run on that goroutine
+type Executor interface {
+	Execute(fn func()) error
+}
+
+// Requester is implemented by network entities that can send requests to
+// the client and wait for its response
+type Requester interface {
+	Request(ctx context.Context, route string, v interface{}) ([]byte, error)
+}
+
 var (
-	sessionBindCallbacks = make([]func(ctx context.Context, s *Session) error, 0)
-	afterBindCallbacks   = make([]func(ctx context.Context, s *Session) error, 0)
+	sessionBindCallbacks   = make([]func(ctx context.Context, s *Session) error, 0)
+	afterBindCallbacks     = make([]func(ctx context.Context, s *Session) error, 0)
+	roleBindCallbacks      = make([]func(ctx context.Context, s *Session) error, 0)
+	afterRoleBindCallbacks = make([]func(ctx context.Context, s *Session) error, 0)
 	// SessionCloseCallbacks contains global session close callbacks
 	SessionCloseCallbacks = make([]func(s *Session), 0)
 	sessionsByUID         sync.Map
@@ -66,6 +82,10 @@ type HandshakeClientData struct {
 	LibVersion  string `json:"libVersion"`
 	BuildNumber string `json:"clientBuildNumber"`
 	Version     string `json:"clientVersion"`
+	// ResumeToken is the token of the session to resume, if any
+	ResumeToken string `json:"resumeToken,omitempty"`
+	// ReceivedPushes is the number of pushes received on the resumed session
+	ReceivedPushes uint64 `json:"receivedPushes,omitempty"`
 }
 
 // HandshakeData represents information about the handshake sent by the client.
@@ -96,6 +116,36 @@ type Session struct {
 	Subscriptions     []*nats.Subscription   // subscription created on bind when using nats rpc server
 
 	roleID string // 角色ID
+
+	networkMu sync.RWMutex // protect network, replaced when resumed
+
+	timersMutex  sync.Mutex             // protect timers
+	timers       map[int64]*timer.Timer // timers bound to the session
+	timersClosed bool                   // if the session timers were already stopped
+
+	resumeMu      sync.Mutex   // protect the resume fields
+	resumeToken   string       // token the client presents to resume the session
+	pushSeq       uint64       // number of pushes made through the session
+	pushes        []loggedPush // last pushes, replayed when resuming
+	replayAfter   uint64       // number of pushes the client received before resuming
+	replayPending bool         // if the session was resumed and pushes not replayed yet
+	detached      int32        // if the connection closed and the session waits to be resumed
+	generation    uint64       // bumped when retained, closes of older connections leave the session alone
+	closeReason   int32        // reason the session was closed for, a CloseReason
+
+	storeLoad sync.Once // loads the data of backend sessions from the store once
+
+	latencyMu   sync.Mutex    // protect the latency fields
+	rtt         time.Duration // last round trip time measured by a heartbeat
+	smoothedRTT time.Duration // moving average of the round trip times
+	jitter      time.Duration // mean deviation between consecutive round trip times
+	rttSamples  int           // number of round trip times measured
+
+	version     int64            // version of the data, bumped by the frontend on every change
+	keyVersions map[string]int64 // version each key last changed at in the frontend
+	replacedAt  int64            // version the whole data was last replaced at in the frontend
+	dirty       map[string]bool  // keys changed by a backend since the last push, true if removed
+	replaced    bool             // if a backend replaced the whole data since the last push
 }
 
 type sessionIDService struct {
@@ -124,8 +174,11 @@ func New(entity NetworkEntity, frontend bool, UID ...string) *Session {
 		lastTime:         time.Now().Unix(),
 		OnCloseCallbacks: []func(){},
 		IsFrontend:       frontend,
+		timers:           make(map[int64]*timer.Timer),
 	}
 	if frontend {
+		// version 0 is left to pushes of backends that don't send it
+		s.version = 1
 		sessionsByID.Store(s.id, s)
 		atomic.AddInt64(&SessionCount, 1)
 	}
@@ -189,6 +242,31 @@ func OnAfterSessionBind(f func(ctx context.Context, s *Session) error) {
 	afterBindCallbacks = append(afterBindCallbacks, f)
 }
 
+// OnRoleBind adds a method to be called when a role is bound to a session
+// same function cannot be added twice!
+func OnRoleBind(f func(ctx context.Context, s *Session) error) {
+	sf1 := reflect.ValueOf(f)
+	for _, fun := range roleBindCallbacks {
+		sf2 := reflect.ValueOf(fun)
+		if sf1.Pointer() == sf2.Pointer() {
+			return
+		}
+	}
+	roleBindCallbacks = append(roleBindCallbacks, f)
+}
+
+// OnAfterRoleBind adds a method to be called when a role is bound and after all roleBind callbacks
+func OnAfterRoleBind(f func(ctx context.Context, s *Session) error) {
+	sf1 := reflect.ValueOf(f)
+	for _, fun := range afterRoleBindCallbacks {
+		sf2 := reflect.ValueOf(fun)
+		if sf1.Pointer() == sf2.Pointer() {
+			return
+		}
+	}
+	afterRoleBindCallbacks = append(afterRoleBindCallbacks, f)
+}
+
 // OnSessionClose adds a method that will be called when every session closes
 func OnSessionClose(f func(s *Session)) {
 	sf1 := reflect.ValueOf(f)
@@ -206,9 +284,12 @@ func CloseAll() {
 	logger.Log.Debugf("closing all sessions, %d sessions", SessionCount)
 	sessionsByID.Range(func(_, value interface{}) bool {
 		s := value.(*Session)
+		s.SetCloseReason(CloseReasonServerShutdown)
 		s.Close()
 		return true
 	})
+	// the data of the closed sessions is deleted in the background
+	flushStoreWrites()
 	logger.Log.Debug("finished closing sessions")
 }
 
@@ -238,15 +319,35 @@ func SetCustomEncodeDecode(encoder DataEncoder, decoder DataDecoder) {
 	dataDecoder = decoder
 }
 
+// networkEntity returns the network entity of the session, the connection
+// of the client changes when the session is resumed
+func (s *Session) networkEntity() NetworkEntity {
+	s.networkMu.RLock()
+	defer s.networkMu.RUnlock()
+	return s.network
+}
+
 // Push message to client
 func (s *Session) Push(route string, v interface{}) error {
-	return s.network.Push(route, v)
+	s.logPush(route, v)
+	return s.networkEntity().Push(route, v)
+}
+
+// Request sends a request to the client and returns the data of its
+// response, it fails with constants.ErrClientRequestTimeout if the client
+// does not answer in time or with the error the client answered with
+func (s *Session) Request(ctx context.Context, route string, v interface{}) ([]byte, error) {
+	r, ok := s.networkEntity().(Requester)
+	if !ok {
+		return nil, constants.ErrClientRequestsNotSupported
+	}
+	return r.Request(ctx, route, v)
 }
 
 // ResponseMID responses message to client, mid is
 // request message ID
 func (s *Session) ResponseMID(ctx context.Context, mid uint, v interface{}, err ...bool) error {
-	return s.network.ResponseMID(ctx, mid, v, err...)
+	return s.networkEntity().ResponseMID(ctx, mid, v, err...)
 }
 
 // ID returns the session id
@@ -264,15 +365,18 @@ func (s *Session) RoleID() string {
 	return s.roleID
 }
 
-// SetRoleID 设置角色ID
+// SetRoleID 设置角色ID，不会调用 role bind 回调，绑定角色应该用 BindRole
 func (s *Session) SetRoleID(rid string) {
 	s.roleID = rid
 
-	sessionsByRoleID.Store(rid, s)
+	if s.IsFrontend && rid != "" {
+		sessionsByRoleID.Store(rid, s)
+	}
 }
 
 // GetData gets the data
 func (s *Session) GetData() map[string]interface{} {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -282,10 +386,14 @@ func (s *Session) GetData() map[string]interface{} {
 // SetData sets the whole session data
 func (s *Session) SetData(data map[string]interface{}) error {
 	s.Lock()
-	defer s.Unlock()
-
 	s.data = data
-	return s.updateEncodedData()
+	s.touchAll()
+	err := s.updateEncodedData()
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.saveStored(data, true)
 }
 
 // GetDataEncoded returns the session data as an encoded value
@@ -293,17 +401,21 @@ func (s *Session) GetDataEncoded() []byte {
 	return s.encodedData
 }
 
-// SetDataEncoded sets the whole session data from an encoded value
+// SetDataEncoded sets the whole session data from an encoded value, as
+// received from another server
 func (s *Session) SetDataEncoded(encodedData []byte) error {
 	if len(encodedData) == 0 {
 		return nil
 	}
-	var data map[string]interface{}
-	err := dataDecoder(encodedData, &data)
+	data, err := decodeData(encodedData)
 	if err != nil {
 		return err
 	}
-	return s.SetData(data)
+	s.Lock()
+	defer s.Unlock()
+
+	s.data = data
+	return s.updateEncodedData()
 }
 
 // SetFrontendData sets frontend id and session id
@@ -341,7 +453,15 @@ func (s *Session) Bind(ctx context.Context, uid string) error {
 
 	// if code running on frontend server
 	if s.IsFrontend {
+		if old := GetSessionByUID(uid); old != nil && old != s {
+			// the client logged in again instead of resuming
+			old.expire()
+		}
 		sessionsByUID.Store(uid, s)
+		// the data of a new login replaces what a previous one stored
+		if err := s.claimStored(); err != nil {
+			logger.Log.Errorf("failed to save session data of %s to store: %s", uid, err)
+		}
 	} else {
 		// If frontentID is set this means it is a remote call and the current server
 		// is not the frontend server that received the user request
@@ -351,17 +471,78 @@ func (s *Session) Bind(ctx context.Context, uid string) error {
 			s.uid = ""
 			return err
 		}
+		// keep what was set before binding along with the frontend data
+		if s.Stored() {
+			if err := s.saveChangedStored(); err != nil {
+				logger.Log.Errorf("failed to save session data of %s to store: %s", uid, err)
+			}
+			if err := s.mergeStored(); err != nil {
+				logger.Log.Errorf("failed to load session data of %s from store: %s", uid, err)
+			}
+		}
+	}
+	return nil
+}
+
+// BindRole binds a role of the bound user to the session, running the role
+// bind callbacks. On backends the role is bound to the frontend session
+func (s *Session) BindRole(ctx context.Context, roleID string) error {
+	if roleID == "" {
+		return constants.ErrIllegalRoleID
+	}
+	if s.UID() == "" {
+		return constants.ErrNoUIDBind
+	}
+	if s.RoleID() != "" {
+		return constants.ErrSessionAlreadyBoundToRole
+	}
+
+	s.roleID = roleID
+	for _, cb := range roleBindCallbacks {
+		if err := cb(ctx, s); err != nil {
+			s.roleID = ""
+			return err
+		}
+	}
+
+	for _, cb := range afterRoleBindCallbacks {
+		if err := cb(ctx, s); err != nil {
+			s.roleID = ""
+			return err
+		}
+	}
+
+	if s.IsFrontend {
+		if old := GetSessionByRoleID(roleID); old != nil && old != s {
+			// the role was left in a session waiting to be resumed
+			old.expire()
+		}
+		sessionsByRoleID.Store(roleID, s)
+	} else {
+		err := s.sendRequestToFront(ctx, constants.SessionBindRoleRoute, false)
+		if err != nil {
+			logger.Log.Error("error while trying to bind role in front: ", err)
+			s.roleID = ""
+			return err
+		}
 	}
 	return nil
 }
 
 // Kick kicks the user
 func (s *Session) Kick(ctx context.Context) error {
-	err := s.network.Kick(ctx)
+	s.SetCloseReason(CloseReasonKicked)
+	if s.Detached() {
+		// the connection is gone already
+		s.expire()
+		return nil
+	}
+	s.revokeResumeToken()
+	err := s.networkEntity().Kick(ctx)
 	if err != nil {
 		return err
 	}
-	return s.network.Close()
+	return s.networkEntity().Close()
 }
 
 // OnClose adds the function it receives to the callbacks that will be called
@@ -374,13 +555,100 @@ func (s *Session) OnClose(c func()) error {
 	return nil
 }
 
+// NewTimer returns a new Timer bound to the session, fn is called with a
+// period specified by interval on the goroutine that processes the session
+// messages. The timer is stopped automatically when the session closes.
+func (s *Session) NewTimer(interval time.Duration, fn timer.Func) (*timer.Timer, error) {
+	return s.NewCountTimer(interval, timer.LoopForever, fn)
+}
+
+// AfterFunc returns a new Timer bound to the session that calls fn once
+// after duration on the goroutine that processes the session messages.
+// The timer is stopped automatically when the session closes.
+func (s *Session) AfterFunc(duration time.Duration, fn timer.Func) (*timer.Timer, error) {
+	return s.NewCountTimer(duration, 1, fn)
+}
+
+// NewCountTimer returns a new Timer bound to the session that calls fn count
+// times with a period specified by interval on the goroutine that processes
+// the session messages. The timer is stopped automatically when the session
+// closes.
+func (s *Session) NewCountTimer(interval time.Duration, count int, fn timer.Func) (*timer.Timer, error) {
+	if !s.IsFrontend {
+		return nil, constants.ErrTimerBackend
+	}
+	if fn == nil {
+		panic("pitaya/timer: nil timer function")
+	}
+	if interval <= 0 {
+		panic("non-positive interval for NewTimer")
+	}
+
+	s.timersMutex.Lock()
+	defer s.timersMutex.Unlock()
+	if s.timersClosed {
+		return nil, constants.ErrSessionClosed
+	}
+
+	var t *timer.Timer
+	remaining := count
+	t = timer.NewTimer(func() {
+		if remaining != timer.LoopForever {
+			remaining--
+			if remaining <= 0 {
+				// t is assigned while holding the lock
+				s.timersMutex.Lock()
+				delete(s.timers, t.ID)
+				s.timersMutex.Unlock()
+			}
+		}
+		s.execute(fn)
+	}, interval, count)
+	t.SetOwner(fmt.Sprintf("session %d", s.id))
+	s.timers[t.ID] = t
+	return t, nil
+}
+
+// execute runs fn on the session goroutine when the network entity has one
+func (s *Session) execute(fn func()) {
+	if e, ok := s.networkEntity().(Executor); ok {
+		if err := e.Execute(fn); err != nil {
+			logger.Log.Debugf("failed to execute session timer %s: %s", s.DebugString(), err.Error())
+		}
+		return
+	}
+	fn()
+}
+
+// StopTimers stops all timers bound to the session, timers can not be
+// created on the session after it
+func (s *Session) StopTimers() {
+	s.timersMutex.Lock()
+	defer s.timersMutex.Unlock()
+
+	s.timersClosed = true
+	for id, t := range s.timers {
+		t.Stop()
+		delete(s.timers, id)
+	}
+}
+
 // Close terminates current session, session related data will not be released,
 // all related data should be cleared explicitly in Session closed callback
 func (s *Session) Close() {
+	if s.Detached() {
+		// kept until resumed or expired
+		s.networkEntity().Close()
+		return
+	}
 	atomic.AddInt64(&SessionCount, -1)
 	sessionsByID.Delete(s.ID())
-	sessionsByUID.Delete(s.UID())
-	sessionsByRoleID.Delete(s.RoleID())
+	if deleteIfSame(&sessionsByUID, s.UID(), s) && s.IsFrontend {
+		// a session of the user on another frontend may own the data now
+		s.releaseStored()
+	}
+	deleteIfSame(&sessionsByRoleID, s.RoleID(), s)
+	s.StopTimers()
 	// TODO: this logic should be moved to nats rpc server
 	if s.IsFrontend && s.Subscriptions != nil && len(s.Subscriptions) > 0 {
 		// if the user is bound to an userid and nats rpc server is being used we need to unsubscribe
@@ -393,34 +661,56 @@ func (s *Session) Close() {
 			}
 		}
 	}
-	s.network.Close()
+	s.networkEntity().Close()
+}
+
+// deleteIfSame deletes key from m if it holds s, a later session of the
+// same user may have replaced it. It returns if the key was deleted
+func deleteIfSame(m *sync.Map, key string, s *Session) bool {
+	if val, ok := m.Load(key); ok && val.(*Session) == s {
+		m.Delete(key)
+		return true
+	}
+	return false
 }
 
 // RemoteAddr returns the remote network address.
 func (s *Session) RemoteAddr() net.Addr {
-	return s.network.RemoteAddr()
+	return s.networkEntity().RemoteAddr()
 }
 
 // Remove delete data associated with the key from session storage
 func (s *Session) Remove(key string) error {
+	s.loadStored()
 	s.Lock()
-	defer s.Unlock()
-
 	delete(s.data, key)
-	return s.updateEncodedData()
+	s.touch(key, true)
+	err := s.updateEncodedData()
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+	s.deleteStored(key)
+	return nil
 }
 
 // Set associates value with the key in session storage
 func (s *Session) Set(key string, value interface{}) error {
+	s.loadStored()
 	s.Lock()
-	defer s.Unlock()
-
 	s.data[key] = value
-	return s.updateEncodedData()
+	s.touch(key, false)
+	err := s.updateEncodedData()
+	s.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.saveStored(map[string]interface{}{key: value}, false)
 }
 
 // HasKey decides whether a key has associated value
 func (s *Session) HasKey(key string) bool {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -430,6 +720,7 @@ func (s *Session) HasKey(key string) bool {
 
 // Get returns a key value
 func (s *Session) Get(key string) interface{} {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -442,6 +733,7 @@ func (s *Session) Get(key string) interface{} {
 
 // Int returns the value associated with the key as a int.
 func (s *Session) Int(key string) int {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -459,6 +751,7 @@ func (s *Session) Int(key string) int {
 
 // Int8 returns the value associated with the key as a int8.
 func (s *Session) Int8(key string) int8 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -476,6 +769,7 @@ func (s *Session) Int8(key string) int8 {
 
 // Int16 returns the value associated with the key as a int16.
 func (s *Session) Int16(key string) int16 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -493,6 +787,7 @@ func (s *Session) Int16(key string) int16 {
 
 // Int32 returns the value associated with the key as a int32.
 func (s *Session) Int32(key string) int32 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -510,6 +805,7 @@ func (s *Session) Int32(key string) int32 {
 
 // Int64 returns the value associated with the key as a int64.
 func (s *Session) Int64(key string) int64 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -527,6 +823,7 @@ func (s *Session) Int64(key string) int64 {
 
 // Uint returns the value associated with the key as a uint.
 func (s *Session) Uint(key string) uint {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -544,6 +841,7 @@ func (s *Session) Uint(key string) uint {
 
 // Uint8 returns the value associated with the key as a uint8.
 func (s *Session) Uint8(key string) uint8 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -561,6 +859,7 @@ func (s *Session) Uint8(key string) uint8 {
 
 // Uint16 returns the value associated with the key as a uint16.
 func (s *Session) Uint16(key string) uint16 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -578,6 +877,7 @@ func (s *Session) Uint16(key string) uint16 {
 
 // Uint32 returns the value associated with the key as a uint32.
 func (s *Session) Uint32(key string) uint32 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -595,6 +895,7 @@ func (s *Session) Uint32(key string) uint32 {
 
 // Uint64 returns the value associated with the key as a uint64.
 func (s *Session) Uint64(key string) uint64 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -612,6 +913,7 @@ func (s *Session) Uint64(key string) uint64 {
 
 // Float32 returns the value associated with the key as a float32.
 func (s *Session) Float32(key string) float32 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -629,6 +931,7 @@ func (s *Session) Float32(key string) float32 {
 
 // Float64 returns the value associated with the key as a float64.
 func (s *Session) Float64(key string) float64 {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -646,6 +949,7 @@ func (s *Session) Float64(key string) float64 {
 
 // String returns the value associated with the key as a string.
 func (s *Session) String(key string) string {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -663,6 +967,7 @@ func (s *Session) String(key string) string {
 
 // Value returns the value associated with the key as a interface{}.
 func (s *Session) Value(key string) interface{} {
+	s.loadStored()
 	s.RLock()
 	defer s.RUnlock()
 
@@ -678,16 +983,22 @@ func (s *Session) PushToFront(ctx context.Context) error {
 	if s.IsFrontend {
 		return constants.ErrFrontSessionCantPushToFront
 	}
+	// the frontend reloads the data from the store
+	s.FlushStored()
 	return s.sendRequestToFront(ctx, constants.SessionPushRoute, true)
 }
 
 // Clear releases all data related to current session
 func (s *Session) Clear() {
+	if s.IsFrontend {
+		s.releaseStored()
+	}
 	s.Lock()
 	defer s.Unlock()
 
 	s.uid = ""
 	s.data = map[string]interface{}{}
+	s.touchAll()
 	s.updateEncodedData()
 }
 
@@ -711,16 +1022,21 @@ func (s *Session) sendRequestToFront(ctx context.Context, route string, includeD
 		RoleID: s.roleID,
 	}
 	if includeData {
-		sessionData.Data = s.encodedData
+		if err := s.pushData(sessionData); err != nil {
+			return err
+		}
 	}
 	b, err := proto.Marshal(sessionData)
 	if err != nil {
 		return err
 	}
-	res, err := s.network.SendRequest(ctx, s.frontendID, route, b)
+	res, err := s.networkEntity().SendRequest(ctx, s.frontendID, route, b)
 	if err != nil {
 		return err
 	}
+	if includeData {
+		s.pushed()
+	}
 	logger.Log.Debugf("%s Got response: %+v", route, res)
 	return nil
 }
@@ -257,6 +257,29 @@ func TestSessionPush(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+type requesterEntity struct {
+	*mocks.MockNetworkEntity
+}
+
+func (r *requesterEntity) Request(ctx context.Context, route string, v interface{}) ([]byte, error) {
+	return []byte(route), nil
+}
+
+func TestSessionRequest(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ss := New(&requesterEntity{mocks.NewMockNetworkEntity(ctrl)}, false)
+	data, err := ss.Request(context.Background(), "client.ask", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("client.ask"), data)
+
+	ss = New(mocks.NewMockNetworkEntity(ctrl), false)
+	_, err = ss.Request(context.Background(), "client.ask", nil)
+	assert.Equal(t, constants.ErrClientRequestsNotSupported, err)
+}
+
 func TestSessionResponseMID(t *testing.T) {
 	t.Parallel()
 
@@ -537,6 +560,100 @@ func TestSessionBindBackend(t *testing.T) {
 	}
 }
 
+func TestSessionBindRoleFails(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		name   string
+		uid    string
+		roleID string
+		bound  string
+		err    error
+	}{
+		{"empty_role", "uid", "", "", constants.ErrIllegalRoleID},
+		{"no_uid", "", "role", "", constants.ErrNoUIDBind},
+		{"already_bound", "uid", "role", "other", constants.ErrSessionAlreadyBoundToRole},
+	}
+
+	for _, table := range tables {
+		t.Run(table.name, func(t *testing.T) {
+			ss := New(nil, false, table.uid)
+			ss.roleID = table.bound
+			err := ss.BindRole(context.Background(), table.roleID)
+			assert.Equal(t, table.err, err)
+			assert.Equal(t, table.bound, ss.RoleID())
+		})
+	}
+}
+
+func TestSessionBindRoleFrontend(t *testing.T) {
+	defer func() {
+		roleBindCallbacks = make([]func(ctx context.Context, s *Session) error, 0)
+		afterRoleBindCallbacks = make([]func(ctx context.Context, s *Session) error, 0)
+	}()
+	var called []string
+	OnRoleBind(func(ctx context.Context, s *Session) error {
+		called = append(called, "bind:"+s.RoleID())
+		return nil
+	})
+	OnAfterRoleBind(func(ctx context.Context, s *Session) error {
+		called = append(called, "after:"+s.RoleID())
+		return nil
+	})
+
+	ss := New(nil, true, uuid.New().String())
+	defer sessionsByID.Delete(ss.ID())
+	roleID := uuid.New().String()
+	defer sessionsByRoleID.Delete(roleID)
+
+	err := ss.BindRole(context.Background(), roleID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleID, ss.RoleID())
+	assert.Equal(t, ss, GetSessionByRoleID(roleID))
+	assert.Equal(t, []string{"bind:" + roleID, "after:" + roleID}, called)
+}
+
+func TestSessionBindRoleCallbackFails(t *testing.T) {
+	defer func() {
+		roleBindCallbacks = make([]func(ctx context.Context, s *Session) error, 0)
+	}()
+	expected := errors.New("role is taken")
+	OnRoleBind(func(ctx context.Context, s *Session) error {
+		return expected
+	})
+
+	ss := New(nil, true, uuid.New().String())
+	defer sessionsByID.Delete(ss.ID())
+	roleID := uuid.New().String()
+
+	err := ss.BindRole(context.Background(), roleID)
+	assert.Equal(t, expected, err)
+	assert.Empty(t, ss.RoleID())
+	assert.Nil(t, GetSessionByRoleID(roleID))
+}
+
+func TestSessionBindRoleBackend(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockEntity := mocks.NewMockNetworkEntity(ctrl)
+	uid := uuid.New().String()
+	ss := New(mockEntity, false, uid)
+	roleID := uuid.New().String()
+
+	expectedRequestData, err := proto.Marshal(&protos.Session{
+		Id:     ss.frontendSessionID,
+		Uid:    uid,
+		RoleID: roleID,
+	})
+	assert.NoError(t, err)
+	ctx := context.Background()
+	mockEntity.EXPECT().SendRequest(ctx, ss.frontendID, constants.SessionBindRoleRoute, expectedRequestData).Return(&protos.Response{}, nil)
+
+	err = ss.BindRole(ctx, roleID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleID, ss.RoleID())
+	assert.Nil(t, GetSessionByRoleID(roleID))
+}
+
 func TestSessionOnCloseFailsIfBackend(t *testing.T) {
 	t.Parallel()
 
@@ -563,6 +680,40 @@ func TestSessionOnClose(t *testing.T) {
 	assert.True(t, expected)
 }
 
+func TestSessionNewTimerFailsIfBackend(t *testing.T) {
+	t.Parallel()
+
+	ss := New(nil, false)
+	assert.NotNil(t, ss)
+
+	tm, err := ss.NewTimer(time.Second, func() {})
+	assert.Nil(t, tm)
+	assert.Equal(t, constants.ErrTimerBackend, err)
+}
+
+func TestSessionStopTimers(t *testing.T) {
+	t.Parallel()
+
+	ss := New(nil, true)
+	assert.NotNil(t, ss)
+
+	tm1, err := ss.NewTimer(time.Second, func() {})
+	assert.NoError(t, err)
+	tm2, err := ss.AfterFunc(time.Second, func() {})
+	assert.NoError(t, err)
+	assert.Len(t, ss.timers, 2)
+	assert.Equal(t, fmt.Sprintf("session %d", ss.ID()), tm1.Owner())
+
+	ss.StopTimers()
+	assert.True(t, tm1.IsClose())
+	assert.True(t, tm2.IsClose())
+	assert.Len(t, ss.timers, 0)
+
+	tm, err := ss.AfterFunc(time.Second, func() {})
+	assert.Nil(t, tm)
+	assert.Equal(t, constants.ErrSessionClosed, err)
+}
+
 func TestSessionClose(t *testing.T) {
 	tables := []struct {
 		name string
@@ -1273,10 +1424,12 @@ func TestSessionPushToFront(t *testing.T) {
 			uid := uuid.New().String()
 			ss.uid = uid
 
+			// only the changed keys are pushed
 			expectedSessionData := &protos.Session{
-				Id:   ss.frontendSessionID,
-				Uid:  uid,
-				Data: ss.encodedData,
+				Id:      ss.frontendSessionID,
+				Uid:     uid,
+				Data:    ss.encodedData,
+				Partial: true,
 			}
 			expectedRequestData, err := proto.Marshal(expectedSessionData)
 			assert.NoError(t, err)
@@ -0,0 +1,264 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"fmt"
+
+	"github.com/tutumagi/pitaya/logger"
+)
+
+// Store keeps the data of bound sessions where every server can reach it,
+// fields are kept by uid and encoded with the session data encoder
+type Store interface {
+	// Load returns the fields stored for the uid
+	Load(uid string) (map[string][]byte, error)
+	// Save stores the given fields for the uid, keeping the others, if owner
+	// owns them
+	Save(uid, owner string, fields map[string][]byte) error
+	// Delete removes the given fields of the uid, or all of them if no key
+	// is given, if owner owns them
+	Delete(uid, owner string, keys ...string) error
+	// Replace stores fields as the only fields of the uid if owner owns them
+	Replace(uid, owner string, fields map[string][]byte) error
+	// Claim stores fields as the only fields of the uid and makes owner
+	// their owner
+	Claim(uid, owner string, fields map[string][]byte) error
+	// Release removes all the fields of the uid if owner still owns them
+	Release(uid, owner string) error
+}
+
+var store Store
+
+// serverID tells apart the sessions of different frontends owning stored
+// data, session ids are only unique in a server
+var serverID = newResumeToken()
+
+// SetStore sets the store that keeps the data of bound sessions. Requests
+// to other servers stop carrying the session data and backend sessions
+// read and write it in the store, on behalf of the frontend session that
+// owns it. Frontend sessions keep a copy that is reloaded when a backend
+// calls PushToFront. Writes to the store run in the background, in order
+// for each uid. A nil store keeps the data in the frontend sessions only
+func SetStore(s Store) {
+	store = s
+}
+
+// SetServerID sets the id of the server, the stored data is owned by the
+// frontend session that bound the uid, named after its server and id
+func SetServerID(id string) {
+	serverID = id
+}
+
+// Stored returns if the session data is kept in the store
+func (s *Session) Stored() bool {
+	return store != nil && s.UID() != ""
+}
+
+func encodeFields(data map[string]interface{}) (map[string][]byte, error) {
+	fields := make(map[string][]byte, len(data))
+	for k, v := range data {
+		b, err := dataEncoder(v)
+		if err != nil {
+			return nil, err
+		}
+		fields[k] = b
+	}
+	return fields, nil
+}
+
+func decodeFields(fields map[string][]byte) (map[string]interface{}, error) {
+	data := make(map[string]interface{}, len(fields))
+	for k, b := range fields {
+		var v interface{}
+		if err := dataDecoder(b, &v); err != nil {
+			return nil, err
+		}
+		data[k] = v
+	}
+	if err := convertDataTypes(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// saveStored writes fields of the session to the store, all of them
+// replacing what was stored if replace is set. The write runs in the
+// background, only encoding errors are returned
+func (s *Session) saveStored(data map[string]interface{}, replace bool) error {
+	if !s.Stored() {
+		return nil
+	}
+	fields, err := encodeFields(data)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 && !replace {
+		return nil
+	}
+	owner := s.storeOwner()
+	s.writeStored(func(st Store, uid string) error {
+		if replace {
+			return st.Replace(uid, owner, fields)
+		}
+		return st.Save(uid, owner, fields)
+	})
+	return nil
+}
+
+// saveChangedStored writes the data a backend session changed before it was
+// bound to the store
+func (s *Session) saveChangedStored() error {
+	s.RLock()
+	replaced := s.replaced
+	changed := make(map[string]interface{}, len(s.dirty))
+	var removed []string
+	if replaced {
+		for k, v := range s.data {
+			changed[k] = v
+		}
+	} else {
+		for k, rm := range s.dirty {
+			if rm {
+				removed = append(removed, k)
+			} else {
+				changed[k] = s.data[k]
+			}
+		}
+	}
+	s.RUnlock()
+
+	if len(removed) > 0 {
+		s.deleteStored(removed...)
+	}
+	return s.saveStored(changed, replaced)
+}
+
+// mergeStored loads the stored data of a backend session that was just
+// bound, keeping the keys it changed before binding
+func (s *Session) mergeStored() error {
+	var err error
+	s.storeLoad.Do(func() {
+		var fields map[string][]byte
+		if fields, err = store.Load(s.UID()); err != nil {
+			return
+		}
+		var data map[string]interface{}
+		if data, err = decodeFields(fields); err != nil {
+			return
+		}
+		s.Lock()
+		defer s.Unlock()
+
+		for k, v := range data {
+			if _, changed := s.dirty[k]; !changed && !s.replaced {
+				s.data[k] = v
+			}
+		}
+		err = s.updateEncodedData()
+	})
+	return err
+}
+
+// claimStored replaces the stored data with the data the frontend session
+// has in memory, the data is deleted when the session closes unless a later
+// session of the user claimed it
+func (s *Session) claimStored() error {
+	if !s.Stored() {
+		return nil
+	}
+	s.RLock()
+	fields, err := encodeFields(s.data)
+	s.RUnlock()
+	if err != nil {
+		return err
+	}
+	owner := s.storeOwner()
+	s.writeStored(func(st Store, uid string) error {
+		return st.Claim(uid, owner, fields)
+	})
+	return nil
+}
+
+// releaseStored deletes the stored data if the session still owns it
+func (s *Session) releaseStored() {
+	if !s.Stored() {
+		return
+	}
+	owner := s.storeOwner()
+	s.writeStored(func(st Store, uid string) error {
+		return st.Release(uid, owner)
+	})
+}
+
+// storeOwner names the frontend session owning the stored data, backend
+// sessions write it on behalf of their frontend session
+func (s *Session) storeOwner() string {
+	if !s.IsFrontend {
+		return fmt.Sprintf("%s/%d", s.frontendID, s.frontendSessionID)
+	}
+	return fmt.Sprintf("%s/%d", serverID, s.id)
+}
+
+func (s *Session) deleteStored(keys ...string) {
+	if !s.Stored() {
+		return
+	}
+	owner := s.storeOwner()
+	s.writeStored(func(st Store, uid string) error {
+		return st.Delete(uid, owner, keys...)
+	})
+}
+
+// LoadStoredData replaces the session data with the data kept in the store,
+// it does nothing if there is no store or the session is not bound
+func (s *Session) LoadStoredData() error {
+	if !s.Stored() {
+		return nil
+	}
+	s.FlushStored()
+	fields, err := store.Load(s.UID())
+	if err != nil {
+		return err
+	}
+	data, err := decodeFields(fields)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	s.data = data
+	return s.updateEncodedData()
+}
+
+// loadStored loads the data of backend sessions from the store the first
+// time it is accessed
+func (s *Session) loadStored() {
+	if s.IsFrontend || !s.Stored() {
+		return
+	}
+	s.storeLoad.Do(func() {
+		if err := s.LoadStoredData(); err != nil {
+			logger.Log.Errorf("failed to load session data of %s from store: %s", s.UID(), err)
+		}
+	})
+}
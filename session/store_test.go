@@ -0,0 +1,313 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tutumagi/pitaya/constants"
+	"github.com/tutumagi/pitaya/session/mocks"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+// testStore checks the behaviour every Store shares
+func testStore(t *testing.T, st Store) {
+	fields, err := st.Load("uid")
+	assert.NoError(t, err)
+	assert.Empty(t, fields)
+
+	// only the owner writes
+	err = st.Save("uid", "owner", map[string][]byte{"a": []byte("1")})
+	assert.Equal(t, constants.ErrSessionNotStoreOwner, err)
+	assert.NoError(t, st.Claim("uid", "owner", map[string][]byte{"a": []byte("0")}))
+
+	assert.NoError(t, st.Save("uid", "owner", map[string][]byte{"a": []byte("1"), "b": []byte("2")}))
+	assert.NoError(t, st.Save("uid", "owner", map[string][]byte{"b": []byte("3")}))
+	fields, err = st.Load("uid")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"a": []byte("1"), "b": []byte("3")}, fields)
+
+	assert.NoError(t, st.Delete("uid", "owner", "a"))
+	fields, _ = st.Load("uid")
+	assert.Equal(t, map[string][]byte{"b": []byte("3")}, fields)
+
+	assert.NoError(t, st.Delete("uid", "owner"))
+	fields, _ = st.Load("uid")
+	assert.Empty(t, fields)
+
+	assert.NoError(t, st.Save("uid", "owner", map[string][]byte{"a": []byte("1")}))
+	assert.NoError(t, st.Replace("uid", "owner", map[string][]byte{"b": []byte("2")}))
+	fields, _ = st.Load("uid")
+	assert.Equal(t, map[string][]byte{"b": []byte("2")}, fields)
+
+	// a later session took the data over
+	assert.NoError(t, st.Claim("uid", "new-owner", map[string][]byte{"c": []byte("4")}))
+	err = st.Save("uid", "owner", map[string][]byte{"a": []byte("5")})
+	assert.Equal(t, constants.ErrSessionNotStoreOwner, err)
+	err = st.Delete("uid", "owner", "c")
+	assert.Equal(t, constants.ErrSessionNotStoreOwner, err)
+	err = st.Replace("uid", "owner", map[string][]byte{})
+	assert.Equal(t, constants.ErrSessionNotStoreOwner, err)
+	fields, _ = st.Load("uid")
+	assert.Equal(t, map[string][]byte{"c": []byte("4")}, fields)
+
+	assert.NoError(t, st.Release("uid", "owner"))
+	fields, _ = st.Load("uid")
+	assert.Len(t, fields, 1)
+	assert.NoError(t, st.Release("uid", "new-owner"))
+	fields, _ = st.Load("uid")
+	assert.Empty(t, fields)
+}
+
+// claim makes the frontend sessions owners of their stored data, as Bind does
+func claim(t *testing.T, sessions ...*Session) {
+	t.Helper()
+	for _, ss := range sessions {
+		assert.NoError(t, ss.claimStored())
+		ss.FlushStored()
+	}
+}
+
+func TestSessionSetWritesToStore(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+
+	unbound := New(nil, true)
+	bound := New(nil, true, "store-uid")
+	defer forget(unbound, bound)
+	claim(t, bound)
+
+	assert.False(t, unbound.Stored())
+	assert.True(t, bound.Stored())
+
+	assert.NoError(t, unbound.Set("a", "x"))
+	assert.NoError(t, bound.Set("a", "y"))
+	bound.FlushStored()
+	fields, _ := m.Load("store-uid")
+	assert.Equal(t, map[string][]byte{"a": []byte(`"y"`)}, fields)
+
+	assert.NoError(t, bound.Remove("a"))
+	bound.FlushStored()
+	fields, _ = m.Load("store-uid")
+	assert.Empty(t, fields)
+
+	assert.NoError(t, bound.SetData(map[string]interface{}{"b": "z"}))
+	bound.FlushStored()
+	fields, _ = m.Load("store-uid")
+	assert.Equal(t, map[string][]byte{"b": []byte(`"z"`)}, fields)
+}
+
+func TestBackendSessionUsesStore(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+
+	m.Claim("backend-uid", "frontend/7", map[string][]byte{"a": []byte(`"x"`), "n": []byte("1")})
+	ss := New(nil, false, "backend-uid")
+	ss.SetFrontendData("frontend", 7)
+
+	assert.Equal(t, "x", ss.String("a"))
+	assert.Equal(t, float64(1), ss.Float64("n"))
+	assert.NoError(t, ss.Set("b", "y"))
+	assert.NoError(t, ss.Remove("n"))
+	ss.FlushStored()
+	fields, _ := m.Load("backend-uid")
+	assert.Equal(t, map[string][]byte{"a": []byte(`"x"`), "b": []byte(`"y"`)}, fields)
+
+	// a backend serving an older session of the user writes nothing
+	stale := New(nil, false, "backend-uid")
+	stale.SetFrontendData("frontend", 6)
+	assert.NoError(t, stale.Set("a", "stale"))
+	stale.FlushStored()
+	fields, _ = m.Load("backend-uid")
+	assert.Equal(t, []byte(`"x"`), fields["a"])
+}
+
+func TestSessionLoadStoredData(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+
+	ss := New(nil, true, "reload-uid")
+	defer forget(ss)
+	claim(t, ss)
+	assert.NoError(t, ss.Set("a", "x"))
+
+	m.Save("reload-uid", ss.storeOwner(), map[string][]byte{"b": []byte(`"y"`)})
+	assert.NoError(t, ss.LoadStoredData())
+	assert.Equal(t, map[string]interface{}{"a": "x", "b": "y"}, ss.GetData())
+}
+
+func TestSessionBindReplacesStoredData(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	m.Claim("bind-uid", "old-owner", map[string][]byte{"old": []byte(`"x"`)})
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, true)
+	assert.NoError(t, ss.Set("a", "y"))
+	assert.NoError(t, ss.Bind(context.Background(), "bind-uid"))
+
+	ss.FlushStored()
+	fields, _ := m.Load("bind-uid")
+	assert.Equal(t, map[string][]byte{"a": []byte(`"y"`)}, fields)
+
+	entity.EXPECT().Close()
+	ss.Close()
+	flushStoreWrites()
+	fields, _ = m.Load("bind-uid")
+	assert.Empty(t, fields)
+}
+
+func TestSessionCloseKeepsDataClaimedElsewhere(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, true)
+	assert.NoError(t, ss.Bind(context.Background(), "relogin-uid"))
+	ss.FlushStored()
+
+	// the user logged in again on another frontend
+	m.Claim("relogin-uid", "other-frontend", map[string][]byte{"a": []byte(`"x"`)})
+	assert.NoError(t, ss.Set("a", "stale"))
+
+	entity.EXPECT().Close()
+	ss.Close()
+	flushStoreWrites()
+	fields, _ := m.Load("relogin-uid")
+	assert.Equal(t, map[string][]byte{"a": []byte(`"x"`)}, fields)
+}
+
+func TestSessionPushToFrontWithStore(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+	SetServerID("push-frontend")
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	front := New(nil, true, "push-uid")
+	defer forget(front)
+	claim(t, front)
+	assert.NoError(t, front.Set("a", "x"))
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, false, "push-uid")
+	ss.SetFrontendData("push-frontend", front.ID())
+	ss.SetVersion(front.Version())
+	assert.NoError(t, ss.Set("b", "y"))
+	assert.NoError(t, ss.Remove("a"))
+
+	// the data goes through the store, the frontend reloads it
+	pushed := pushedSession(t, entity, ss)
+	assert.Empty(t, pushed.Data)
+	assert.NoError(t, front.ApplyPush(pushed))
+	assert.Equal(t, map[string]interface{}{"b": "y"}, front.GetData())
+	fields, _ := m.Load("push-uid")
+	assert.Equal(t, map[string][]byte{"b": []byte(`"y"`)}, fields)
+}
+
+func TestStoreWritesRunInOrder(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+
+	ss := New(nil, true, "order-uid")
+	defer forget(ss)
+	claim(t, ss)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, ss.Set("n", i))
+	}
+	ss.FlushStored()
+	fields, _ := m.Load("order-uid")
+	assert.Equal(t, []byte("99"), fields["n"])
+}
+
+func TestFlushStoredWaitsForItsUIDOnly(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+
+	ss := New(nil, true, "flush-uid")
+	defer forget(ss)
+	claim(t, ss)
+	assert.NoError(t, ss.Set("a", "x"))
+	ss.FlushStored()
+
+	// a slow write of another uid keeps its worker busy
+	release := make(chan struct{})
+	queueStoreWrite(storeWrite{uid: "slow-uid", fn: func() error {
+		<-release
+		return nil
+	}})
+	defer close(release)
+
+	flushed := make(chan struct{})
+	go func() {
+		ss.FlushStored()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("FlushStored waited for the writes of another uid")
+	}
+}
+
+func TestBackendBindMergesStoredData(t *testing.T) {
+	m := NewMemoryStore()
+	SetStore(m)
+	defer SetStore(nil)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	entity := mocks.NewMockNetworkEntity(ctrl)
+	ss := New(entity, false)
+	ss.SetFrontendData("frontend", 3)
+	assert.NoError(t, ss.Set("a", "local"))
+
+	// the frontend claims the data when it binds
+	entity.EXPECT().SendRequest(gomock.Any(), ss.frontendID, constants.SessionBindRoute, gomock.Any()).
+		Do(func(context.Context, string, string, []byte) {
+			m.Claim("merge-uid", "frontend/3", map[string][]byte{"a": []byte(`"stored"`), "b": []byte(`"stored"`)})
+		})
+	assert.NoError(t, ss.Bind(context.Background(), "merge-uid"))
+	assert.Equal(t, map[string]interface{}{"a": "local", "b": "stored"}, ss.GetData())
+
+	ss.FlushStored()
+	fields, _ := m.Load("merge-uid")
+	assert.Equal(t, map[string][]byte{"a": []byte(`"local"`), "b": []byte(`"stored"`)}, fields)
+}
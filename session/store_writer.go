@@ -0,0 +1,154 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package session
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/tutumagi/pitaya/logger"
+)
+
+// storeWorkers is the number of goroutines writing to the store, the writes
+// of a uid always run on the same one so they keep their order
+const storeWorkers = 16
+
+// storeWrite is a write of the data of a uid to the store
+type storeWrite struct {
+	uid  string
+	fn   func() error
+	done chan struct{} // closed once the write ran
+}
+
+// uidStoreWrites tracks the queued writes of a uid
+type uidStoreWrites struct {
+	count int
+	last  chan struct{} // done of the last queued write
+}
+
+var (
+	storeWritesOnce sync.Once
+	storeWrites     [storeWorkers]chan storeWrite
+
+	pendingMu     sync.Mutex
+	pendingWrites = make(map[string]*uidStoreWrites)
+)
+
+func startStoreWriters() {
+	for i := range storeWrites {
+		storeWrites[i] = make(chan storeWrite, 1024)
+		go runStoreWrites(storeWrites[i])
+	}
+}
+
+func runStoreWrites(writes chan storeWrite) {
+	for w := range writes {
+		runStoreWrite(w)
+		storeWriteDone(w)
+	}
+}
+
+func runStoreWrite(w storeWrite) {
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Log.Errorf("session store write of %s panicked: %v", w.uid, err)
+		}
+	}()
+	if err := w.fn(); err != nil {
+		logger.Log.Errorf("failed to write session data of %s to store: %s", w.uid, err)
+	}
+}
+
+func storeWriteDone(w storeWrite) {
+	close(w.done)
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+
+	p := pendingWrites[w.uid]
+	p.count--
+	if p.count == 0 {
+		delete(pendingWrites, w.uid)
+	}
+}
+
+// queueStoreWrite queues w to run after the previous writes of its uid
+func queueStoreWrite(w storeWrite) {
+	storeWritesOnce.Do(startStoreWriters)
+	w.done = make(chan struct{})
+	pendingMu.Lock()
+	p, ok := pendingWrites[w.uid]
+	if !ok {
+		p = &uidStoreWrites{}
+		pendingWrites[w.uid] = p
+	}
+	p.count++
+	p.last = w.done
+	pendingMu.Unlock()
+
+	h := fnv.New32a()
+	h.Write([]byte(w.uid))
+	storeWrites[h.Sum32()%storeWorkers] <- w
+}
+
+// waitStoreWrites waits for the writes of the uid queued so far, the writes
+// of other uids running on the same worker are not waited for once these
+// ran
+func waitStoreWrites(uid string) {
+	pendingMu.Lock()
+	p, ok := pendingWrites[uid]
+	var last chan struct{}
+	if ok {
+		last = p.last
+	}
+	pendingMu.Unlock()
+	if ok {
+		<-last
+	}
+}
+
+// writeStored writes the session data to the store with fn off the calling
+// goroutine, failures are logged
+func (s *Session) writeStored(fn func(st Store, uid string) error) {
+	st, uid := store, s.UID()
+	queueStoreWrite(storeWrite{uid: uid, fn: func() error { return fn(st, uid) }})
+}
+
+// FlushStored waits for the queued writes of the session data to the store,
+// so that other servers read what the session wrote. Only the writes of the
+// session uid are waited for
+func (s *Session) FlushStored() {
+	if !s.Stored() {
+		return
+	}
+	waitStoreWrites(s.UID())
+}
+
+// flushStoreWrites waits for every queued write to the store
+func flushStoreWrites() {
+	pendingMu.Lock()
+	lasts := make([]chan struct{}, 0, len(pendingWrites))
+	for _, p := range pendingWrites {
+		lasts = append(lasts, p.last)
+	}
+	pendingMu.Unlock()
+	for _, last := range lasts {
+		<-last
+	}
+}
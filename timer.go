@@ -50,10 +50,7 @@ func NewCountTimer(interval time.Duration, count int, fn timer.Func) *timer.Time
 		panic("non-positive interval for NewTimer")
 	}
 
-	t := timer.NewTimer(fn, interval, count)
-	// add to manager
-	timer.Manager.ChCreatedTimer <- t
-	return t
+	return timer.NewTimer(fn, interval, count)
 }
 
 // NewAfterTimer returns a new Timer containing a function that will be called
@@ -78,6 +75,28 @@ func NewCondTimer(condition timer.Condition, fn timer.Func) (*timer.Timer, error
 	return t, nil
 }
 
+// NewCronTimer returns a new Timer containing a function that will be called
+// every time the cron expression spec activates, see timer.ParseCron for
+// the supported syntax. The expression is evaluated in time.Local.
+// Stop the timer to release associated resources.
+func NewCronTimer(spec string, fn timer.Func) (*timer.Timer, error) {
+	schedule, err := timer.ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewScheduleTimer(schedule, fn)
+}
+
+// NewScheduleTimer returns a new Timer containing a function that will be
+// called every time schedule activates, e.g. timer.Daily or timer.Weekly.
+// Stop the timer to release associated resources.
+func NewScheduleTimer(schedule timer.Schedule, fn timer.Func) (*timer.Timer, error) {
+	if schedule == nil {
+		return nil, constants.ErrNilCondition
+	}
+	return NewCondTimer(timer.NewScheduleCondition(schedule, app.clock.Now()), fn)
+}
+
 // SetTimerPrecision set the ticker precision, and time precision can not less
 // than a Millisecond, and can not change after application running. The default
 // precision is time.Second
@@ -88,9 +107,8 @@ func SetTimerPrecision(precision time.Duration) {
 	timer.Precision = precision
 }
 
-// SetTimerBacklog set the timer created/closing channel backlog, A small backlog
-// may cause the logic to be blocked when call NewTimer/NewCountTimer/timer.Stop
-// in main logic gorontine.
+// SetTimerBacklog sets the initial capacity of the queues holding the timers
+// created and stopped between two ticks, the queues grow as needed.
 func SetTimerBacklog(c int) {
 	timer.SetTimerBacklog(c)
 }
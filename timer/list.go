@@ -0,0 +1,159 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package timer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Info is a snapshot of a registered timer
+	Info struct {
+		ID        int64         `json:"id"`
+		Name      string        `json:"name,omitempty"`
+		Owner     string        `json:"owner,omitempty"`
+		Interval  time.Duration `json:"interval,omitempty"` // zero for condition timers
+		Condition bool          `json:"condition"`          // whether the timer runs on a condition
+		Next      time.Time     `json:"next"`               // zero if unknown
+		Remaining int           `json:"remaining"`          // executions left, LoopForever if unlimited
+		Fired     int64         `json:"fired"`              // number of executions
+		Panics    int64         `json:"panics"`             // number of executions that panicked
+	}
+
+	// Stats are the executions of all timers sharing a name
+	Stats struct {
+		Fired  int64 `json:"fired"`
+		Panics int64 `json:"panics"`
+	}
+
+	// nextCondition is implemented by conditions that know when they will be
+	// satisfied, e.g. ScheduleCondition
+	nextCondition interface {
+		Next() time.Time
+	}
+)
+
+// executions holds the *Stats of every timer name
+var executions sync.Map
+
+// SetName sets the name the timer is listed and reported with, timers
+// sharing a name are aggregated in the metrics
+func (t *Timer) SetName(name string) {
+	t.labelsMu.Lock()
+	defer t.labelsMu.Unlock()
+
+	t.name = name
+}
+
+// Name returns the name of the timer
+func (t *Timer) Name() string {
+	t.labelsMu.Lock()
+	defer t.labelsMu.Unlock()
+
+	return t.name
+}
+
+// SetOwner sets who created the timer, e.g. a session or a component
+func (t *Timer) SetOwner(owner string) {
+	t.labelsMu.Lock()
+	defer t.labelsMu.Unlock()
+
+	t.owner = owner
+}
+
+// Owner returns who created the timer
+func (t *Timer) Owner() string {
+	t.labelsMu.Lock()
+	defer t.labelsMu.Unlock()
+
+	return t.owner
+}
+
+// Fired returns how many times the timer was executed
+func (t *Timer) Fired() int64 {
+	return atomic.LoadInt64(&t.fired)
+}
+
+// Panics returns how many executions of the timer panicked
+func (t *Timer) Panics() int64 {
+	return atomic.LoadInt64(&t.panics)
+}
+
+// List returns a snapshot of the registered timers sorted by id
+func List() []Info {
+	w := Manager.wheel
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	infos := make([]Info, 0)
+	Manager.timers.Range(func(_, v interface{}) bool {
+		t := v.(*Timer)
+		info := Info{
+			ID:        t.ID,
+			Name:      t.Name(),
+			Owner:     t.Owner(),
+			Remaining: t.counter,
+			Fired:     t.Fired(),
+			Panics:    t.Panics(),
+		}
+		if t.condition != nil {
+			info.Condition = true
+			if c, ok := t.condition.(nextCondition); ok {
+				info.Next = c.Next()
+			}
+		} else {
+			info.Interval = t.interval
+			info.Next = time.Unix(0, t.deadline())
+		}
+		infos = append(infos, info)
+		return true
+	})
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// ExecutionStats returns the executions of the timers by name, unnamed
+// timers are grouped under the empty name
+func ExecutionStats() map[string]Stats {
+	stats := make(map[string]Stats)
+	executions.Range(func(k, v interface{}) bool {
+		s := v.(*Stats)
+		stats[k.(string)] = Stats{
+			Fired:  atomic.LoadInt64(&s.Fired),
+			Panics: atomic.LoadInt64(&s.Panics),
+		}
+		return true
+	})
+	return stats
+}
+
+func statsOf(name string) *Stats {
+	if s, ok := executions.Load(name); ok {
+		return s.(*Stats)
+	}
+	s, _ := executions.LoadOrStore(name, &Stats{})
+	return s.(*Stats)
+}
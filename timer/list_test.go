@@ -0,0 +1,134 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package timer
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func findInfo(infos []Info, id int64) (Info, bool) {
+	for _, info := range infos {
+		if info.ID == id {
+			return info, true
+		}
+	}
+	return Info{}, false
+}
+
+func TestTimerLabels(t *testing.T) {
+	t.Parallel()
+	tm := NewTimer(func() {}, time.Second, 1)
+	assert.Equal(t, "", tm.Name())
+	assert.Equal(t, "", tm.Owner())
+
+	tm.SetName("regen")
+	tm.SetOwner("player 1")
+	assert.Equal(t, "regen", tm.Name())
+	assert.Equal(t, "player 1", tm.Owner())
+	tm.Stop()
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	tm := NewTimer(func() {}, time.Minute, 3)
+	tm.SetName("listInterval")
+	tm.SetOwner("owner")
+	AddTimer(tm)
+	defer tm.Stop()
+
+	start := time.Date(2020, 1, 1, 4, 0, 0, 0, time.UTC)
+	cond := NewTimer(func() {}, time.Minute, LoopForever)
+	cond.SetCondition(NewScheduleCondition(Daily(5, 0, 0, time.UTC), start))
+	AddTimer(cond)
+	defer cond.Stop()
+
+	stopped := NewTimer(func() {}, time.Minute, 1)
+	stopped.Stop()
+	AddTimer(stopped)
+
+	infos := List()
+
+	info, ok := findInfo(infos, tm.ID)
+	assert.True(t, ok)
+	assert.Equal(t, "listInterval", info.Name)
+	assert.Equal(t, "owner", info.Owner)
+	assert.Equal(t, time.Minute, info.Interval)
+	assert.False(t, info.Condition)
+	assert.Equal(t, 3, info.Remaining)
+	assert.Equal(t, time.Unix(0, tm.createAt).Add(time.Minute), info.Next)
+
+	info, ok = findInfo(infos, cond.ID)
+	assert.True(t, ok)
+	assert.True(t, info.Condition)
+	assert.Equal(t, time.Duration(0), info.Interval)
+	assert.Equal(t, start.Add(time.Hour), info.Next)
+
+	_, ok = findInfo(infos, stopped.ID)
+	assert.False(t, ok)
+
+	for i := 1; i < len(infos); i++ {
+		assert.True(t, infos[i-1].ID < infos[i].ID)
+	}
+}
+
+func TestExecutionStats(t *testing.T) {
+	t.Parallel()
+	ok := &Timer{ID: 1, fn: func() {}}
+	ok.SetName("statsTimer")
+	panics := &Timer{ID: 2, fn: func() { panic("bla") }}
+	panics.SetName("statsTimer")
+
+	pexec(ok)
+	pexec(ok)
+	pexec(panics)
+
+	assert.Equal(t, int64(2), ok.Fired())
+	assert.Equal(t, int64(0), ok.Panics())
+	assert.Equal(t, int64(1), panics.Fired())
+	assert.Equal(t, int64(1), panics.Panics())
+	assert.Equal(t, Stats{Fired: 3, Panics: 1}, ExecutionStats()["statsTimer"])
+}
+
+func TestDebugHandler(t *testing.T) {
+	t.Parallel()
+	tm := NewTimer(func() {}, time.Minute, 1)
+	tm.SetName("debugTimer")
+	AddTimer(tm)
+	defer tm.Stop()
+
+	rec := httptest.NewRecorder()
+	DebugHandler(rec, httptest.NewRequest(http.MethodGet, "/debug/timers", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body struct {
+		Timers []Info `json:"timers"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	info, ok := findInfo(body.Timers, tm.ID)
+	assert.True(t, ok)
+	assert.Equal(t, "debugTimer", info.Name)
+}
@@ -0,0 +1,91 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package timer
+
+import (
+	"time"
+
+	"github.com/tutumagi/pitaya/logger"
+	"github.com/tutumagi/pitaya/metrics"
+)
+
+// Report sends periodic reports of the registered timers, their executions
+// and the timers waiting for the next tick
+func Report(reporters []metrics.Reporter, period time.Duration) {
+	defer func() {
+		logger.Log.Warnf("Go timer.Report exit")
+		if err := recover(); err != nil {
+			logger.Log.Warnf("Go timer.Report exit by err = %v", err)
+		}
+	}()
+	for {
+		time.Sleep(period)
+
+		creations, cancellations := PendingCreations(), PendingCancellations()
+		count := GetTimerCount()
+		stats := ExecutionStats()
+		for _, r := range reporters {
+			reportPending(r, creations, cancellations)
+			reportCount(r, count)
+			reportExecutions(r, stats)
+		}
+	}
+}
+
+func reportPending(r metrics.Reporter, creations, cancellations int) {
+	err := r.ReportGauge(metrics.TimerPending, map[string]string{
+		"operation": "create",
+	}, float64(creations))
+	checkReportErr(metrics.TimerPending, err)
+
+	err = r.ReportGauge(metrics.TimerPending, map[string]string{
+		"operation": "cancel",
+	}, float64(cancellations))
+	checkReportErr(metrics.TimerPending, err)
+}
+
+func reportCount(r metrics.Reporter, count int) {
+	err := r.ReportGauge(metrics.TimerCount, map[string]string{}, float64(count))
+	checkReportErr(metrics.TimerCount, err)
+}
+
+func reportExecutions(r metrics.Reporter, stats map[string]Stats) {
+	// executions always grow up, so they work as count but must be
+	// reported as gauge
+	for name, s := range stats {
+		err := r.ReportGauge(metrics.TimerExecutions, map[string]string{
+			"name":   name,
+			"status": "fired",
+		}, float64(s.Fired))
+		checkReportErr(metrics.TimerExecutions, err)
+
+		err = r.ReportGauge(metrics.TimerExecutions, map[string]string{
+			"name":   name,
+			"status": "panicked",
+		}, float64(s.Panics))
+		checkReportErr(metrics.TimerExecutions, err)
+	}
+}
+
+func checkReportErr(metric string, err error) {
+	if err != nil {
+		logger.Log.Errorf("failed to report to %s: %q\n", metric, err)
+	}
+}
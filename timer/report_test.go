@@ -0,0 +1,79 @@
+// Copyright (c) nano Author and TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package timer
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/tutumagi/pitaya/metrics"
+	"github.com/tutumagi/pitaya/metrics/mocks"
+)
+
+func TestReportPending(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporter := mocks.NewMockReporter(ctrl)
+	mockReporter.EXPECT().ReportGauge(
+		metrics.TimerPending,
+		map[string]string{"operation": "create"},
+		float64(3))
+	mockReporter.EXPECT().ReportGauge(
+		metrics.TimerPending,
+		map[string]string{"operation": "cancel"},
+		float64(1)).Return(errors.New("err"))
+
+	reportPending(mockReporter, 3, 1)
+}
+
+func TestReportCount(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporter := mocks.NewMockReporter(ctrl)
+	mockReporter.EXPECT().ReportGauge(metrics.TimerCount, map[string]string{}, float64(7))
+
+	reportCount(mockReporter, 7)
+}
+
+func TestReportExecutions(t *testing.T) {
+	t.Parallel()
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockReporter := mocks.NewMockReporter(ctrl)
+	mockReporter.EXPECT().ReportGauge(
+		metrics.TimerExecutions,
+		map[string]string{"name": "regen", "status": "fired"},
+		float64(10))
+	mockReporter.EXPECT().ReportGauge(
+		metrics.TimerExecutions,
+		map[string]string{"name": "regen", "status": "panicked"},
+		float64(2))
+
+	reportExecutions(mockReporter, map[string]Stats{"regen": {Fired: 10, Panics: 2}})
+}
@@ -0,0 +1,337 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package timer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Schedule describes a wall clock schedule
+	Schedule interface {
+		// Next returns the first activation time after t
+		Next(t time.Time) time.Time
+	}
+
+	// ScheduleCondition is a Condition satisfied once every time its
+	// schedule activates
+	ScheduleCondition struct {
+		mu       sync.Mutex
+		schedule Schedule
+		next     time.Time
+	}
+
+	cronSchedule struct {
+		minute, hour, dom, month, dow uint64
+		loc                           *time.Location
+	}
+
+	dailySchedule struct {
+		hour, minute, second int
+		loc                  *time.Location
+	}
+
+	weeklySchedule struct {
+		day time.Weekday
+		dailySchedule
+	}
+
+	cronField struct {
+		min, max int
+		names    map[string]int
+	}
+)
+
+var (
+	minuteField = cronField{0, 59, nil}
+	hourField   = cronField{0, 23, nil}
+	domField    = cronField{1, 31, nil}
+	monthField  = cronField{1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowField = cronField{0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// starBit marks a field that was specified as '*'
+const starBit = 1 << 63
+
+// NewScheduleCondition returns a condition satisfied at every activation
+// of schedule after now
+func NewScheduleCondition(schedule Schedule, now time.Time) *ScheduleCondition {
+	return &ScheduleCondition{
+		schedule: schedule,
+		next:     schedule.Next(now),
+	}
+}
+
+// Check returns true when the next activation of the schedule was reached
+func (c *ScheduleCondition) Check(now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Before(c.next) {
+		return false
+	}
+	c.next = c.schedule.Next(now)
+	return true
+}
+
+// Next returns the next time the condition will be satisfied
+func (c *ScheduleCondition) Next() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.next
+}
+
+// ParseCron parses a standard five field cron expression
+// (minute hour day-of-month month day-of-week) evaluated in time.Local.
+// Lists, ranges, steps, month and weekday names and the descriptors
+// @yearly, @monthly, @weekly, @daily and @hourly are supported.
+func ParseCron(spec string) (Schedule, error) {
+	return ParseCronInLocation(spec, time.Local)
+}
+
+// ParseCronInLocation parses a cron expression evaluated in loc
+func ParseCronInLocation(spec string, loc *time.Location) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("pitaya/timer: cron expression %q must have 5 fields", spec)
+	}
+
+	s := &cronSchedule{loc: loc}
+	var err error
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	// 7 is also sunday
+	if s.dow&(1<<7) > 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	return s, nil
+}
+
+// Daily returns a schedule that activates every day at the given time in loc
+func Daily(hour, minute, second int, loc *time.Location) Schedule {
+	return &dailySchedule{hour: hour, minute: minute, second: second, loc: loc}
+}
+
+// Weekly returns a schedule that activates every week at the given day and
+// time in loc
+func Weekly(day time.Weekday, hour, minute, second int, loc *time.Location) Schedule {
+	return &weeklySchedule{
+		day:           day,
+		dailySchedule: dailySchedule{hour: hour, minute: minute, second: second, loc: loc},
+	}
+}
+
+func (f cronField) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := f.parsePart(part)
+		if err != nil {
+			return 0, fmt.Errorf("pitaya/timer: invalid cron field %q: %s", expr, err.Error())
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func (f cronField) parsePart(part string) (uint64, error) {
+	rangeAndStep := strings.Split(part, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("too many slashes")
+	}
+
+	var (
+		start, end int
+		step       = 1
+		extra      uint64
+		err        error
+	)
+	lowAndHigh := strings.Split(rangeAndStep[0], "-")
+	switch {
+	case lowAndHigh[0] == "*":
+		if len(lowAndHigh) > 1 {
+			return 0, fmt.Errorf("'*' can not be part of a range")
+		}
+		start, end = f.min, f.max
+		if len(rangeAndStep) == 1 {
+			extra = starBit
+		}
+	default:
+		if start, err = f.value(lowAndHigh[0]); err != nil {
+			return 0, err
+		}
+		end = start
+		if len(lowAndHigh) == 2 {
+			if end, err = f.value(lowAndHigh[1]); err != nil {
+				return 0, err
+			}
+		} else if len(lowAndHigh) > 2 {
+			return 0, fmt.Errorf("too many hyphens")
+		} else if len(rangeAndStep) == 2 {
+			// N/step means from N to the end of the range
+			end = f.max
+		}
+	}
+
+	if len(rangeAndStep) == 2 {
+		if step, err = strconv.Atoi(rangeAndStep[1]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step %q", rangeAndStep[1])
+		}
+	}
+	if start > end {
+		return 0, fmt.Errorf("beginning of range %d beyond end %d", start, end)
+	}
+
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits | extra, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Next returns the first minute matching the expression after t
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	origLoc := t.Location()
+	t = t.In(s.loc)
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+
+	// give up if no matching time is found in five years,
+	// which happens with expressions such as "0 0 30 2 *"
+	limit := t.Year() + 5
+
+WRAP:
+	if t.Year() > limit {
+		return time.Time{}
+	}
+
+	for 1<<uint(t.Month())&s.month == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Hour())&s.hour == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for 1<<uint(t.Minute())&s.minute == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+
+	return t.In(origLoc)
+}
+
+// dayMatches follows the cron convention: when both day-of-month and
+// day-of-week are restricted, either of them matching is enough
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := 1<<uint(t.Day())&s.dom > 0
+	dowMatch := 1<<uint(t.Weekday())&s.dow > 0
+	if s.dom&starBit > 0 || s.dow&starBit > 0 {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first activation of the daily schedule after t
+func (s *dailySchedule) Next(t time.Time) time.Time {
+	lt := t.In(s.loc)
+	next := time.Date(lt.Year(), lt.Month(), lt.Day(), s.hour, s.minute, s.second, 0, s.loc)
+	if !next.After(t) {
+		next = time.Date(lt.Year(), lt.Month(), lt.Day()+1, s.hour, s.minute, s.second, 0, s.loc)
+	}
+	return next.In(t.Location())
+}
+
+// Next returns the first activation of the weekly schedule after t
+func (s *weeklySchedule) Next(t time.Time) time.Time {
+	lt := t.In(s.loc)
+	days := (int(s.day) - int(lt.Weekday()) + 7) % 7
+	next := time.Date(lt.Year(), lt.Month(), lt.Day()+days, s.hour, s.minute, s.second, 0, s.loc)
+	if !next.After(t) {
+		next = time.Date(lt.Year(), lt.Month(), lt.Day()+days+7, s.hour, s.minute, s.second, 0, s.loc)
+	}
+	return next.In(t.Location())
+}
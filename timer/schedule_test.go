@@ -0,0 +1,140 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package timer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustTime(t *testing.T, value string) time.Time {
+	tm, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.UTC)
+	assert.NoError(t, err)
+	return tm
+}
+
+func TestParseCronErrors(t *testing.T) {
+	t.Parallel()
+	specs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*-5 * * * *",
+		"a * * * *",
+	}
+	for _, spec := range specs {
+		t.Run(spec, func(t *testing.T) {
+			_, err := ParseCronInLocation(spec, time.UTC)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	t.Parallel()
+	tables := []struct {
+		spec     string
+		from     string
+		expected string
+	}{
+		{"0 5 * * *", "2020-01-01 04:59:59", "2020-01-01 05:00:00"},
+		{"0 5 * * *", "2020-01-01 05:00:00", "2020-01-02 05:00:00"},
+		{"*/15 * * * *", "2020-01-01 10:16:00", "2020-01-01 10:30:00"},
+		{"30 8-10 * * *", "2020-01-01 10:31:00", "2020-01-02 08:30:00"},
+		{"0 0 * * mon", "2020-01-01 00:00:00", "2020-01-06 00:00:00"},
+		{"0 0 * * 7", "2020-01-01 00:00:00", "2020-01-05 00:00:00"},
+		{"0 0 1,15 * *", "2020-01-02 00:00:00", "2020-01-15 00:00:00"},
+		{"0 0 1 * 1", "2020-01-02 00:00:00", "2020-01-06 00:00:00"},
+		{"0 12 29 feb *", "2020-03-01 00:00:00", "2024-02-29 12:00:00"},
+		{"@hourly", "2020-01-01 10:59:00", "2020-01-01 11:00:00"},
+		{"@yearly", "2020-06-01 00:00:00", "2021-01-01 00:00:00"},
+	}
+
+	for _, table := range tables {
+		t.Run(table.spec, func(t *testing.T) {
+			s, err := ParseCronInLocation(table.spec, time.UTC)
+			assert.NoError(t, err)
+			assert.Equal(t, mustTime(t, table.expected), s.Next(mustTime(t, table.from)))
+		})
+	}
+}
+
+func TestCronScheduleNextImpossible(t *testing.T) {
+	t.Parallel()
+	s, err := ParseCronInLocation("0 0 30 2 *", time.UTC)
+	assert.NoError(t, err)
+	assert.True(t, s.Next(mustTime(t, "2020-01-01 00:00:00")).IsZero())
+}
+
+func TestCronScheduleLocation(t *testing.T) {
+	t.Parallel()
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	s, err := ParseCronInLocation("0 5 * * *", loc)
+	assert.NoError(t, err)
+
+	next := s.Next(mustTime(t, "2020-01-01 00:00:00"))
+	assert.Equal(t, mustTime(t, "2020-01-01 21:00:00"), next)
+}
+
+func TestDailySchedule(t *testing.T) {
+	t.Parallel()
+	s := Daily(5, 30, 10, time.UTC)
+	assert.Equal(t, mustTime(t, "2020-01-01 05:30:10"), s.Next(mustTime(t, "2020-01-01 05:30:09")))
+	assert.Equal(t, mustTime(t, "2020-01-02 05:30:10"), s.Next(mustTime(t, "2020-01-01 05:30:10")))
+
+	loc := time.FixedZone("UTC-3", -3*60*60)
+	s = Daily(0, 0, 0, loc)
+	assert.Equal(t, mustTime(t, "2020-01-01 03:00:00"), s.Next(mustTime(t, "2020-01-01 00:00:00")))
+}
+
+func TestWeeklySchedule(t *testing.T) {
+	t.Parallel()
+	// 2020-01-01 is a wednesday
+	s := Weekly(time.Monday, 5, 0, 0, time.UTC)
+	assert.Equal(t, mustTime(t, "2020-01-06 05:00:00"), s.Next(mustTime(t, "2020-01-01 00:00:00")))
+	assert.Equal(t, mustTime(t, "2020-01-13 05:00:00"), s.Next(mustTime(t, "2020-01-06 05:00:00")))
+
+	s = Weekly(time.Wednesday, 5, 0, 0, time.UTC)
+	assert.Equal(t, mustTime(t, "2020-01-01 05:00:00"), s.Next(mustTime(t, "2020-01-01 04:00:00")))
+}
+
+func TestScheduleCondition(t *testing.T) {
+	t.Parallel()
+	start := mustTime(t, "2020-01-01 04:00:00")
+	c := NewScheduleCondition(Daily(5, 0, 0, time.UTC), start)
+	assert.Equal(t, mustTime(t, "2020-01-01 05:00:00"), c.Next())
+
+	assert.False(t, c.Check(start))
+	assert.False(t, c.Check(mustTime(t, "2020-01-01 04:59:59")))
+	assert.True(t, c.Check(mustTime(t, "2020-01-01 05:00:01")))
+	// satisfied only once per activation
+	assert.False(t, c.Check(mustTime(t, "2020-01-01 05:00:02")))
+	assert.Equal(t, mustTime(t, "2020-01-02 05:00:00"), c.Next())
+}
@@ -21,14 +21,19 @@
 package timer
 
 import (
+	"container/list"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/tutumagi/pitaya/clock"
 	"github.com/tutumagi/pitaya/logger"
 )
 
-var timerBacklog int
+var (
+	timerBacklog int
+	clk          = clock.New()
+)
 
 const (
 	// LoopForever is a constant indicating that timer should loop forever
@@ -38,9 +43,18 @@ const (
 var (
 	// Manager manager for all Timers
 	Manager = &struct {
-		incrementID    int64      // auto increment id
-		timers         sync.Map   // all Timers
-		ChClosingTimer chan int64 // timer for closing
+		incrementID int64        // auto increment id
+		timers      sync.Map     // all Timers
+		wheel       *timingWheel // schedules the execution of Timers
+		pendingMu   sync.Mutex   // guards created and closing
+		created     []*Timer     // timers waiting to be registered on the next tick
+		closing     []int64      // timers waiting to be removed on the next tick
+
+		// Deprecated: timers are registered and removed on the next tick
+		// without channels, use AddTimer and Timer.Stop. Timers sent to
+		// the channels are still applied on the next tick
+		ChClosingTimer chan int64
+		// Deprecated: see ChClosingTimer
 		ChCreatedTimer chan *Timer
 	}{}
 
@@ -73,12 +87,23 @@ type (
 		elapse    int64         // total elapse time
 		closed    int32         // is timer closed
 		counter   int           // counter
+
+		labelsMu sync.Mutex
+		name     string // name the timer is listed and reported with
+		owner    string // who created the timer, e.g. a session
+		fired    int64  // number of executions
+		panics   int64  // number of executions that panicked
+
+		expire int64         // wheel tick of the next execution
+		bucket *list.List    // wheel slot holding the timer
+		elem   *list.Element // position of the timer in bucket
 	}
 )
 
 func init() {
 	// since this runs on init it is better to leave the value hardcoded here
 	timerBacklog = 1 << 8
+	Manager.wheel = newTimingWheel(time.Now())
 	Manager.ChClosingTimer = make(chan int64, timerBacklog)
 	Manager.ChCreatedTimer = make(chan *Timer, timerBacklog)
 }
@@ -92,53 +117,74 @@ func GetTimerCount() int {
 	return timerCount
 }
 
-// AddTimer adds a timer to the manager
+// AddTimer adds a timer to the manager, adding the same timer twice is a no-op
 func AddTimer(t *Timer) {
+	w := Manager.wheel
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t.IsClose() {
+		return
+	}
 	Manager.timers.Store(t.ID, t)
+	w.add(t)
 	// logger.Log.Debugf("add timer.id = %d, timerCount = %d", t.ID, GetTimerCount())
 }
 
 // RemoveTimer removes a timer to the manager
 func RemoveTimer(id int64) {
+	w := Manager.wheel
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ti, ok := Manager.timers.Load(id); ok {
+		w.remove(ti.(*Timer))
+	}
 	Manager.timers.Delete(id)
 	// logger.Log.Debugf("remove timer.id = %d, timerCount = %d", id, GetTimerCount())
 }
 
+// finish removes a timer that has run out of executions
+func finish(t *Timer) {
+	atomic.StoreInt32(&t.closed, 1)
+	RemoveTimer(t.ID)
+}
+
 // NewTimer creates a cron job
 func NewTimer(fn Func, interval time.Duration, counter int) *Timer {
 	id := atomic.AddInt64(&Manager.incrementID, 1)
 	t := &Timer{
 		ID:       id,
 		fn:       fn,
-		createAt: time.Now().UnixNano(),
+		createAt: clk.Now().UnixNano(),
 		interval: interval,
 		elapse:   int64(interval), // first execution will be after interval
 		counter:  counter,
 	}
 
-	// add to manager
-	Manager.ChCreatedTimer <- t
+	// registered on the next tick, so creating timers never blocks
+	Manager.pendingMu.Lock()
+	Manager.created = append(Manager.created, t)
+	Manager.pendingMu.Unlock()
 	return t
 }
 
 // SetCondition sets the condition used for verifying when the cron job should run
 func (t *Timer) SetCondition(condition Condition) {
-	t.condition = condition
+	Manager.wheel.setCondition(t, condition)
 }
 
 // Stop turns off a timer. After Stop, fn will not be called forever
 func (t *Timer) Stop() {
-	if atomic.LoadInt32(&t.closed) > 0 {
+	if !atomic.CompareAndSwapInt32(&t.closed, 0, 1) {
 		return
 	}
 
-	// guarantee that logic is not blocked
-	if len(Manager.ChClosingTimer) < timerBacklog {
-		Manager.ChClosingTimer <- t.ID
-		atomic.StoreInt32(&t.closed, 1)
-	} else {
-		t.counter = 0 // automatically closed in next Cron
-	}
+	// fn is not called anymore since the timer is closed, it is only
+	// removed from the wheel on the next tick
+	Manager.pendingMu.Lock()
+	Manager.closing = append(Manager.closing, t.ID)
+	Manager.pendingMu.Unlock()
 }
 
 func (t *Timer) IsClose() bool {
@@ -150,75 +196,137 @@ func (t *Timer) IsClose() bool {
 }
 
 // execute job function with protection
-func pexec(id int64, fn Func) {
+func pexec(t *Timer) {
+	stats := statsOf(t.Name())
 	defer func() {
 		if err := recover(); err != nil {
-			logger.Log.Errorf("Call timer function error, TimerID=%d, Error=%v", id, err)
+			atomic.AddInt64(&t.panics, 1)
+			atomic.AddInt64(&stats.Panics, 1)
+			logger.Log.Errorf("Call timer function error, TimerID=%d, Name=%s, Error=%v", t.ID, t.Name(), err)
 		}
 	}()
 
-	fn()
+	atomic.AddInt64(&t.fired, 1)
+	atomic.AddInt64(&stats.Fired, 1)
+	t.fn()
+}
+
+// PendingCreations returns the number of created timers that will be
+// registered on the next tick
+func PendingCreations() int {
+	Manager.pendingMu.Lock()
+	defer Manager.pendingMu.Unlock()
+
+	return len(Manager.created)
+}
+
+// PendingCancellations returns the number of stopped timers that will be
+// removed on the next tick
+func PendingCancellations() int {
+	Manager.pendingMu.Lock()
+	defer Manager.pendingMu.Unlock()
+
+	return len(Manager.closing)
+}
+
+// applyPending registers the created timers and removes the stopped ones
+func applyPending() {
+	applyDeprecatedChannels()
+
+	Manager.pendingMu.Lock()
+	if len(Manager.created) == 0 && len(Manager.closing) == 0 {
+		Manager.pendingMu.Unlock()
+		return
+	}
+	created, closing := Manager.created, Manager.closing
+	Manager.created = make([]*Timer, 0, timerBacklog)
+	Manager.closing = make([]int64, 0, timerBacklog)
+	Manager.pendingMu.Unlock()
+
+	for _, t := range created {
+		AddTimer(t)
+	}
+	for _, id := range closing {
+		RemoveTimer(id)
+	}
+}
+
+// applyDeprecatedChannels registers and removes the timers sent to the
+// deprecated Manager channels
+func applyDeprecatedChannels() {
+	for {
+		select {
+		case t := <-Manager.ChCreatedTimer:
+			AddTimer(t)
+		case id := <-Manager.ChClosingTimer:
+			RemoveTimer(id)
+		default:
+			return
+		}
+	}
 }
 
-// Cron executes scheduled tasks
-// TODO: if closing Timers'count in single cron call more than timerBacklog will case problem.
+// Cron registers and removes pending timers then executes scheduled tasks,
+// only the timers that are due are visited
 func Cron() {
-	now := time.Now()
-	unn := now.UnixNano()
-	Manager.timers.Range(func(idInterface, tInterface interface{}) bool {
-		t := tInterface.(*Timer)
-		id := idInterface.(int64)
-		// prevent ChClosingTimer exceed
+	applyPending()
+
+	now := clk.Now()
+	due, conds := Manager.wheel.advance(now)
+
+	// condition timers
+	for _, t := range conds {
+		if t.IsClose() {
+			continue
+		}
+		// timers created without executions are never run
 		if t.counter == 0 {
-			if len(Manager.ChClosingTimer) < timerBacklog {
-				t.Stop()
-			}
-			return true
+			finish(t)
+			continue
 		}
-
-		if t.closed > 0 {
-			// TODO 这里已经移除了 timer 仍然会跑到 time callback， 先return，原因待查
-			// logger.Log.Errorf("timer closed but still do time callback id:%d", id)
-			return true
+		if t.condition.Check(now) {
+			pexec(t)
 		}
+	}
 
-		// condition timer
-		if t.condition != nil {
-			if t.condition.Check(now) {
-				pexec(id, t.fn)
-			}
-			return true
+	for _, t := range due {
+		if t.IsClose() {
+			continue
+		}
+		if t.counter == 0 {
+			finish(t)
+			continue
 		}
 
-		// execute job
-		if t.createAt+t.elapse <= unn {
-			// pexec(id, t.fn)
-			// t.elapse += int64(t.interval)
-
-			// // update timer counter
-			// if t.counter != LoopForever && t.counter > 0 {
-			// 	t.counter--
-			// }
-
-			// update timer counter
-			if t.counter != LoopForever && t.counter > 0 {
-				t.counter--
-			}
+		// update timer counter, guarded since List reads it
+		if t.counter != LoopForever && t.counter > 0 {
+			Manager.wheel.mu.Lock()
+			t.counter--
+			Manager.wheel.mu.Unlock()
+		}
 
-			pexec(id, t.fn)
-			t.elapse += int64(t.interval)
+		pexec(t)
 
+		if t.counter == 0 {
+			finish(t)
+		} else {
+			Manager.wheel.reschedule(t)
 		}
-		return true
-	})
+	}
 }
 
-// SetTimerBacklog set the timer created/closing channel backlog, A small backlog
-// may cause the logic to be blocked when call NewTimer/NewCountTimer/timer.Stop
-// in main logic gorontine.
+// SetTimerBacklog sets the initial capacity of the queues holding the timers
+// created and stopped between two ticks, the queues grow as needed.
 func SetTimerBacklog(c int) {
 	if c < 16 {
 		c = 16
 	}
 	timerBacklog = c
 }
+
+// SetClock sets the clock timers are created and executed with, it should
+// be called before the first timer is created
+func SetClock(c clock.Clock) {
+	clk = c
+	Manager.wheel.reset(c.Now())
+}
@@ -25,7 +25,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
-	"github.com/tutumagi/pitaya/helpers"
+	"github.com/tutumagi/pitaya/clock"
 )
 
 type alwaysRunCondition struct{}
@@ -55,8 +55,7 @@ var tables = []struct {
 
 func TestInit(t *testing.T) {
 	t.Parallel()
-	assert.NotNil(t, Manager.ChClosingTimer)
-	assert.NotNil(t, Manager.ChCreatedTimer)
+	assert.NotNil(t, Manager.wheel)
 }
 
 func TestNewTimer(t *testing.T) {
@@ -71,6 +70,26 @@ func TestNewTimer(t *testing.T) {
 	}
 }
 
+func TestNewTimerIsRegisteredOnNextTick(t *testing.T) {
+	// more timers than the backlog must not block
+	timers := make([]*Timer, timerBacklog*4)
+	for i := range timers {
+		timers[i] = NewTimer(func() {}, time.Hour, 1)
+	}
+	assert.True(t, PendingCreations() >= len(timers))
+	_, ok := Manager.timers.Load(timers[0].ID)
+	assert.False(t, ok)
+
+	Cron()
+	assert.Equal(t, 0, PendingCreations())
+	for _, tm := range timers {
+		_, ok := Manager.timers.Load(tm.ID)
+		assert.True(t, ok)
+		tm.Stop()
+	}
+	Cron()
+}
+
 func TestAddTimer(t *testing.T) {
 	for _, table := range tables {
 		t.Run(table.name, func(t *testing.T) {
@@ -113,10 +132,20 @@ func TestStop(t *testing.T) {
 	for _, table := range tables {
 		t.Run(table.name, func(t *testing.T) {
 			tm := NewTimer(table.f, table.interval, table.counter)
+			AddTimer(tm)
 			tm.Stop()
-			closedID := helpers.ShouldEventuallyReceive(t, Manager.ChClosingTimer).(int64)
-			assert.Equal(t, tm.ID, closedID)
 			assert.Equal(t, int32(1), tm.closed)
+			assert.True(t, PendingCancellations() > 0)
+
+			// stopping twice does not queue the timer again
+			pending := PendingCancellations()
+			tm.Stop()
+			assert.Equal(t, pending, PendingCancellations())
+
+			Cron()
+			_, ok := Manager.timers.Load(tm.ID)
+			assert.False(t, ok)
+			assert.Equal(t, 0, PendingCancellations())
 		})
 	}
 }
@@ -137,17 +166,23 @@ func TestPexec(t *testing.T) {
 	dFunc := func() {
 		i++
 	}
-	pexec(10, dFunc)
+	tm := &Timer{ID: 10, fn: dFunc}
+	pexec(tm)
 	assert.Equal(t, 1, i)
+	assert.Equal(t, int64(1), tm.fired)
+	assert.Equal(t, int64(0), tm.panics)
 
 	panicFunc := func() {
 		panic("bla")
 	}
 
 	// should not panic because the execution is protected
+	tm = &Timer{ID: 20, fn: panicFunc}
 	assert.NotPanics(t, func() {
-		pexec(20, panicFunc)
+		pexec(tm)
 	})
+	assert.Equal(t, int64(1), tm.fired)
+	assert.Equal(t, int64(1), tm.panics)
 }
 
 func TestCron(t *testing.T) {
@@ -204,3 +239,65 @@ func TestCron(t *testing.T) {
 	// after more 25ms j should be still 2 because of the counter
 	assert.Equal(t, 2, j)
 }
+
+func TestCronWithManualClock(t *testing.T) {
+	c := clock.NewManual(time.Now())
+	SetClock(c)
+	defer SetClock(clock.New())
+
+	count := 0
+	tm := NewTimer(func() { count++ }, time.Hour, 2)
+	AddTimer(tm)
+
+	Cron()
+	assert.Equal(t, 0, count)
+
+	c.Advance(59 * time.Minute)
+	Cron()
+	assert.Equal(t, 0, count)
+
+	c.Advance(time.Minute)
+	Cron()
+	assert.Equal(t, 1, count)
+
+	c.Advance(2 * time.Hour)
+	Cron()
+	assert.Equal(t, 2, count)
+	assert.True(t, tm.IsClose())
+}
+
+func TestCronZeroCounter(t *testing.T) {
+	c := clock.NewManual(time.Now())
+	SetClock(c)
+	defer SetClock(clock.New())
+
+	count := 0
+	tm := NewTimer(func() { count++ }, time.Minute, 0)
+	AddTimer(tm)
+	cond := NewTimer(func() { count++ }, time.Minute, 0)
+	cond.SetCondition(&alwaysRunCondition{})
+	AddTimer(cond)
+
+	Cron()
+	c.Advance(time.Minute)
+	Cron()
+	assert.Equal(t, 0, count)
+	assert.True(t, tm.IsClose())
+	assert.True(t, cond.IsClose())
+}
+
+func TestDeprecatedManagerChannels(t *testing.T) {
+	tm := NewTimer(func() {}, time.Minute, LoopForever)
+	applyPending()
+	RemoveTimer(tm.ID)
+
+	Manager.ChCreatedTimer <- tm
+	applyPending()
+	_, ok := Manager.timers.Load(tm.ID)
+	assert.True(t, ok)
+
+	Manager.ChClosingTimer <- tm.ID
+	applyPending()
+	_, ok = Manager.timers.Load(tm.ID)
+	assert.False(t, ok)
+}
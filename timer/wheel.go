@@ -0,0 +1,262 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package timer
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// The wheel is a hierarchical timing wheel in the style of the classic
+// kernel timer wheel: a 256 slot inner wheel with a resolution of one
+// millisecond, and four outer wheels of 64 slots each. Timers only move
+// between wheels when an outer slot is cascaded, so the cost of a tick
+// depends on the number of timers that are due, not on the total number
+// of registered timers.
+const (
+	wheelResolution = time.Millisecond
+
+	tvrBits = 8
+	tvnBits = 6
+	tvrSize = 1 << tvrBits
+	tvnSize = 1 << tvnBits
+	tvrMask = tvrSize - 1
+	tvnMask = tvnSize - 1
+	tvnNum  = 4
+
+	// maxTimeout is the farthest tick a timer can be placed at, timers
+	// beyond it are parked in the outermost wheel and re-placed on cascade
+	maxTimeout = 1<<(tvrBits+tvnNum*tvnBits) - 1
+)
+
+type timingWheel struct {
+	mu    sync.Mutex
+	epoch int64                       // unix nano of tick zero
+	tick  int64                       // next tick to be processed
+	count int                         // number of timers in the wheel
+	tv1   [tvrSize]*list.List         // inner wheel
+	tvn   [tvnNum][tvnSize]*list.List // outer wheels
+	conds map[int64]*Timer            // condition timers, checked every tick
+}
+
+func newTimingWheel(now time.Time) *timingWheel {
+	w := &timingWheel{}
+	w.init(now)
+	return w
+}
+
+func (w *timingWheel) init(now time.Time) {
+	w.epoch = now.UnixNano()
+	w.tick = 0
+	w.count = 0
+	w.conds = make(map[int64]*Timer)
+	for i := range w.tv1 {
+		w.tv1[i] = list.New()
+	}
+	for i := range w.tvn {
+		for j := range w.tvn[i] {
+			w.tvn[i][j] = list.New()
+		}
+	}
+}
+
+// reset moves the epoch of the wheel to now and places the registered
+// timers again
+func (w *timingWheel) reset(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.init(now)
+	Manager.timers.Range(func(_, v interface{}) bool {
+		t := v.(*Timer)
+		t.bucket = nil
+		t.elem = nil
+		w.add(t)
+		return true
+	})
+}
+
+// tickOf returns the first tick at or after the unix nano timestamp ns
+func (w *timingWheel) tickOf(ns int64) int64 {
+	d := ns - w.epoch
+	if d <= 0 {
+		return 0
+	}
+	return (d + int64(wheelResolution) - 1) / int64(wheelResolution)
+}
+
+// deadline returns the unix nano timestamp of the next execution of t
+func (t *Timer) deadline() int64 {
+	if t.elapse > math.MaxInt64-t.createAt {
+		return math.MaxInt64
+	}
+	return t.createAt + t.elapse
+}
+
+func (w *timingWheel) add(t *Timer) {
+	if t.IsClose() || t.bucket != nil {
+		return
+	}
+	if _, ok := w.conds[t.ID]; ok {
+		return
+	}
+
+	if t.condition != nil {
+		w.conds[t.ID] = t
+		return
+	}
+
+	t.expire = w.tickOf(t.deadline())
+	w.place(t)
+	w.count++
+}
+
+func (w *timingWheel) place(t *Timer) {
+	expire := t.expire
+	idx := expire - w.tick
+
+	var bucket *list.List
+	switch {
+	case idx < 0:
+		// already expired, execute on the next tick
+		bucket = w.tv1[w.tick&tvrMask]
+	case idx < tvrSize:
+		bucket = w.tv1[expire&tvrMask]
+	default:
+		if idx > maxTimeout {
+			idx = maxTimeout
+			expire = w.tick + maxTimeout
+		}
+		for level := uint(0); level < tvnNum; level++ {
+			if idx < 1<<(tvrBits+(level+1)*tvnBits) || level == tvnNum-1 {
+				bucket = w.tvn[level][(expire>>(tvrBits+level*tvnBits))&tvnMask]
+				break
+			}
+		}
+	}
+
+	t.bucket = bucket
+	t.elem = bucket.PushBack(t)
+}
+
+func (w *timingWheel) remove(t *Timer) {
+	if t.bucket != nil {
+		t.bucket.Remove(t.elem)
+		t.bucket = nil
+		t.elem = nil
+		w.count--
+	}
+	delete(w.conds, t.ID)
+}
+
+// cascade moves the timers of the current slot of an outer wheel to the
+// inner wheels and returns the index of the cascaded slot
+func (w *timingWheel) cascade(level int) int64 {
+	index := (w.tick >> (tvrBits + uint(level)*tvnBits)) & tvnMask
+	bucket := w.tvn[level][index]
+	if bucket.Len() == 0 {
+		return index
+	}
+
+	w.tvn[level][index] = list.New()
+	for e := bucket.Front(); e != nil; e = e.Next() {
+		w.place(e.Value.(*Timer))
+	}
+	return index
+}
+
+// advance moves the wheel up to now, unlinking and returning all timers
+// that are due, and a snapshot of condition timers
+func (w *timingWheel) advance(now time.Time) (due []*Timer, conds []*Timer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	target := (now.UnixNano() - w.epoch) / int64(wheelResolution)
+	if w.count == 0 && target >= w.tick {
+		// nothing to execute, jump straight to now
+		w.tick = target + 1
+	}
+
+	for w.tick <= target {
+		index := w.tick & tvrMask
+		if index == 0 {
+			for level := 0; level < tvnNum && w.cascade(level) == 0; level++ {
+			}
+		}
+
+		bucket := w.tv1[index]
+		w.tick++
+		if bucket.Len() == 0 {
+			continue
+		}
+
+		w.tv1[index] = list.New()
+		for e := bucket.Front(); e != nil; e = e.Next() {
+			t := e.Value.(*Timer)
+			t.bucket = nil
+			t.elem = nil
+			w.count--
+			due = append(due, t)
+		}
+	}
+
+	if len(w.conds) > 0 {
+		conds = make([]*Timer, 0, len(w.conds))
+		for _, t := range w.conds {
+			conds = append(conds, t)
+		}
+	}
+
+	return due, conds
+}
+
+// reschedule puts a timer that has just been executed back into the wheel
+func (w *timingWheel) reschedule(t *Timer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t.IsClose() {
+		return
+	}
+	if _, ok := Manager.timers.Load(t.ID); !ok {
+		return
+	}
+
+	t.elapse += int64(t.interval)
+	t.expire = w.tickOf(t.deadline())
+	w.place(t)
+	w.count++
+}
+
+func (w *timingWheel) setCondition(t *Timer, condition Condition) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	t.condition = condition
+	if _, ok := Manager.timers.Load(t.ID); !ok {
+		// not registered yet, AddTimer will place it
+		return
+	}
+	w.remove(t)
+	w.add(t)
+}
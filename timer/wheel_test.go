@@ -0,0 +1,135 @@
+// Copyright (c) TFG Co. All Rights Reserved.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package timer
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newWheelTimer(id int64, start time.Time, d time.Duration) *Timer {
+	return &Timer{
+		ID:       id,
+		fn:       func() {},
+		createAt: start.UnixNano(),
+		interval: d,
+		elapse:   int64(d),
+		counter:  1,
+	}
+}
+
+func TestWheelAdvance(t *testing.T) {
+	t.Parallel()
+	start := time.Now()
+	delays := []time.Duration{
+		0,
+		5 * time.Millisecond,
+		255 * time.Millisecond,
+		256 * time.Millisecond,
+		300 * time.Millisecond,
+		20 * time.Second,
+		17 * time.Minute,
+		2 * time.Hour,
+		30 * time.Hour,
+	}
+
+	w := newTimingWheel(start)
+	for i, d := range delays {
+		w.add(newWheelTimer(int64(i), start, d))
+	}
+	assert.Equal(t, len(delays), w.count)
+
+	fired := map[int64]time.Duration{}
+	step := 100 * time.Millisecond
+	for elapsed := time.Duration(0); elapsed <= 31*time.Hour; elapsed += step {
+		due, _ := w.advance(start.Add(elapsed))
+		for _, tm := range due {
+			fired[tm.ID] = elapsed
+		}
+	}
+
+	assert.Equal(t, 0, w.count)
+	for i, d := range delays {
+		at, ok := fired[int64(i)]
+		assert.True(t, ok, "timer with delay %s did not fire", d)
+		assert.True(t, at >= d && at < d+step, "timer with delay %s fired at %s", d, at)
+	}
+}
+
+func TestWheelRemove(t *testing.T) {
+	t.Parallel()
+	start := time.Now()
+	w := newTimingWheel(start)
+
+	tm1 := newWheelTimer(1, start, 10*time.Millisecond)
+	tm2 := newWheelTimer(2, start, time.Hour)
+	w.add(tm1)
+	w.add(tm2)
+	w.add(tm2)
+	assert.Equal(t, 2, w.count)
+
+	w.remove(tm1)
+	w.remove(tm2)
+	assert.Equal(t, 0, w.count)
+	assert.Nil(t, tm1.bucket)
+	assert.Nil(t, tm2.bucket)
+
+	due, _ := w.advance(start.Add(2 * time.Hour))
+	assert.Len(t, due, 0)
+}
+
+func TestWheelConditionTimer(t *testing.T) {
+	t.Parallel()
+	start := time.Now()
+	w := newTimingWheel(start)
+
+	tm := newWheelTimer(1, start, time.Millisecond)
+	tm.condition = &alwaysRunCondition{}
+	w.add(tm)
+	assert.Equal(t, 0, w.count)
+
+	due, conds := w.advance(start.Add(time.Second))
+	assert.Len(t, due, 0)
+	assert.Equal(t, []*Timer{tm}, conds)
+}
+
+func BenchmarkWheelTick(b *testing.B) {
+	for _, n := range []int{1000, 10000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("%dtimers", n), func(b *testing.B) {
+			start := time.Now()
+			w := newTimingWheel(start)
+			r := rand.New(rand.NewSource(1))
+			for i := 0; i < n; i++ {
+				d := time.Hour + time.Duration(r.Int63n(int64(1000*time.Hour)))
+				w.add(newWheelTimer(int64(i), start, d))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.advance(start.Add(time.Duration(i) * time.Second))
+			}
+		})
+	}
+}
@@ -63,6 +63,26 @@ func TestNewCondTimer(t *testing.T) {
 	assert.NotNil(t, tt)
 }
 
+func TestNewCronTimer(t *testing.T) {
+	t.Parallel()
+	_, err := NewCronTimer("0 5 * *", func() {})
+	assert.Error(t, err)
+
+	tt, err := NewCronTimer("0 5 * * *", func() {})
+	assert.NoError(t, err)
+	assert.NotNil(t, tt)
+}
+
+func TestNewScheduleTimer(t *testing.T) {
+	t.Parallel()
+	_, err := NewScheduleTimer(nil, func() {})
+	assert.EqualError(t, constants.ErrNilCondition, err.Error())
+
+	tt, err := NewScheduleTimer(timer.Weekly(time.Monday, 5, 0, 0, time.UTC), func() {})
+	assert.NoError(t, err)
+	assert.NotNil(t, tt)
+}
+
 func TestSetTimerPrecision(t *testing.T) {
 	t.Parallel()
 	dur := 33 * time.Millisecond